@@ -13,11 +13,19 @@ import (
 
 	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/api"
 	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/db"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/metrics"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/outbox"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/processing"
 	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/queue"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/scheduler"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/signing"
 	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/storage"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/webhook"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/pkg/utils"
 	"github.com/nats-io/nats.go"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
@@ -34,14 +42,10 @@ func main() {
 	}
 	defer database.Close()
 
-	// storage base path
-	base := os.Getenv("STORAGE_PATH")
-	if base == "" {
-		base = "./data"
-	}
-	lf := storage.NewLocalFS(base)
-	if err := lf.EnsureBasePath(base); err != nil {
-		log.Fatal().Err(err).Msg("failed to create storage base path")
+	// storage backend (local disk or S3, see STORAGE_BACKEND)
+	store, err := storage.New(storage.ConfigFromEnv())
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to init storage")
 	}
 
 	//Initialize NATS client
@@ -54,17 +58,71 @@ func main() {
 		log.Fatal().Err(err).Msg("failed to connect nats")
 	}
 	defer nClient.Close()
+	if utils.EnvBool("NATS_JETSTREAM", false) {
+		if err := nClient.EnableJetStream(queue.DefaultJetStreamConfig()); err != nil {
+			log.Fatal().Err(err).Msg("failed to set up jetstream")
+		}
+	}
+
+	metrics.Register()
+
+	// relay publishes jobs committed to the outbox table
+	relayCtx, stopRelay := context.WithCancel(ctx)
+	defer stopRelay()
+	relay := outbox.NewRelay(database, nClient, utils.EnvDuration("OUTBOX_POLL_INTERVAL", time.Second))
+	go relay.Run(relayCtx)
+
+	// dispatcher POSTs the webhook deliveries queued on job state changes
+	dispatcher := webhook.NewDispatcher(database, webhook.Config{
+		Timeout:     utils.EnvDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+		MaxAttempts: utils.EnvInt("WEBHOOK_MAX_ATTEMPTS", 8),
+	})
+	go dispatcher.Run(relayCtx)
+
+	// signed download URLs, disabled unless SIGNING_KEYS is set
+	share := api.ShareConfig{
+		BaseURL: os.Getenv("PUBLIC_BASE_URL"),
+		MaxTTL:  utils.EnvDuration("SIGNED_URL_MAX_TTL", 7*24*time.Hour),
+	}
+	if spec := os.Getenv("SIGNING_KEYS"); spec != "" {
+		if share.Keys, err = signing.ParseKeys(spec); err != nil {
+			log.Fatal().Err(err).Msg("invalid SIGNING_KEYS")
+		}
+	}
 
 	apiSvc := &api.API{
 		DB:      database,
-		Storage: lf,
+		Storage: store,
 		Queue:   nClient,
+		Outbox:  relay,
+		Tus: api.TusConfig{
+			MaxSize: int64(utils.EnvInt("TUS_MAX_SIZE_MB", 4096)) << 20,
+			Expiry:  utils.EnvDuration("TUS_EXPIRY", 24*time.Hour),
+		},
+		Upload: api.UploadConfig{
+			MaxSize:     int64(utils.EnvInt("UPLOAD_MAX_SIZE_MB", 1024)) << 20,
+			MaxDuration: utils.EnvDuration("UPLOAD_MAX_DURATION", 4*time.Hour),
+			Timeout:     utils.EnvDuration("UPLOAD_TIMEOUT", time.Hour),
+		},
+		Share:         share,
+		Events:        api.NewEventHub(database),
+		CancelCleanup: processing.NewCancelCleanup(database, store),
 	}
+	go apiSvc.Events.Run(relayCtx)
+	// scheduler queues delayed jobs once due and runs the periodic clean-ups
+	// (expired tus uploads, old job events, used nonces) on one replica at a time
+	sched := scheduler.New(database, relay, scheduler.Config{
+		Interval: utils.EnvDuration("SCHEDULER_INTERVAL", time.Second),
+	}, apiSvc.MaintenanceSchedules()...)
+	go sched.Run(relayCtx)
 
 	r := chi.NewRouter()
 	r.Get("/health", healthHandler)
 	r.Get("/ready", readyHandler)
+	r.Handle("/metrics", promhttp.Handler())
 	r.Post("/upload", apiSvc.UploadHandler)
+	apiSvc.RegisterTusRoutes(r)
+	apiSvc.RegisterShareRoutes(r)
 
 	r.Get("/uploads/{id}/analysis", apiSvc.GetUploadAnalysisHandler) //expose analysis results
 
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/db"
+
+	"github.com/rs/zerolog/log"
+)
+
+const usage = `usage: migrate <command>
+
+commands:
+  up          apply all pending migrations
+  down [n]    roll back the last n migrations (default 1)
+  status      list migrations and when they were applied`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	// connect without auto-migrating so "down" and "status" see the real state
+	database, err := db.Connect(ctx)
+	if err != nil {
+		log.Fatal().Err(err).Msg("db connect failed")
+	}
+	defer database.Close()
+
+	switch os.Args[1] {
+	case "up":
+		if err := database.Migrate(ctx); err != nil {
+			log.Fatal().Err(err).Msg("migrate up failed")
+		}
+		log.Info().Msg("migrations applied")
+	case "down":
+		steps := 1
+		if len(os.Args) > 2 {
+			n, err := strconv.Atoi(os.Args[2])
+			if err != nil || n < 1 {
+				log.Fatal().Str("arg", os.Args[2]).Msg("down expects a positive step count")
+			}
+			steps = n
+		}
+		if err := database.MigrateDown(ctx, steps); err != nil {
+			log.Fatal().Err(err).Msg("migrate down failed")
+		}
+		log.Info().Int("steps", steps).Msg("migrations rolled back")
+	case "status":
+		statuses, err := database.MigrationStatuses(ctx)
+		if err != nil {
+			log.Fatal().Err(err).Msg("migration status failed")
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d  %-40s %s\n", s.Version, s.Name, applied)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
@@ -2,162 +2,82 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 	"os"
 	"os/signal"
-	"path/filepath"
-	"strings"
-	"sync/atomic"
+	"runtime"
 	"syscall"
 	"time"
 
-	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/audio"
 	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/db"
-	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/queue"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/processing"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/storage"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/worker"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/pkg/utils"
 
 	"github.com/nats-io/nats.go"
 	"github.com/rs/zerolog/log"
 )
 
-var running int32 = 1
-
 func main() {
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	// DB connect (reuse db.New)
+	// DB connect (reuse db.New); shared by the pool and the handler
 	database, err := db.New(ctx)
 	if err != nil {
 		log.Fatal().Err(err).Msg("db connect failed")
 	}
 	defer database.Close()
 
-	// NATS client
-	natsURL := os.Getenv("NATS_URL")
-	if natsURL == "" {
-		natsURL = nats.DefaultURL
+	// storage backend shared with the API (STORAGE_BACKEND / STORAGE_PATH / S3_*)
+	store, err := storage.New(storage.ConfigFromEnv())
+	if err != nil {
+		log.Fatal().Err(err).Msg("storage init failed")
 	}
-	nc, err := queue.NewNatsClient(natsURL)
+
+	// share of a busy worker's picks per priority lane
+	laneWeights, err := worker.ParseLaneWeights(utils.EnvString("WORKER_LANE_WEIGHTS", ""))
 	if err != nil {
-		log.Fatal().Err(err).Msg("nats connect failed")
+		log.Fatal().Err(err).Msg("invalid WORKER_LANE_WEIGHTS")
 	}
-	defer nc.Close()
 
-	// subscribe to subject "jobs" with queue group "audio-workers"
-	subj := "jobs"
-	queueGroup := "audio-workers"
+	concurrency := utils.EnvInt("WORKER_CONCURRENCY", runtime.NumCPU())
+	cfg := worker.WorkerConfig{
+		NatsURL:        utils.EnvString("NATS_URL", nats.DefaultURL),
+		Concurrency:    concurrency,
+		QueueSize:      utils.EnvInt("WORKER_QUEUE_SIZE", 2*concurrency),
+		DevLogging:     utils.EnvBool("DEV_LOGGING", false),
+		JetStream:      utils.EnvBool("NATS_JETSTREAM", false),
+		JobTimeout:     utils.EnvDuration("JOB_TIMEOUT", 10*time.Minute),
+		RetryBaseDelay: utils.EnvDuration("RETRY_BASE_DELAY", 2*time.Second),
+		MetricsAddr:    utils.EnvString("METRICS_PORT", ":2113"),
+		DB:             database,
+		OnCancel:       processing.NewCancelCleanup(database, store),
+		LaneWeights:    laneWeights,
+		LeaseTTL:       utils.EnvDuration("WORKER_LEASE_TTL", 30*time.Second),
+	}
 
-	sub, err := nc.QueueSubscribe(subj, queueGroup, func(m *nats.Msg) {
-		var jm queue.JobMessage
-		if err := json.Unmarshal(m.Data, &jm); err != nil {
-			log.Error().Err(err).Msg("invalid job message")
-			return
-		}
-		go handleJob(context.Background(), database, jm) // process concurrently
-	})
+	opts, err := processing.OptionsFromEnv()
 	if err != nil {
-		log.Fatal().Err(err).Msg("subscribe failed")
+		log.Fatal().Err(err).Msg("invalid processing options")
 	}
-	defer sub.Unsubscribe()
+	handler := processing.NewHandler(database, store, opts)
+	pool, err := worker.RunWorker(ctx, cfg, handler)
+	if err != nil {
+		log.Fatal().Err(err).Msg("worker start failed")
+	}
+	log.Info().Int("concurrency", cfg.Concurrency).Bool("jetstream", cfg.JetStream).Msg("worker started")
 
 	// graceful shutdown
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
 	<-sigCh
 	log.Info().Msg("shutdown requested")
-	atomic.StoreInt32(&running, 0)
-	time.Sleep(1 * time.Second) // wait for current go routines or handle elegantly
-	log.Info().Msg("worker stopped")
-}
-
-func handleJob(ctx context.Context, db *db.DB, jm queue.JobMessage) {
-	jobID := jm.JobID
-	uploadID := jm.UploadID
-
-	_ = db.UpdateJobStatus(ctx, jobID, "running", 1, "worker: started")
-
-	// fetch upload path
-	var relPath string
-	if err := db.Pool.QueryRow(ctx, `SELECT path FROM uploads WHERE id=$1`, uploadID).Scan(&relPath); err != nil {
-		_ = db.UpdateJobStatus(ctx, jobID, "failed", 0, "upload not found")
-		return
-	}
-
-	base := "./data" // must match your storage base
-	inputFull := filepath.Join(base, relPath)
-
-	// 1) Probe
-	info, err := audio.Probe(ctx, inputFull)
-	if err != nil {
-		_ = db.UpdateJobStatus(ctx, jobID, "failed", 0, "probe failed: "+err.Error())
-		return
+	cancel()
+	select {
+	case <-pool.Done():
+	case <-time.After(30 * time.Second):
+		log.Warn().Msg("worker pool did not stop in time")
 	}
-	// update duration in uploads table
-	_, _ = db.Pool.Exec(ctx, `UPDATE uploads SET duration_seconds=$1 WHERE id=$2`, info.Duration.Seconds(), uploadID)
-	_ = db.UpdateJobStatus(ctx, jobID, "processing", 10, fmt.Sprintf("probe ok (dur=%v)", info.Duration))
-
-	// 2) Transcode -> create output path
-	outputRel := relPath + ".mp3" // simple suffix; adjust later
-	outputFull := filepath.Join(base, outputRel)
-
-	// ensure dir exists
-	if err := os.MkdirAll(filepath.Dir(outputFull), 0o755); err != nil {
-		_ = db.UpdateJobStatus(ctx, jobID, "failed", 0, "mkdir failed: "+err.Error())
-		return
-	}
-
-	// Transcode with timeout context
-	trCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
-	defer cancel()
-	if err := audio.Transcode(trCtx, inputFull, outputFull); err != nil {
-		_ = db.UpdateJobStatus(ctx, jobID, "failed", 0, "transcode failed: "+err.Error())
-		return
-	}
-	_ = db.UpdateJobStatus(ctx, jobID, "processing", 60, "transcode done")
-
-	// 1) LUFS (you may already compute it)
-	lufs, err := audio.Loudness(ctx, outputFull)
-	if err == nil {
-		_, _ = db.Pool.Exec(ctx, `UPDATE uploads SET integrated_lufs=$1 WHERE id=$2`, lufs, jm.UploadID)
-		_ = db.UpdateJobStatus(ctx, jm.JobID, "processing", 75, fmt.Sprintf("loudness=%.2f", lufs))
-	}
-
-	// 2) BPM + Key via python analyzer
-	// set python executable path and script path (config or env)
-	pythonExe := "python" // or full path like ".\\.venv\\Scripts\\python.exe"
-	scriptPath := "./tools/analyze.py"
-	analysisCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
-	defer cancel()
-	res, err := audio.AnalyzeWithPython(analysisCtx, pythonExe, scriptPath, outputFull, 60*time.Second)
-	if err == nil && res != nil {
-		_, _ = db.Pool.Exec(ctx, `UPDATE uploads SET bpm=$1, musical_key=$2 WHERE id=$3`, res.BPM, res.Key, jm.UploadID)
-		_ = db.UpdateJobStatus(ctx, jm.JobID, "processing", 90, fmt.Sprintf("bpm=%.2f key=%s", res.BPM, res.Key))
-	} else {
-		_ = db.UpdateJobStatus(ctx, jm.JobID, "processing", 90, "analysis failed: "+err.Error())
-	}
-
-	// 3) Loudness analysis
-	if err == nil {
-		// save to uploads table
-		_, _ = db.Pool.Exec(ctx, `UPDATE uploads SET output_path=$1, integrated_lufs=$2 WHERE id=$3`, outputRel, lufs, uploadID)
-		_ = db.UpdateJobStatus(ctx, jobID, "processing", 80, fmt.Sprintf("loudness=%.2f LUFS", lufs))
-	} else {
-		// not fatal — record absence
-		_, _ = db.Pool.Exec(ctx, `UPDATE uploads SET output_path=$1 WHERE id=$2`, outputRel, uploadID)
-		_ = db.UpdateJobStatus(ctx, jobID, "processing", 80, "loudness analysis failed: "+err.Error())
-	}
-
-	// 4) Waveform generation (PNG)
-	wavePath := strings.TrimSuffix(outputRel, filepath.Ext(outputRel)) + "-wave.png"
-	waveFull := filepath.Join(base, wavePath)
-	if err := audio.GenerateWaveform(ctx, outputFull, waveFull, 800, 160); err == nil {
-		// optionally save path to DB, you can create column for waveform if needed
-		_, _ = db.Pool.Exec(ctx, `UPDATE uploads SET output_path=$1 WHERE id=$2`, outputRel, uploadID)
-		_ = db.UpdateJobStatus(ctx, jobID, "processing", 95, "waveform generated")
-	} else {
-		_ = db.UpdateJobStatus(ctx, jobID, "processing", 95, "waveform failed: "+err.Error())
-	}
-
-	// 5) finish
-	_ = db.UpdateJobStatus(ctx, jobID, "done", 100, "processing finished")
+	log.Info().Msg("worker stopped")
 }
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/db"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/metrics"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/queue"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// ListDeadLettersHandler lists dead letters, newest first. Query filters:
+// job_id (repeatable), upload_id, type, error (substring of last_error),
+// since and until (RFC 3339, on failed_at); include_requeued=true also lists
+// letters whose job was requeued. ?limit= (max 500) and ?before= (an id)
+// page through the result.
+func (a *API) ListDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f, err := deadLetterFilterFromQuery(q)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	limit := 50
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			writeError(w, &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "limit must be 1-500"})
+			return
+		}
+		limit = n
+	}
+	var before int64
+	if v := q.Get("before"); v != "" {
+		if before, err = strconv.ParseInt(v, 10, 64); err != nil {
+			writeError(w, &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "invalid before"})
+			return
+		}
+	}
+	letters, err := a.DB.ListDeadLetters(r.Context(), f, before, limit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, letters)
+}
+
+func deadLetterFilterFromQuery(q url.Values) (db.DeadLetterFilter, error) {
+	invalid := func(field string) error {
+		return &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "invalid " + field}
+	}
+	f := db.DeadLetterFilter{Type: q.Get("type"), Error: q.Get("error"), IncludeRequeued: q.Get("include_requeued") == "true"}
+	for _, v := range q["job_id"] {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return f, invalid("job_id")
+		}
+		f.JobIDs = append(f.JobIDs, id)
+	}
+	if v := q.Get("upload_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return f, invalid("upload_id")
+		}
+		f.UploadID = &id
+	}
+	for field, dst := range map[string]**time.Time{"since": &f.Since, "until": &f.Until} {
+		if v := q.Get(field); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, invalid(field)
+			}
+			*dst = &t
+		}
+	}
+	return f, checkDeadLetterRange(f)
+}
+
+// checkDeadLetterRange rejects a since that is not before until, which
+// would match nothing.
+func checkDeadLetterRange(f db.DeadLetterFilter) error {
+	if f.Since != nil && f.Until != nil && !f.Since.Before(*f.Until) {
+		return &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "since must be before until"}
+	}
+	return nil
+}
+
+type requeueResponse struct {
+	JobID  int64  `json:"job_id"`
+	Status string `json:"status"`
+}
+
+// RequeueJobHandler puts a failed job back into the queue with its retry
+// count reset. Only failed jobs can be requeued (409 otherwise).
+func (a *API) RequeueJobHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "invalid id"})
+		return
+	}
+	err = a.DB.WithTx(ctx, func(tx pgx.Tx) error {
+		j, err := db.RequeueFailedJob(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		return publishJob(ctx, tx, *j)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		var status string
+		if err := a.DB.Pool.QueryRow(ctx, `SELECT status FROM jobs WHERE id=$1`, id).Scan(&status); err != nil {
+			writeError(w, &apiError{Status: http.StatusNotFound, Code: "not_found", Message: "job not found"})
+			return
+		}
+		writeError(w, &apiError{Status: http.StatusConflict, Code: "job_not_failed", Message: "only failed jobs can be requeued; job is " + status})
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	metrics.JobsRequeued.Inc()
+	if a.Outbox != nil {
+		a.Outbox.Notify()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	writeJSON(w, requeueResponse{JobID: id, Status: "queued"})
+}
+
+type bulkRequeueRequest struct {
+	JobIDs   []int64    `json:"job_ids,omitempty"`
+	UploadID *int64     `json:"upload_id,omitempty"`
+	Type     string     `json:"type,omitempty"`
+	Error    string     `json:"error,omitempty"`
+	Since    *time.Time `json:"since,omitempty"`
+	Until    *time.Time `json:"until,omitempty"`
+	// All must be set to requeue without any filter.
+	All   bool `json:"all,omitempty"`
+	Limit int  `json:"limit,omitempty"` // default 100, max 1000
+}
+
+// filter validates the request, defaulting its limit, and returns its
+// filter. An empty filter requeues every dead letter, so it needs All.
+func (req *bulkRequeueRequest) filter() (db.DeadLetterFilter, error) {
+	f := db.DeadLetterFilter{JobIDs: req.JobIDs, UploadID: req.UploadID, Type: req.Type, Error: req.Error, Since: req.Since, Until: req.Until}
+	if len(f.JobIDs) == 0 && f.UploadID == nil && f.Type == "" && f.Error == "" && f.Since == nil && f.Until == nil && !req.All {
+		return f, &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "give at least one filter, or \"all\": true"}
+	}
+	if req.Limit == 0 {
+		req.Limit = 100
+	}
+	if req.Limit < 1 || req.Limit > 1000 {
+		return f, &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "limit must be 1-1000"}
+	}
+	return f, checkDeadLetterRange(f)
+}
+
+type bulkRequeueResponse struct {
+	Requeued int     `json:"requeued"`
+	JobIDs   []int64 `json:"job_ids"`
+}
+
+// BulkRequeueHandler requeues the failed jobs whose open dead letters match
+// the filter in the body, like RequeueJobHandler for each. Use GET
+// /dead-letters with the same filter to preview the selection.
+func (a *API) BulkRequeueHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req bulkRequeueRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "invalid JSON body"})
+		return
+	}
+	f, err := req.filter()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	resp := bulkRequeueResponse{JobIDs: []int64{}}
+	err = a.DB.WithTx(ctx, func(tx pgx.Tx) error {
+		jobs, err := db.RequeueDeadLetters(ctx, tx, f, req.Limit)
+		if err != nil {
+			return err
+		}
+		for _, j := range jobs {
+			if err := publishJob(ctx, tx, j); err != nil {
+				return err
+			}
+			resp.JobIDs = append(resp.JobIDs, j.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	resp.Requeued = len(resp.JobIDs)
+	if resp.Requeued > 0 {
+		metrics.JobsRequeued.Add(float64(resp.Requeued))
+		if a.Outbox != nil {
+			a.Outbox.Notify()
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	writeJSON(w, resp)
+}
+
+// publishJob writes the outbox entry that publishes j on its lane.
+func publishJob(ctx context.Context, tx pgx.Tx, j db.JobRef) error {
+	return db.InsertOutbox(ctx, tx, queue.Subject(j.Priority), queue.JobMessage{
+		JobID:    j.ID,
+		UploadID: j.UploadID,
+		Type:     j.Type,
+		Priority: j.Priority,
+	})
+}
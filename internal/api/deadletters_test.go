@@ -0,0 +1,129 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadLetterFilterFromQuery(t *testing.T) {
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	until := since.Add(time.Hour)
+	upload := int64(3)
+	cases := []struct {
+		query string
+		want  db.DeadLetterFilter
+		err   string
+	}{
+		{"", db.DeadLetterFilter{}, ""},
+		{"job_id=1&job_id=2&upload_id=3&type=transcode&error=ffmpeg&include_requeued=true",
+			db.DeadLetterFilter{JobIDs: []int64{1, 2}, UploadID: &upload, Type: "transcode", Error: "ffmpeg", IncludeRequeued: true}, ""},
+		{"since=2026-01-01T00:00:00Z&until=2026-01-01T01:00:00Z", db.DeadLetterFilter{Since: &since, Until: &until}, ""},
+		{"since=2026-01-01T00:00:00Z", db.DeadLetterFilter{Since: &since}, ""},
+		{"include_requeued=1", db.DeadLetterFilter{}, ""},
+		{"job_id=x", db.DeadLetterFilter{}, "invalid job_id"},
+		{"upload_id=", db.DeadLetterFilter{}, ""},
+		{"upload_id=-", db.DeadLetterFilter{}, "invalid upload_id"},
+		{"until=yesterday", db.DeadLetterFilter{}, "invalid until"},
+		{"since=2026-01-01T01:00:00Z&until=2026-01-01T00:00:00Z", db.DeadLetterFilter{}, "since must be before until"},
+		{"since=2026-01-01T00:00:00Z&until=2026-01-01T02:00:00%2B02:00", db.DeadLetterFilter{}, "since must be before until"},
+	}
+	for _, tc := range cases {
+		q, err := url.ParseQuery(tc.query)
+		require.NoError(t, err)
+		f, err := deadLetterFilterFromQuery(q)
+		if tc.err != "" {
+			var ae *apiError
+			require.ErrorAs(t, err, &ae, tc.query)
+			require.Equal(t, http.StatusBadRequest, ae.Status, tc.query)
+			require.Equal(t, tc.err, ae.Message, tc.query)
+			continue
+		}
+		require.NoError(t, err, tc.query)
+		require.Equal(t, tc.want.JobIDs, f.JobIDs, tc.query)
+		require.Equal(t, tc.want.UploadID, f.UploadID, tc.query)
+		require.Equal(t, tc.want.Type, f.Type, tc.query)
+		require.Equal(t, tc.want.Error, f.Error, tc.query)
+		require.Equal(t, tc.want.IncludeRequeued, f.IncludeRequeued, tc.query)
+		for _, pair := range [][2]*time.Time{{tc.want.Since, f.Since}, {tc.want.Until, f.Until}} {
+			if pair[0] == nil {
+				require.Nil(t, pair[1], tc.query)
+			} else {
+				require.True(t, pair[0].Equal(*pair[1]), tc.query)
+			}
+		}
+	}
+}
+
+func TestBulkRequeueRequestFilter(t *testing.T) {
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	later := since.Add(time.Minute)
+	upload := int64(5)
+	cases := []struct {
+		name  string
+		req   bulkRequeueRequest
+		limit int
+		err   string
+	}{
+		{"no filter", bulkRequeueRequest{}, 0, "give at least one filter, or \"all\": true"},
+		{"only a limit", bulkRequeueRequest{Limit: 10}, 0, "give at least one filter, or \"all\": true"},
+		{"empty job ids", bulkRequeueRequest{JobIDs: []int64{}}, 0, "give at least one filter, or \"all\": true"},
+		{"all", bulkRequeueRequest{All: true}, 100, ""},
+		{"job ids", bulkRequeueRequest{JobIDs: []int64{1}}, 100, ""},
+		{"upload", bulkRequeueRequest{UploadID: &upload}, 100, ""},
+		{"type", bulkRequeueRequest{Type: "transcode", Limit: 1}, 1, ""},
+		{"error", bulkRequeueRequest{Error: "ffmpeg", Limit: 1000}, 1000, ""},
+		{"since", bulkRequeueRequest{Since: &since}, 100, ""},
+		{"until", bulkRequeueRequest{Until: &since}, 100, ""},
+		{"range", bulkRequeueRequest{Since: &since, Until: &later}, 100, ""},
+		{"limit too high", bulkRequeueRequest{All: true, Limit: 1001}, 0, "limit must be 1-1000"},
+		{"negative limit", bulkRequeueRequest{All: true, Limit: -1}, 0, "limit must be 1-1000"},
+		{"empty range", bulkRequeueRequest{Since: &since, Until: &since}, 0, "since must be before until"},
+		{"reversed range", bulkRequeueRequest{Since: &later, Until: &since, All: true}, 0, "since must be before until"},
+	}
+	for _, tc := range cases {
+		req := tc.req
+		f, err := req.filter()
+		if tc.err != "" {
+			var ae *apiError
+			require.ErrorAs(t, err, &ae, tc.name)
+			require.Equal(t, http.StatusBadRequest, ae.Status, tc.name)
+			require.Equal(t, tc.err, ae.Message, tc.name)
+			continue
+		}
+		require.NoError(t, err, tc.name)
+		require.Equal(t, tc.limit, req.Limit, tc.name)
+		require.Equal(t, tc.req.JobIDs, f.JobIDs, tc.name)
+		require.Equal(t, tc.req.UploadID, f.UploadID, tc.name)
+		require.Equal(t, tc.req.Since, f.Since, tc.name)
+		require.Equal(t, tc.req.Until, f.Until, tc.name)
+		require.False(t, f.IncludeRequeued, tc.name)
+	}
+}
+
+func TestListDeadLettersHandlerRejectsBadQueries(t *testing.T) {
+	// every case fails before the database is used
+	a := &API{}
+	for query, msg := range map[string]string{
+		"limit=0":    "limit must be 1-500",
+		"limit=501":  "limit must be 1-500",
+		"limit=ten":  "limit must be 1-500",
+		"before=x":   "invalid before",
+		"job_id=1.5": "invalid job_id",
+		"since=2026-01-02T00:00:00Z&until=2026-01-01T00:00:00Z": "since must be before until",
+	} {
+		w := httptest.NewRecorder()
+		a.ListDeadLettersHandler(w, httptest.NewRequest(http.MethodGet, "/api/dead-letters?"+query, nil))
+		require.Equal(t, http.StatusBadRequest, w.Code, query)
+		var body map[string]string
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body), query)
+		require.Equal(t, "invalid_request", body["error"], query)
+		require.Equal(t, msg, body["message"], query)
+	}
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/db"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// Values of the "dedupe" upload field, deciding what happens when an upload
+// with the same SHA-256 already exists.
+const (
+	// dedupeReuse links to the existing upload and, when it has finished
+	// with the same loudness target, primary profile and every requested
+	// output, reuses its results instead of queueing a job.
+	dedupeReuse = "reuse"
+	// dedupeLink records duplicate_of but always processes the file. The
+	// default.
+	dedupeLink = "link"
+	// dedupeOff skips the lookup.
+	dedupeOff = "off"
+)
+
+// resolveDedupe validates a dedupe mode; "" means dedupeLink, so skipping
+// the processing is opt-in.
+func resolveDedupe(mode string) (string, error) {
+	switch mode {
+	case "":
+		return dedupeLink, nil
+	case dedupeReuse, dedupeLink, dedupeOff:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown dedupe mode %q (reuse, link or off)", mode)
+}
+
+// uploadResult is what registerUpload created.
+type uploadResult struct {
+	UploadID    int64
+	JobID       int64 // 0 when results were reused
+	Path        string
+	DuplicateOf *int64
+	Reused      bool
+}
+
+// registerUpload records a validated, stored file. Depending on u.Dedupe it
+// first looks for an identical upload: the new row then links to the
+// oldest one, and a finished match whose results cover the request is
+// cloned instead of queueing a job, in which case the freshly stored copy
+// is removed.
+func (a *API) registerUpload(ctx context.Context, u newUpload) (*uploadResult, error) {
+	var src *db.UploadMatch
+	if u.SHA256 != "" && u.Dedupe != dedupeOff {
+		matches, err := a.DB.FindUploadsBySHA256(ctx, u.SHA256)
+		if err != nil {
+			return nil, fmt.Errorf("find duplicates: %w", err)
+		}
+		if len(matches) > 0 {
+			root := matches[0].ID
+			if matches[0].DuplicateOf != nil {
+				root = *matches[0].DuplicateOf
+			}
+			u.DuplicateOf = &root
+		}
+		if u.Dedupe == dedupeReuse {
+			for _, m := range matches {
+				if canReuse(m, u) {
+					src = m
+					break
+				}
+			}
+		}
+	}
+
+	if src == nil {
+		uploadID, jobID, err := a.createUploadWithJob(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+		return &uploadResult{UploadID: uploadID, JobID: jobID, Path: u.Path, DuplicateOf: u.DuplicateOf}, nil
+	}
+
+	uploadID, err := a.createReusedUpload(ctx, u, src)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.Storage.Delete(u.Path); err != nil {
+		log.Warn().Err(err).Str("path", u.Path).Msg("delete duplicate copy failed")
+	}
+	return &uploadResult{UploadID: uploadID, Path: src.Path, DuplicateOf: u.DuplicateOf, Reused: true}, nil
+}
+
+// canReuse reports whether m's finished results satisfy u. The primary
+// profile must match because the analysis stages measure its output.
+func canReuse(m *db.UploadMatch, u newUpload) bool {
+	if m.JobStatus != "done" || m.LoudnessTarget != u.LoudnessTarget {
+		return false
+	}
+	if len(m.Profiles) == 0 || len(u.Profiles) == 0 || m.Profiles[0] != u.Profiles[0] {
+		return false
+	}
+	for _, p := range u.Profiles {
+		if !slices.Contains(m.Outputs, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// createReusedUpload inserts a finished upload that shares src's stored
+// file and results, without a job.
+func (a *API) createReusedUpload(ctx context.Context, u newUpload, src *db.UploadMatch) (uploadID int64, err error) {
+	err = a.DB.WithTx(ctx, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx,
+			`INSERT INTO uploads (filename, path, content_type, size, profiles, loudness_target, sha256, duplicate_of, status)
+			 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,'done') RETURNING id`,
+			u.Filename, src.Path, u.ContentType, u.Size, u.Profiles, u.LoudnessTarget, u.SHA256, u.DuplicateOf,
+		).Scan(&uploadID); err != nil {
+			return fmt.Errorf("insert upload: %w", err)
+		}
+		if err := db.CloneUploadResults(ctx, tx, src.ID, uploadID, u.Profiles); err != nil {
+			return err
+		}
+		if u.TusID != "" {
+			if err := db.CompleteTusUpload(ctx, tx, u.TusID, uploadID); err != nil {
+				return fmt.Errorf("complete tus upload: %w", err)
+			}
+		}
+		return nil
+	})
+	return uploadID, err
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveDedupe(t *testing.T) {
+	for in, want := range map[string]string{
+		"":      dedupeLink,
+		"link":  dedupeLink,
+		"reuse": dedupeReuse,
+		"off":   dedupeOff,
+	} {
+		got, err := resolveDedupe(in)
+		require.NoError(t, err, in)
+		require.Equal(t, want, got, in)
+	}
+	for _, bad := range []string{"Reuse", "skip", " link"} {
+		_, err := resolveDedupe(bad)
+		require.Error(t, err, bad)
+	}
+}
+
+func TestCanReuse(t *testing.T) {
+	done := func() *db.UploadMatch {
+		return &db.UploadMatch{
+			ID:             1,
+			Profiles:       []string{"mp3-320", "opus-96"},
+			LoudnessTarget: "podcast",
+			JobStatus:      "done",
+			Outputs:        []string{"mp3-320", "opus-96", "flac-16"},
+		}
+	}
+	want := newUpload{Profiles: []string{"mp3-320", "flac-16"}, LoudnessTarget: "podcast"}
+
+	cases := []struct {
+		name string
+		edit func(m *db.UploadMatch, u *newUpload)
+		ok   bool
+	}{
+		{"same primary, outputs covered", func(*db.UploadMatch, *newUpload) {}, true},
+		{"only the primary", func(_ *db.UploadMatch, u *newUpload) { u.Profiles = []string{"mp3-320"} }, true},
+		{"job not done", func(m *db.UploadMatch, _ *newUpload) { m.JobStatus = "running" }, false},
+		{"failed job", func(m *db.UploadMatch, _ *newUpload) { m.JobStatus = "failed" }, false},
+		{"reused upload has no job", func(m *db.UploadMatch, _ *newUpload) { m.JobStatus = "" }, false},
+		{"other loudness target", func(_ *db.UploadMatch, u *newUpload) { u.LoudnessTarget = "" }, false},
+		{"other primary profile", func(_ *db.UploadMatch, u *newUpload) { u.Profiles = []string{"flac-16", "mp3-320"} }, false},
+		{"missing output", func(_ *db.UploadMatch, u *newUpload) { u.Profiles = append(u.Profiles, "wav-24") }, false},
+		{"match without profiles", func(m *db.UploadMatch, _ *newUpload) { m.Profiles = nil }, false},
+		{"request without profiles", func(_ *db.UploadMatch, u *newUpload) { u.Profiles = nil }, false},
+	}
+	for _, tc := range cases {
+		m, u := done(), want
+		u.Profiles = append([]string(nil), want.Profiles...)
+		tc.edit(m, &u)
+		require.Equal(t, tc.ok, canReuse(m, u), tc.name)
+	}
+}
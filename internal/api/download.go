@@ -0,0 +1,183 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// waveformOutput is the outputs/{name} alias for the rendered waveform PNG.
+const waveformOutput = "waveform"
+
+// GetUploadOriginalHandler streams the uploaded file as stored.
+func (a *API) GetUploadOriginalHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var filename, p string
+	var contentType, sha sql.NullString
+	if err := a.DB.Pool.QueryRow(r.Context(),
+		`SELECT filename, path, content_type, sha256 FROM uploads WHERE id=$1`, id,
+	).Scan(&filename, &p, &contentType, &sha); err != nil {
+		http.Error(w, "upload not found", http.StatusNotFound)
+		return
+	}
+	a.serveObject(w, r, servedObject{
+		Path:        p,
+		Filename:    filename,
+		ContentType: contentType.String,
+		ETag:        sha.String,
+	})
+}
+
+// GetUploadOutputHandler streams one output by profile name, or the waveform
+// image as "waveform".
+func (a *API) GetUploadOutputHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	name := chi.URLParam(r, "name")
+	var filename string
+	var wave sql.NullString
+	if err := a.DB.Pool.QueryRow(ctx, `SELECT filename, waveform_path FROM uploads WHERE id=$1`, id).Scan(&filename, &wave); err != nil {
+		http.Error(w, "upload not found", http.StatusNotFound)
+		return
+	}
+	stem := strings.TrimSuffix(filename, path.Ext(filename))
+
+	if name == waveformOutput {
+		if !wave.Valid {
+			http.Error(w, "waveform not rendered yet", http.StatusNotFound)
+			return
+		}
+		a.serveObject(w, r, servedObject{Path: wave.String, Filename: stem + "-waveform.png"})
+		return
+	}
+	o, err := a.DB.GetOutput(ctx, id, name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "output not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Int64("upload", id).Str("output", name).Msg("get output failed")
+		http.Error(w, "get output failed", http.StatusInternalServerError)
+		return
+	}
+	a.serveObject(w, r, servedObject{Path: o.Path, Filename: stem + "-" + o.Name + path.Ext(o.Path)})
+}
+
+// streamFileName matches the files PackageStreams writes.
+var streamFileName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// GetUploadStreamHandler serves the HLS/DASH package of an upload:
+// stream/master.m3u8, stream/manifest.mpd and the playlists and segments
+// they reference by relative URL.
+func (a *API) GetUploadStreamHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	file := chi.URLParam(r, "file")
+	if !streamFileName.MatchString(file) {
+		http.Error(w, "invalid file name", http.StatusBadRequest)
+		return
+	}
+	var p string
+	var packaged bool
+	if err := a.DB.Pool.QueryRow(r.Context(), `SELECT path, streaming IS NOT NULL FROM uploads WHERE id=$1`, id).Scan(&p, &packaged); err != nil {
+		http.Error(w, "upload not found", http.StatusNotFound)
+		return
+	}
+	if !packaged {
+		http.Error(w, "stream not packaged yet", http.StatusNotFound)
+		return
+	}
+	a.serveObject(w, r, servedObject{Path: storage.ArtifactPath(p, "stream/"+file)})
+}
+
+// servedObject describes a stored file handed to serveObject.
+type servedObject struct {
+	Path     string
+	Filename string // suggested download name; "" sends no Content-Disposition
+	// ContentType and ETag override the values derived from the path and
+	// the backend's object info.
+	ContentType string
+	ETag        string
+}
+
+// serveObject streams a stored object with http.ServeContent, which handles
+// Range, If-Range, If-None-Match and If-Modified-Since. Objects with a
+// Filename are served inline so audio elements can play and seek them;
+// ?download=1 asks for an attachment instead.
+func (a *API) serveObject(w http.ResponseWriter, r *http.Request, o servedObject) {
+	info, err := a.Storage.Stat(o.Path)
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidPath) {
+		http.Error(w, "file not found in storage", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("path", o.Path).Msg("stat object failed")
+		http.Error(w, "storage error", http.StatusInternalServerError)
+		return
+	}
+	f, err := a.Storage.Open(o.Path)
+	if err != nil {
+		log.Error().Err(err).Str("path", o.Path).Msg("open object failed")
+		http.Error(w, "storage error", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	h := w.Header()
+	ct := o.ContentType
+	if ct == "" {
+		ct = storage.ContentType(o.Path)
+	}
+	h.Set("Content-Type", ct)
+	etag := o.ETag
+	if etag == "" {
+		etag = info.ETag
+	}
+	if etag != "" {
+		h.Set("ETag", `"`+strings.Trim(etag, `"`)+`"`)
+	}
+	disposition := "inline"
+	if v, _ := strconv.ParseBool(r.URL.Query().Get("download")); v {
+		disposition = "attachment"
+	}
+	if o.Filename != "" {
+		if cd := mime.FormatMediaType(disposition, map[string]string{"filename": o.Filename}); cd != "" {
+			disposition = cd
+		}
+		h.Set("Content-Disposition", disposition)
+	}
+	// the server-wide write timeout would cut off large files; allow for a
+	// client reading no faster than minDownloadRate instead
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(downloadDeadline(info.Size)))
+	http.ServeContent(w, r, "", info.ModTime, f)
+}
+
+// minDownloadRate is the slowest client a download waits for, in bytes/s.
+const minDownloadRate = 64 << 10
+
+// downloadDeadline is how long sending size bytes may take.
+func downloadDeadline(size int64) time.Duration {
+	return 30*time.Second + time.Duration(size/minDownloadRate)*time.Second
+}
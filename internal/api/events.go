@@ -0,0 +1,248 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/db"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// EventHub fans job_events notifications out to the SSE streams of this API
+// process. Streams only use it as a wake-up and read the events themselves,
+// so a missed notification delays an event but never loses it.
+type EventHub struct {
+	db   *db.DB
+	mu   sync.Mutex
+	subs map[*eventSub]struct{}
+}
+
+type eventSub struct {
+	filter db.JobEventFilter
+	wake   chan struct{}
+}
+
+// NewEventHub creates a hub; call Run to start listening.
+func NewEventHub(database *db.DB) *EventHub {
+	return &EventHub{db: database, subs: map[*eventSub]struct{}{}}
+}
+
+// Run listens for job events until ctx is cancelled, reconnecting after
+// errors. Old events are purged by the "purge-job-events" schedule.
+func (h *EventHub) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		err := h.db.ListenJobEvents(ctx, h.publish)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warn().Err(err).Msg("job events listener stopped, reconnecting")
+		// anything notified meanwhile was missed; let every stream re-read
+		h.wakeAll()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (h *EventHub) subscribe(f db.JobEventFilter) (*eventSub, func()) {
+	s := &eventSub{filter: f, wake: make(chan struct{}, 1)}
+	h.mu.Lock()
+	h.subs[s] = struct{}{}
+	h.mu.Unlock()
+	return s, func() {
+		h.mu.Lock()
+		delete(h.subs, s)
+		h.mu.Unlock()
+	}
+}
+
+func (h *EventHub) publish(n db.JobEventNotice) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs {
+		f := s.filter
+		if (f.JobID != nil && *f.JobID == n.JobID) || (f.UploadID != nil && n.UploadID != nil && *f.UploadID == *n.UploadID) {
+			s.notify()
+		}
+	}
+}
+
+func (h *EventHub) wakeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs {
+		s.notify()
+	}
+}
+
+func (s *eventSub) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Streams without a hub (or with a broken listener) still poll this often;
+// the keep-alive comment stops proxies from timing the stream out.
+const (
+	eventPollInterval = 5 * time.Second
+	eventKeepAlive    = 15 * time.Second
+)
+
+// terminalJobStatuses end a job event stream.
+var terminalJobStatuses = map[string]bool{"done": true, "failed": true, "cancelled": true}
+
+// JobEventsHandler streams the status, progress and log events of one job
+// as Server-Sent Events. The stream ends with an "end" event once the job
+// is done, failed or cancelled.
+func (a *API) JobEventsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var status string
+	if err := a.DB.Pool.QueryRow(r.Context(), `SELECT status FROM jobs WHERE id=$1`, id).Scan(&status); err != nil {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	if !terminalJobStatuses[status] {
+		status = ""
+	}
+	a.streamJobEvents(w, r, db.JobEventFilter{JobID: &id}, true, status)
+}
+
+// UploadEventsHandler streams the events of every job of an upload. It stays
+// open until the client disconnects, so it also covers retried and requeued
+// jobs.
+func (a *API) UploadEventsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var exists bool
+	if err := a.DB.Pool.QueryRow(r.Context(), `SELECT EXISTS (SELECT 1 FROM uploads WHERE id=$1)`, id).Scan(&exists); err != nil || !exists {
+		http.Error(w, "upload not found", http.StatusNotFound)
+		return
+	}
+	a.streamJobEvents(w, r, db.JobEventFilter{UploadID: &id}, false, "")
+}
+
+// streamJobEvents writes the events matching f after the client's
+// Last-Event-ID (header, or ?last_event_id= for the first EventSource
+// request), then follows new ones. Without an id the full history is sent.
+// finished is the final status of a job that had already ended when the
+// request came in, so a client resuming past its last event gets the "end"
+// event right away.
+func (a *API) streamJobEvents(w http.ResponseWriter, r *http.Request, f db.JobEventFilter, endOnTerminal bool, finished string) {
+	ctx := r.Context()
+	lastID := int64(0)
+	last := r.Header.Get("Last-Event-ID")
+	if last == "" {
+		last = r.URL.Query().Get("last_event_id")
+	}
+	if last != "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		lastID = n
+	}
+
+	// the server's WriteTimeout would cut the stream
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	// subscribe before the first read so no notification slips in between
+	var wake <-chan struct{}
+	if a.Events != nil {
+		sub, unsubscribe := a.Events.subscribe(f)
+		defer unsubscribe()
+		wake = sub.wake
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	// tell EventSource how soon to reconnect after a dropped stream
+	fmt.Fprint(w, "retry: 2000\n\n")
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	poll := time.NewTicker(eventPollInterval)
+	defer poll.Stop()
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		for {
+			events, err := a.DB.ListJobEvents(ctx, f, lastID, 100)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Error().Err(err).Msg("list job events failed")
+				}
+				return
+			}
+			for _, e := range events {
+				if err := writeSSE(w, strconv.FormatInt(e.ID, 10), e.Kind, e); err != nil {
+					return
+				}
+				lastID = e.ID
+				if endOnTerminal && e.Kind == "status" && terminalJobStatuses[e.Status] {
+					_ = writeSSE(w, "", "end", map[string]string{"status": e.Status})
+					_ = rc.Flush()
+					return
+				}
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+			if len(events) < 100 {
+				break
+			}
+		}
+		if finished != "" {
+			_ = writeSSE(w, "", "end", map[string]string{"status": finished})
+			_ = rc.Flush()
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-poll.C:
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeSSE writes one event; data is JSON-encoded on a single line.
+func writeSSE(w http.ResponseWriter, id, event string, data any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+	return err
+}
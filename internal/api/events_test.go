@@ -0,0 +1,68 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventHubPublishMatchesFilter(t *testing.T) {
+	h := NewEventHub(nil)
+	job, upload := int64(7), int64(3)
+	jobSub, unsubJob := h.subscribe(db.JobEventFilter{JobID: &job})
+	uploadSub, unsubUpload := h.subscribe(db.JobEventFilter{UploadID: &upload})
+	defer unsubUpload()
+
+	woken := func(s *eventSub) bool {
+		select {
+		case <-s.wake:
+			return true
+		default:
+			return false
+		}
+	}
+	other := int64(4)
+	cases := []struct {
+		name              string
+		n                 db.JobEventNotice
+		jobHit, uploadHit bool
+	}{
+		{"same job and upload", db.JobEventNotice{JobID: 7, UploadID: &upload}, true, true},
+		{"other job of the upload", db.JobEventNotice{JobID: 9, UploadID: &upload}, false, true},
+		{"other upload", db.JobEventNotice{JobID: 9, UploadID: &other}, false, false},
+		{"job without upload", db.JobEventNotice{JobID: 7}, true, false},
+		{"nothing matches", db.JobEventNotice{JobID: 8}, false, false},
+	}
+	for _, tc := range cases {
+		h.publish(tc.n)
+		require.Equal(t, tc.jobHit, woken(jobSub), tc.name)
+		require.Equal(t, tc.uploadHit, woken(uploadSub), tc.name)
+	}
+
+	// wake-ups coalesce instead of blocking the listener
+	for i := 0; i < 5; i++ {
+		h.publish(db.JobEventNotice{JobID: 7})
+	}
+	require.True(t, woken(jobSub))
+	require.False(t, woken(jobSub))
+
+	h.wakeAll()
+	require.True(t, woken(jobSub))
+	require.True(t, woken(uploadSub))
+
+	unsubJob()
+	h.publish(db.JobEventNotice{JobID: 7})
+	require.False(t, woken(jobSub), "unsubscribed streams are not woken")
+}
+
+func TestWriteSSE(t *testing.T) {
+	w := httptest.NewRecorder()
+	require.NoError(t, writeSSE(w, "12", "status", map[string]any{"status": "running", "progress": 1}))
+	require.NoError(t, writeSSE(w, "", "end", map[string]string{"status": "done"}))
+	require.Equal(t,
+		"id: 12\nevent: status\ndata: {\"progress\":1,\"status\":\"running\"}\n\n"+
+			"event: end\ndata: {\"status\":\"done\"}\n\n",
+		w.Body.String())
+}
@@ -2,19 +2,67 @@ package api
 
 // "context"
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"sort"
 	"strconv"
 
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/audio"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/db"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/queue"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/pkg/utils"
 	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
 	"github.com/rs/zerolog/log"
 )
 
 func (a *API) RegisterJobRoutes(r chi.Router) {
 	r.Get("/jobs", a.ListJobsHandler)
 	r.Get("/jobs/{id}", a.GetJobHandler)
+	r.Get("/jobs/{id}/events", a.JobEventsHandler)
 	r.Patch("/jobs/{id}", a.UpdateJobHandler) // e.g., update status/progress
+	r.Post("/jobs/{id}/cancel", a.CancelJobHandler)
+	r.Post("/jobs/{id}/requeue", a.RequeueJobHandler)
+	r.Get("/dead-letters", a.ListDeadLettersHandler)
+	r.Post("/dead-letters/requeue", a.BulkRequeueHandler)
 	r.Get("/uploads/{id}", a.GetUploadHandler)
+	r.Get("/uploads/{id}/events", a.UploadEventsHandler)
+	r.Post("/uploads/{id}/reprocess", a.ReprocessUploadHandler)
+	r.Get("/uploads/{id}/loudness", a.GetUploadLoudnessHandler)
+	r.Get("/uploads/{id}/peaks", a.GetUploadPeaksHandler)
+	r.Get("/uploads/{id}/original", a.GetUploadOriginalHandler)
+	r.Get("/uploads/{id}/outputs/{name}", a.GetUploadOutputHandler)
+	r.Get("/uploads/{id}/stream/{file}", a.GetUploadStreamHandler)
+	r.Post("/uploads/{id}/share", a.CreateShareHandler)
+	r.Get("/profiles", a.ListProfilesHandler)
+	r.Get("/schedules", a.ListSchedulesHandler)
+	r.Patch("/schedules/{name}", a.UpdateScheduleHandler)
+	r.Post("/webhooks", a.CreateWebhookHandler)
+	r.Get("/webhooks", a.ListWebhooksHandler)
+	r.Get("/webhooks/{id}", a.GetWebhookHandler)
+	r.Delete("/webhooks/{id}", a.DeleteWebhookHandler)
+	r.Get("/webhooks/{id}/deliveries", a.ListWebhookDeliveriesHandler)
+	r.Get("/webhooks/{id}/deliveries/{delivery}", a.GetWebhookDeliveryHandler)
+}
+
+// ListProfilesHandler lists the output profiles and loudness targets accepted by uploads.
+func (a *API) ListProfilesHandler(w http.ResponseWriter, r *http.Request) {
+	profiles := make([]audio.Profile, 0, len(audio.Profiles))
+	for _, name := range audio.ProfileNames() {
+		profiles = append(profiles, audio.Profiles[name])
+	}
+	targets := make([]audio.LoudnessTarget, 0, len(audio.LoudnessTargets))
+	for _, t := range audio.LoudnessTargets {
+		targets = append(targets, t)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Name < targets[j].Name })
+	writeJSON(w, map[string]interface{}{
+		"default":          audio.DefaultProfile,
+		"profiles":         profiles,
+		"loudness_targets": targets,
+	})
 }
 
 func (a *API) ListJobsHandler(w http.ResponseWriter, r *http.Request) {
@@ -43,7 +91,19 @@ func (a *API) GetJobHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "job not found", http.StatusNotFound)
 		return
 	}
-	writeJSON(w, j)
+	steps, err := a.DB.ListJobSteps(ctx, id)
+	if err != nil {
+		log.Error().Err(err).Int64("job", id).Msg("list job steps failed")
+		http.Error(w, "list job steps failed", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, jobResponse{JobModel: j, Steps: steps})
+}
+
+// jobResponse is a job plus its per-stage breakdown.
+type jobResponse struct {
+	*db.JobModel
+	Steps []*db.JobStep `json:"steps"`
 }
 
 type updateJobReq struct {
@@ -80,6 +140,47 @@ func (a *API) UpdateJobHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+type cancelJobResponse struct {
+	JobID  int64  `json:"job_id"`
+	Status string `json:"status"` // "cancelled", or "cancelling" while a worker stops it
+}
+
+// CancelJobHandler stops a job. A queued job is cancelled at once. A running
+// one becomes "cancelling" and the cancel is broadcast to the workers; the
+// one running it kills its ffmpeg processes, removes partial outputs and
+// marks the job "cancelled".
+func (a *API) CancelJobHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "invalid id"})
+		return
+	}
+	status, err := a.DB.RequestJobCancel(r.Context(), id)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		writeError(w, &apiError{Status: http.StatusNotFound, Code: "not_found", Message: "job not found"})
+		return
+	case errors.Is(err, db.ErrJobFinished):
+		writeError(w, &apiError{Status: http.StatusConflict, Code: "job_finished", Message: "job is already " + status})
+		return
+	case err != nil:
+		writeError(w, err)
+		return
+	}
+	if status == "cancelling" {
+		// if the broadcast is lost the worker still notices when it settles
+		// the job, it just cannot stop early
+		if a.Queue == nil {
+			log.Warn().Int64("job", id).Msg("no queue connection, cancel not broadcast")
+		} else if err := a.Queue.Broadcast(queue.CancelSubject, queue.CancelMessage{JobID: id}); err != nil {
+			log.Error().Err(err).Int64("job", id).Msg("broadcast cancel failed")
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	writeJSON(w, cancelJobResponse{JobID: id, Status: status})
+}
+
 func (a *API) GetUploadHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	idStr := chi.URLParam(r, "id")
@@ -88,23 +189,40 @@ func (a *API) GetUploadHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid id", http.StatusBadRequest)
 		return
 	}
-	row := a.DB.Pool.QueryRow(ctx, `SELECT id, filename, path, content_type, size, status, created_at FROM uploads WHERE id=$1`, id)
+	row := a.DB.Pool.QueryRow(ctx, `SELECT id, filename, path, content_type, size, status, created_at, profiles, loudness_target, sha256, duplicate_of, streaming FROM uploads WHERE id=$1`, id)
 	var idOut int64
 	var filename, path, contentType, status string
 	var size int64
 	var createdAt string
-	if err := row.Scan(&idOut, &filename, &path, &contentType, &size, &status, &createdAt); err != nil {
+	var profiles []string
+	var loudnessTarget string
+	var sha sql.NullString
+	var duplicateOf sql.NullInt64
+	var streaming json.RawMessage
+	if err := row.Scan(&idOut, &filename, &path, &contentType, &size, &status, &createdAt, &profiles, &loudnessTarget, &sha, &duplicateOf, &streaming); err != nil {
 		http.Error(w, "upload not found", http.StatusNotFound)
 		return
 	}
+	outputs, err := a.DB.ListOutputs(ctx, id)
+	if err != nil {
+		log.Error().Err(err).Int64("upload", id).Msg("list outputs failed")
+		http.Error(w, "list outputs failed", http.StatusInternalServerError)
+		return
+	}
 	resp := map[string]interface{}{
-		"id":           idOut,
-		"filename":     filename,
-		"path":         path,
-		"content_type": contentType,
-		"size":         size,
-		"status":       status,
-		"created_at":   createdAt,
+		"id":              idOut,
+		"filename":        filename,
+		"path":            path,
+		"content_type":    contentType,
+		"size":            size,
+		"status":          status,
+		"created_at":      createdAt,
+		"profiles":        profiles,
+		"loudness_target": loudnessTarget,
+		"sha256":          utils.NilIfNullString(sha),
+		"duplicate_of":    utils.NilIfNullInt(duplicateOf),
+		"streaming":       streaming,
+		"outputs":         outputs,
 	}
 	writeJSON(w, resp)
 }
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/db"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/metrics"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/queue"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// cancelCleanupLease is how long the reaper holds a cancelling job while it
+// cleans up after the job's lost worker; if it dies meanwhile, the job is
+// reaped again after that.
+const cancelCleanupLease = 5 * time.Minute
+
+// ReapExpiredJobLeases takes running jobs away from workers that stopped
+// renewing their lease (see db.ReapExpiredLeases): requeued jobs are
+// published again and jobs out of retries are dead-lettered, in the same
+// transaction. Jobs that were being cancelled are then finished the way
+// their worker would have, see finishReapedCancel. It returns how many jobs
+// were reaped.
+func (a *API) ReapExpiredJobLeases(ctx context.Context) (int, error) {
+	var reaped []db.ReapedJob
+	err := a.DB.WithTx(ctx, func(tx pgx.Tx) error {
+		var err error
+		if reaped, err = db.ReapExpiredLeases(ctx, tx, 100, cancelCleanupLease); err != nil {
+			return err
+		}
+		for _, j := range reaped {
+			switch j.Status {
+			case "queued":
+				err = publishJob(ctx, tx, j.JobRef)
+			case "failed":
+				_, err = db.RecordDeadLetter(ctx, tx, j.ID, j.Worker, queue.DeadLetterSubject)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, j := range reaped {
+		log.Warn().Int64("job", j.ID).Str("worker", j.Worker).Str("status", j.Status).Msg("job lease expired")
+		status := j.Status
+		switch status {
+		case "failed":
+			metrics.DeadLetters.Inc()
+		case "cancelling":
+			a.finishReapedCancel(ctx, j)
+			status = "cancelled"
+		}
+		metrics.LeasesExpired.WithLabelValues(status).Inc()
+	}
+	if len(reaped) > 0 && a.Outbox != nil {
+		a.Outbox.Notify()
+	}
+	return len(reaped), nil
+}
+
+// finishReapedCancel does for a cancelling job whose worker was lost what
+// the worker would have done: remove what the job produced (CancelCleanup)
+// and mark it cancelled. A failed cleanup is noted in the job's log.
+func (a *API) finishReapedCancel(ctx context.Context, j db.ReapedJob) {
+	msg := "job cancelled"
+	if a.CancelCleanup != nil {
+		jm := queue.JobMessage{JobID: j.ID, UploadID: j.UploadID, Type: j.Type, Priority: j.Priority}
+		if err := a.CancelCleanup(ctx, jm); err != nil {
+			log.Error().Err(err).Int64("job", j.ID).Msg("cancel cleanup failed")
+			msg += "; cleanup failed: " + err.Error()
+		}
+	}
+	// the reaper left the job unowned
+	if err := a.DB.FinishCancelledJob(ctx, j.ID, "", msg); err != nil {
+		log.Error().Err(err).Int64("job", j.ID).Msg("mark job cancelled failed")
+	}
+}
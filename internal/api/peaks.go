@@ -0,0 +1,114 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/audio"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/db"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// defaultPeaksZoom is served when the client does not ask for a zoom.
+const defaultPeaksZoom = 512
+
+// GetUploadPeaksHandler serves waveform peaks in audiowaveform format.
+// Query: zoom (samples per pixel; a stored level or a multiple of one),
+// bits (8 or 16, default 8) and format (json, default, or dat).
+func (a *API) GetUploadPeaksHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	bits := 8
+	if v := q.Get("bits"); v != "" {
+		if bits, err = strconv.Atoi(v); err != nil || (bits != 8 && bits != 16) {
+			http.Error(w, "bits must be 8 or 16", http.StatusBadRequest)
+			return
+		}
+	}
+	format := q.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "dat" {
+		http.Error(w, "format must be json or dat", http.StatusBadRequest)
+		return
+	}
+
+	levels, err := a.DB.ListWaveformPeaks(ctx, id)
+	if err != nil {
+		log.Error().Err(err).Int64("upload", id).Msg("list peaks failed")
+		http.Error(w, "list peaks failed", http.StatusInternalServerError)
+		return
+	}
+	if len(levels) == 0 {
+		http.Error(w, "peaks not available", http.StatusNotFound)
+		return
+	}
+	zoom := defaultPeaksZoom
+	if v := q.Get("zoom"); v != "" {
+		if zoom, err = strconv.Atoi(v); err != nil || zoom <= 0 {
+			http.Error(w, "invalid zoom", http.StatusBadRequest)
+			return
+		}
+	} else if pickPeaksLevel(levels, zoom) == nil {
+		zoom = levels[0].SamplesPerPixel
+	}
+	level := pickPeaksLevel(levels, zoom)
+	if level == nil {
+		available := make([]int, len(levels))
+		for i, l := range levels {
+			available[i] = l.SamplesPerPixel
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, map[string]interface{}{
+			"error":     "zoom must be a stored level or a multiple of one",
+			"available": available,
+		})
+		return
+	}
+
+	f, err := a.Storage.Open(level.Path)
+	if err != nil {
+		log.Error().Err(err).Str("path", level.Path).Msg("open peaks failed")
+		http.Error(w, "peaks file unavailable", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	peaks, err := audio.ReadPeaks(f)
+	if err == nil {
+		peaks, err = peaks.Zoom(zoom)
+	}
+	if err == nil {
+		peaks, err = peaks.WithBits(bits)
+	}
+	if err != nil {
+		log.Error().Err(err).Str("path", level.Path).Msg("decode peaks failed")
+		http.Error(w, "peaks file corrupt", http.StatusInternalServerError)
+		return
+	}
+
+	if format == "dat" {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_ = peaks.WriteBinary(w)
+		return
+	}
+	writeJSON(w, peaks)
+}
+
+// pickPeaksLevel returns the coarsest stored level zoom can be derived from.
+func pickPeaksLevel(levels []*db.WaveformPeaks, zoom int) *db.WaveformPeaks {
+	var best *db.WaveformPeaks
+	for _, l := range levels {
+		if zoom%l.SamplesPerPixel == 0 && (best == nil || l.SamplesPerPixel > best.SamplesPerPixel) {
+			best = l
+		}
+	}
+	return best
+}
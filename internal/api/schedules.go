@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/queue"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/scheduler"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// MaintenanceSchedules are the API's periodic clean-ups, for the scheduler
+// to run once per interval across all replicas.
+func (a *API) MaintenanceSchedules() []scheduler.Schedule {
+	schedules := []scheduler.Schedule{
+		// a dead worker's jobs go back to the queue within a minute or so
+		{Name: "reap-expired-leases", Every: 30 * time.Second, Run: func(ctx context.Context) error {
+			_, err := a.ReapExpiredJobLeases(ctx)
+			return err
+		}},
+		{Name: "reap-tus-uploads", Every: 10 * time.Minute, Run: func(ctx context.Context) error {
+			n, err := a.ReapExpiredTusUploads(ctx)
+			if n > 0 {
+				log.Info().Int("count", n).Msg("reaped expired tus uploads")
+			}
+			return err
+		}},
+		{Name: "purge-job-events", Every: time.Hour, Run: func(ctx context.Context) error {
+			n, err := a.DB.PurgeJobEvents(ctx, 7*24*time.Hour)
+			if n > 0 {
+				log.Info().Int64("count", n).Msg("purged job events")
+			}
+			return err
+		}},
+	}
+	if a.Share.Keys != nil {
+		schedules = append(schedules, scheduler.Schedule{Name: "purge-signed-url-nonces", Every: time.Hour, Run: func(ctx context.Context) error {
+			n, err := a.DB.PurgeExpiredNonces(ctx)
+			if n > 0 {
+				log.Info().Int64("count", n).Msg("purged expired nonces")
+			}
+			return err
+		}})
+	}
+	return schedules
+}
+
+type reprocessRequest struct {
+	// RunAt (RFC 3339) delays the job; omitted or past, it is queued now.
+	RunAt    string `json:"run_at,omitempty"`
+	Priority string `json:"priority,omitempty"`
+}
+
+type reprocessResponse struct {
+	JobID  int64      `json:"job_id"`
+	Status string     `json:"status"`
+	RunAt  *time.Time `json:"run_at,omitempty"`
+}
+
+// ReprocessUploadHandler queues a new job that runs the whole pipeline again
+// on an upload, e.g. after an analyzer upgrade, now or at run_at. It refuses
+// while another job of the upload has not finished.
+func (a *API) ReprocessUploadHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "invalid id"})
+		return
+	}
+	var req reprocessRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+			writeError(w, &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "invalid JSON body"})
+			return
+		}
+	}
+	priority, err := queue.ParsePriority(req.Priority)
+	if err != nil {
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: err.Error()})
+		return
+	}
+	runAt, err := parseRunAt(req.RunAt)
+	if err != nil {
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: err.Error()})
+		return
+	}
+
+	errActive := &apiError{Status: http.StatusConflict, Code: "job_active", Message: "the upload already has an unfinished job"}
+	var jobID int64
+	err = a.DB.WithTx(ctx, func(tx pgx.Tx) error {
+		// lock the upload so concurrent requests cannot both pass the check
+		var active bool
+		if err := tx.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM jobs WHERE upload_id = u.id
+			   AND status IN ('scheduled', 'queued', 'running', 'processing', 'cancelling'))
+			 FROM uploads u WHERE u.id=$1 FOR UPDATE`, id).Scan(&active); err != nil {
+			return err
+		}
+		if active {
+			return errActive
+		}
+		jobID, err = insertJob(ctx, tx, id, priority, runAt)
+		return err
+	})
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		writeError(w, &apiError{Status: http.StatusNotFound, Code: "not_found", Message: "upload not found"})
+		return
+	case err != nil:
+		writeError(w, err)
+		return
+	}
+	resp := reprocessResponse{JobID: jobID, Status: "queued"}
+	if runAt != nil {
+		resp.Status, resp.RunAt = "scheduled", runAt
+	} else if a.Outbox != nil {
+		a.Outbox.Notify()
+	}
+	w.Header().Set("Location", "/api/jobs/"+strconv.FormatInt(jobID, 10))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	writeJSON(w, resp)
+}
+
+// ListSchedulesHandler lists the recurring schedules with their last run.
+func (a *API) ListSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	schedules, err := a.DB.ListJobSchedules(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, schedules)
+}
+
+type updateScheduleRequest struct {
+	Every   string `json:"every,omitempty"` // Go duration, at least 1s
+	Enabled *bool  `json:"enabled,omitempty"`
+}
+
+// UpdateScheduleHandler changes a schedule's interval or pauses it.
+func (a *API) UpdateScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	var req updateScheduleRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "invalid JSON body"})
+		return
+	}
+	var every *time.Duration
+	if req.Every != "" {
+		d, err := time.ParseDuration(req.Every)
+		if err != nil || d < time.Second {
+			writeError(w, &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "every must be a duration of at least 1s, e.g. 30m"})
+			return
+		}
+		every = &d
+	}
+	s, err := a.DB.UpdateJobSchedule(r.Context(), chi.URLParam(r, "name"), every, req.Enabled)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, &apiError{Status: http.StatusNotFound, Code: "not_found", Message: "schedule not found"})
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, s)
+}
@@ -0,0 +1,277 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/signing"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// ShareConfig tunes signed download URLs.
+type ShareConfig struct {
+	// Keys signs and verifies URLs; sharing is disabled when nil.
+	Keys *signing.Keyring
+	// BaseURL is the public scheme://host minted URLs start with; by default
+	// it is derived from the minting request. The signed path must reach
+	// the server unchanged, so it cannot carry a prefix a proxy strips.
+	BaseURL    string
+	DefaultTTL time.Duration // default 1h
+	MaxTTL     time.Duration // default 7 days
+}
+
+func (c ShareConfig) withDefaults() ShareConfig {
+	if c.DefaultTTL <= 0 {
+		c.DefaultTTL = time.Hour
+	}
+	if c.MaxTTL <= 0 {
+		c.MaxTTL = 7 * 24 * time.Hour
+	}
+	if c.DefaultTTL > c.MaxTTL {
+		c.DefaultTTL = c.MaxTTL
+	}
+	return c
+}
+
+// sharedPrefix is where signed downloads are mounted.
+const sharedPrefix = "/shared"
+
+// RegisterShareRoutes mounts the signed download routes. They serve the same
+// artifacts as /uploads/{id}/original and /uploads/{id}/outputs/{name} but
+// need a valid signature instead of API access.
+func (a *API) RegisterShareRoutes(r chi.Router) {
+	r.Route(sharedPrefix, func(r chi.Router) {
+		r.Use(a.requireSignedURL)
+		r.Get("/uploads/{id}/original", a.GetUploadOriginalHandler)
+		r.Get("/uploads/{id}/outputs/{name}", a.GetUploadOutputHandler)
+	})
+}
+
+// requireSignedURL rejects requests whose URL signature is missing, invalid
+// or expired, and single-use URLs that were already used. The first use of a
+// single-use URL sets a cookie scoped to its path; Range requests carrying
+// it may continue that download (players seek) until the link expires. A
+// first use that fails does not count.
+func (a *API) requireSignedURL(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys := a.Share.Keys
+		if keys == nil {
+			http.NotFound(w, r)
+			return
+		}
+		v, err := keys.Verify(r.URL, time.Now())
+		switch {
+		case errors.Is(err, signing.ErrExpired):
+			writeError(w, &apiError{Status: http.StatusGone, Code: "expired", Message: "link expired"})
+			return
+		case err != nil:
+			writeError(w, &apiError{Status: http.StatusForbidden, Code: "invalid_signature", Message: err.Error()})
+			return
+		}
+		if v.Nonce == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cookieName := continuationCookie + v.Nonce
+		if c, err := r.Cookie(cookieName); err == nil && r.Header.Get("Range") != "" {
+			ok, err := a.DB.ContinueNonce(r.Context(), v.Nonce, c.Value)
+			if err != nil {
+				log.Error().Err(err).Msg("check nonce continuation failed")
+				http.Error(w, "claim nonce failed", http.StatusInternalServerError)
+				return
+			}
+			if ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		token, err := signing.NewNonce()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		ok, err := a.DB.ClaimNonce(r.Context(), v.Nonce, token, v.Expires)
+		if err != nil {
+			log.Error().Err(err).Msg("claim nonce failed")
+			http.Error(w, "claim nonce failed", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			writeError(w, &apiError{Status: http.StatusGone, Code: "already_used", Message: "single-use link was already used"})
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     cookieName,
+			Value:    token,
+			Path:     r.URL.Path,
+			Expires:  v.Expires,
+			HttpOnly: true,
+			Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+			SameSite: http.SameSiteLaxMode,
+		})
+		rec := &serveRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		if rec.status >= 400 || rec.err != nil {
+			// the link was not delivered; let the client try again
+			if err := a.DB.ReleaseNonce(context.WithoutCancel(r.Context()), v.Nonce); err != nil {
+				log.Warn().Err(err).Msg("release nonce failed")
+			}
+		}
+	})
+}
+
+// continuationCookie prefixes the name of the cookie (suffixed with the
+// link's nonce) that lets the first client of a single-use link continue.
+const continuationCookie = "share_"
+
+// serveRecorder notes the status and any write error of a response.
+type serveRecorder struct {
+	http.ResponseWriter
+	status int
+	err    error
+}
+
+func (s *serveRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *serveRecorder) Write(p []byte) (int, error) {
+	n, err := s.ResponseWriter.Write(p)
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the connection.
+func (s *serveRecorder) Unwrap() http.ResponseWriter { return s.ResponseWriter }
+
+type shareRequest struct {
+	// Artifact is "original", "outputs/<profile>" or "outputs/waveform".
+	Artifact  string `json:"artifact"`
+	TTL       string `json:"ttl,omitempty"` // Go duration, e.g. "15m"
+	SingleUse bool   `json:"single_use,omitempty"`
+	// Download makes the link serve Content-Disposition: attachment.
+	Download bool `json:"download,omitempty"`
+}
+
+type shareResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+	SingleUse bool      `json:"single_use"`
+	KeyID     string    `json:"kid"`
+}
+
+// CreateShareHandler mints a signed, expiring URL for one artifact of an
+// upload.
+func (a *API) CreateShareHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	cfg := a.Share.withDefaults()
+	if cfg.Keys == nil {
+		writeError(w, &apiError{Status: http.StatusServiceUnavailable, Code: "sharing_disabled", Message: "no signing keys configured"})
+		return
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "invalid id"})
+		return
+	}
+	var req shareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "bad body: " + err.Error()})
+		return
+	}
+	ttl := cfg.DefaultTTL
+	if req.TTL != "" {
+		if ttl, err = time.ParseDuration(req.TTL); err != nil || ttl <= 0 {
+			writeError(w, &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "ttl must be a positive duration"})
+			return
+		}
+		if ttl > cfg.MaxTTL {
+			writeError(w, &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "ttl exceeds " + cfg.MaxTTL.String()})
+			return
+		}
+	}
+
+	if err := a.checkArtifact(ctx, id, req.Artifact); err != nil {
+		writeError(w, err)
+		return
+	}
+	u, err := url.Parse(shareBaseURL(r, cfg.BaseURL))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	u = u.JoinPath(sharedPrefix, "uploads", strconv.FormatInt(id, 10), req.Artifact)
+	if req.Download {
+		u.RawQuery = url.Values{"download": {"1"}}.Encode()
+	}
+	var nonce string
+	if req.SingleUse {
+		if nonce, err = signing.NewNonce(); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	cfg.Keys.Sign(u, expires, nonce)
+	writeJSON(w, shareResponse{URL: u.String(), ExpiresAt: expires.UTC(), SingleUse: req.SingleUse, KeyID: cfg.Keys.ActiveKeyID()})
+}
+
+// checkArtifact verifies that the upload has the named artifact.
+func (a *API) checkArtifact(ctx context.Context, id int64, artifact string) error {
+	notFound := &apiError{Status: http.StatusNotFound, Code: "not_found", Message: "no artifact " + strconv.Quote(artifact) + " for upload"}
+	var wave *string
+	if err := a.DB.Pool.QueryRow(ctx, `SELECT waveform_path FROM uploads WHERE id=$1`, id).Scan(&wave); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return &apiError{Status: http.StatusNotFound, Code: "not_found", Message: "upload not found"}
+		}
+		return err
+	}
+	if artifact == "original" {
+		return nil
+	}
+	name, ok := strings.CutPrefix(artifact, "outputs/")
+	if !ok || name == "" || strings.Contains(name, "/") {
+		return &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: `artifact must be "original" or "outputs/<name>"`}
+	}
+	if name == waveformOutput {
+		if wave == nil {
+			return notFound
+		}
+		return nil
+	}
+	if _, err := a.DB.GetOutput(ctx, id, name); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return notFound
+		}
+		return err
+	}
+	return nil
+}
+
+// shareBaseURL is the configured public base URL, or the scheme and host the
+// request came in on.
+func shareBaseURL(r *http.Request, base string) string {
+	if base != "" {
+		return base
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if p := r.Header.Get("X-Forwarded-Proto"); p == "http" || p == "https" {
+		scheme = p
+	}
+	return scheme + "://" + r.Host
+}
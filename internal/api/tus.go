@@ -0,0 +1,513 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/db"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/queue"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// tus protocol 1.0.0 (https://tus.io/protocols/resumable-upload) with the
+// creation, expiration and termination extensions.
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,expiration,termination"
+	tusChunkType  = "application/offset+octet-stream"
+)
+
+// TusConfig tunes the resumable upload endpoints.
+type TusConfig struct {
+	MaxSize int64 // largest accepted Upload-Length; default 4 GiB
+	// Expiry is how long an unfinished upload survives after its last
+	// PATCH; default 24h.
+	Expiry time.Duration
+	// ChunkTimeout bounds handling one PATCH, overriding the server's read
+	// and write timeouts; default 15m.
+	ChunkTimeout time.Duration
+}
+
+func (c TusConfig) withDefaults() TusConfig {
+	if c.MaxSize <= 0 {
+		c.MaxSize = 4 << 30
+	}
+	if c.Expiry <= 0 {
+		c.Expiry = 24 * time.Hour
+	}
+	if c.ChunkTimeout <= 0 {
+		c.ChunkTimeout = 15 * time.Minute
+	}
+	return c
+}
+
+// RegisterTusRoutes mounts the tus endpoints on /files.
+func (a *API) RegisterTusRoutes(r chi.Router) {
+	r.Route("/files", func(r chi.Router) {
+		r.Options("/", a.TusOptionsHandler)
+		r.Post("/", a.TusCreateHandler)
+		r.Options("/{id}", a.TusOptionsHandler)
+		r.Head("/{id}", a.TusHeadHandler)
+		r.Patch("/{id}", a.TusPatchHandler)
+		r.Delete("/{id}", a.TusDeleteHandler)
+	})
+}
+
+// TusOptionsHandler advertises the supported protocol version and extensions.
+func (a *API) TusOptionsHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := a.Tus.withDefaults()
+	h := w.Header()
+	h.Set("Tus-Resumable", tusVersion)
+	h.Set("Tus-Version", tusVersion)
+	h.Set("Tus-Extension", tusExtensions)
+	h.Set("Tus-Max-Size", strconv.FormatInt(cfg.MaxSize, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tusPreamble sets the common response header and rejects requests for an
+// unsupported protocol version.
+func tusPreamble(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		http.Error(w, "unsupported Tus-Resumable version", http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// TusCreateHandler creates an upload from Upload-Length and Upload-Metadata.
+// Recognised metadata keys: filename, filetype, profiles (comma separated),
+// loudness_target, dedupe, priority and run_at, validated as for POST /upload.
+func (a *API) TusCreateHandler(w http.ResponseWriter, r *http.Request) {
+	if !tusPreamble(w, r) {
+		return
+	}
+	cfg := a.Tus.withDefaults()
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		http.Error(w, "Upload-Length is required (Upload-Defer-Length is not supported)", http.StatusBadRequest)
+		return
+	}
+	if length > cfg.MaxSize {
+		http.Error(w, "upload exceeds Tus-Max-Size", http.StatusRequestEntityTooLarge)
+		return
+	}
+	raw := r.Header.Get("Upload-Metadata")
+	meta, err := parseTusMetadata(raw)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := resolveProfiles([]string{meta["profiles"]}); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := resolveLoudnessTarget(meta["loudness_target"]); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := resolveDedupe(meta["dedupe"]); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := queue.ParsePriority(meta["priority"]); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := parseRunAt(meta["run_at"]); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, err := newTusID()
+	if err != nil {
+		http.Error(w, "id generation failed", http.StatusInternalServerError)
+		return
+	}
+	u := &db.TusUpload{
+		ID:          id,
+		Length:      length,
+		Metadata:    meta,
+		RawMetadata: raw,
+		ExpiresAt:   time.Now().Add(cfg.Expiry),
+	}
+	if err := a.DB.CreateTusUpload(r.Context(), u); err != nil {
+		log.Error().Err(err).Msg("create tus upload failed")
+		http.Error(w, "create upload failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Location", path.Join(r.URL.Path, id))
+	w.Header().Set("Upload-Expires", u.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// TusHeadHandler reports the current offset so clients can resume.
+func (a *API) TusHeadHandler(w http.ResponseWriter, r *http.Request) {
+	if !tusPreamble(w, r) {
+		return
+	}
+	u, ok := a.loadTusUpload(w, r)
+	if !ok {
+		return
+	}
+	h := w.Header()
+	h.Set("Cache-Control", "no-store")
+	h.Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	h.Set("Upload-Length", strconv.FormatInt(u.Length, 10))
+	h.Set("Upload-Expires", u.ExpiresAt.UTC().Format(http.TimeFormat))
+	if u.RawMetadata != "" {
+		h.Set("Upload-Metadata", u.RawMetadata)
+	}
+	if u.UploadID != nil {
+		h.Set("X-Upload-ID", strconv.FormatInt(*u.UploadID, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// TusPatchHandler stores the request body as the next chunk. The chunk that
+// completes the upload assembles the file, creates the upload row and queues
+// its job; a PATCH at the final offset retries that step if it failed.
+func (a *API) TusPatchHandler(w http.ResponseWriter, r *http.Request) {
+	if !tusPreamble(w, r) {
+		return
+	}
+	if r.Header.Get("Content-Type") != tusChunkType {
+		http.Error(w, "Content-Type must be "+tusChunkType, http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "Upload-Offset is required", http.StatusBadRequest)
+		return
+	}
+	u, ok := a.loadTusUpload(w, r)
+	if !ok {
+		return
+	}
+	if offset != u.Offset {
+		http.Error(w, "Upload-Offset does not match the current offset", http.StatusConflict)
+		return
+	}
+	if u.UploadID != nil {
+		a.tusDone(w, u, *u.UploadID)
+		return
+	}
+	ctx := r.Context()
+	cfg := a.Tus.withDefaults()
+
+	remaining := u.Length - u.Offset
+	if r.ContentLength > remaining {
+		http.Error(w, "chunk exceeds Upload-Length", http.StatusRequestEntityTooLarge)
+		return
+	}
+	// a chunk, and assembling the file after the last one, can take longer
+	// than the server-wide read and write timeouts
+	deadline := time.Now().Add(cfg.ChunkTimeout)
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(deadline)
+	_ = rc.SetWriteDeadline(deadline)
+	if remaining > 0 {
+		// read one byte past the limit so oversized bodies are detected
+		body := io.LimitReader(r.Body, remaining+1)
+		chunk, err := tusChunkPath(u.ID, u.Offset)
+		if err != nil {
+			http.Error(w, "chunk name generation failed", http.StatusInternalServerError)
+			return
+		}
+		saved, err := a.Storage.Save(body, chunk)
+		if err != nil {
+			_ = a.Storage.Delete(chunk)
+			log.Warn().Err(err).Str("tus", u.ID).Msg("tus chunk save failed")
+			http.Error(w, "failed to store chunk: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n := saved.Size
+		if n > remaining {
+			_ = a.Storage.Delete(chunk)
+			http.Error(w, "chunk exceeds Upload-Length", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if n > 0 {
+			ok, err := a.DB.AppendTusChunk(ctx, u.ID, u.Offset, n, chunk, time.Now().Add(cfg.Expiry))
+			if err != nil || !ok {
+				_ = a.Storage.Delete(chunk)
+				if err != nil {
+					log.Error().Err(err).Str("tus", u.ID).Msg("tus offset update failed")
+					http.Error(w, "offset update failed", http.StatusInternalServerError)
+				} else {
+					http.Error(w, "concurrent PATCH moved the offset", http.StatusConflict)
+				}
+				return
+			}
+			u.Offset += n
+			u.Chunks = append(u.Chunks, chunk)
+		} else {
+			_ = a.Storage.Delete(chunk)
+		}
+	}
+
+	if u.Offset < u.Length {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	uploadID, err := a.finishTusUpload(ctx, u)
+	if err != nil {
+		var ae *apiError
+		if errors.As(err, &ae) {
+			writeError(w, err)
+			return
+		}
+		log.Error().Err(err).Str("tus", u.ID).Msg("tus finalize failed")
+		http.Error(w, "failed to finalize upload: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	a.tusDone(w, u, uploadID)
+}
+
+func (a *API) tusDone(w http.ResponseWriter, u *db.TusUpload, uploadID int64) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	w.Header().Set("X-Upload-ID", strconv.FormatInt(uploadID, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// finishTusUpload concatenates the chunks into the final object, validating
+// it like a direct upload, then creates the upload, its job and outbox
+// entry, and marks the tus upload complete in one transaction. Chunks are
+// removed afterwards. A file that fails validation can never succeed, so
+// the tus upload is terminated and an *apiError returned.
+func (a *API) finishTusUpload(ctx context.Context, u *db.TusUpload) (int64, error) {
+	filename := filepath.Base(u.Metadata["filename"])
+	if filename == "." || filename == "/" || filename == "" {
+		filename = u.ID
+	}
+	dest := storage.BuildPath(filename)
+	src := &chunkReader{store: a.Storage, chunks: u.Chunks}
+	file, err := a.saveValidated(ctx, src, dest, a.Tus.withDefaults().MaxSize)
+	src.Close()
+	if err != nil {
+		var ae *apiError
+		if errors.As(err, &ae) {
+			if terr := a.terminateTusUpload(ctx, u); terr != nil {
+				log.Warn().Err(terr).Str("tus", u.ID).Msg("terminate rejected tus upload failed")
+			}
+			return 0, err
+		}
+		return 0, fmt.Errorf("assemble chunks: %w", err)
+	}
+	n := file.Size
+	if n != u.Length {
+		_ = a.Storage.Delete(dest)
+		return 0, fmt.Errorf("assembled %d bytes, expected %d", n, u.Length)
+	}
+
+	profiles, _ := resolveProfiles([]string{u.Metadata["profiles"]})
+	target, _ := resolveLoudnessTarget(u.Metadata["loudness_target"])
+	dedupe, _ := resolveDedupe(u.Metadata["dedupe"])
+	priority, _ := queue.ParsePriority(u.Metadata["priority"])
+	// a run_at that passed while the file was uploading queues the job now
+	runAt, _ := parseRunAt(u.Metadata["run_at"])
+	res, err := a.registerUpload(ctx, newUpload{
+		Filename:       filename,
+		Path:           dest,
+		ContentType:    file.ContentType,
+		Size:           n,
+		Profiles:       profiles,
+		LoudnessTarget: target,
+		Priority:       priority,
+		RunAt:          runAt,
+		TusID:          u.ID,
+		SHA256:         file.SHA256,
+		Dedupe:         dedupe,
+	})
+	if errors.Is(err, db.ErrTusCompleted) {
+		return a.completedTusUpload(ctx, u.ID, dest)
+	}
+	if err != nil {
+		_ = a.Storage.Delete(dest)
+		return 0, err
+	}
+	for _, c := range u.Chunks {
+		_ = a.Storage.Delete(c)
+	}
+	log.Info().Str("path", res.Path).Int64("size", n).Str("tus", u.ID).Bool("reused", res.Reused).
+		Msgf("uploaded file id=%d job=%d", res.UploadID, res.JobID)
+	return res.UploadID, nil
+}
+
+// completedTusUpload answers a final PATCH that lost the race to finish the
+// upload with the upload the winner created. The loser's assembled copy is
+// removed unless both landed on the same path.
+func (a *API) completedTusUpload(ctx context.Context, id, dest string) (int64, error) {
+	var uploadID int64
+	var path string
+	err := a.DB.Pool.QueryRow(ctx,
+		`SELECT u.id, u.path FROM tus_uploads t JOIN uploads u ON u.id = t.upload_id WHERE t.id=$1`, id,
+	).Scan(&uploadID, &path)
+	if err != nil {
+		_ = a.Storage.Delete(dest)
+		return 0, fmt.Errorf("load completed tus upload: %w", err)
+	}
+	if path != dest {
+		_ = a.Storage.Delete(dest)
+	}
+	return uploadID, nil
+}
+
+// TusDeleteHandler terminates an upload and removes its stored chunks.
+func (a *API) TusDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if !tusPreamble(w, r) {
+		return
+	}
+	u, ok := a.loadTusUpload(w, r)
+	if !ok {
+		return
+	}
+	if err := a.terminateTusUpload(r.Context(), u); err != nil {
+		log.Error().Err(err).Str("tus", u.ID).Msg("delete tus upload failed")
+		http.Error(w, "delete failed", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// terminateTusUpload removes an upload's chunks and its row.
+func (a *API) terminateTusUpload(ctx context.Context, u *db.TusUpload) error {
+	for _, c := range u.Chunks {
+		_ = a.Storage.Delete(c)
+	}
+	return a.DB.DeleteTusUpload(ctx, u.ID)
+}
+
+// loadTusUpload fetches the upload named in the URL, answering 404 for
+// unknown and 410 for expired uploads.
+func (a *API) loadTusUpload(w http.ResponseWriter, r *http.Request) (*db.TusUpload, bool) {
+	u, err := a.DB.GetTusUpload(r.Context(), chi.URLParam(r, "id"))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "upload not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("load tus upload failed")
+		http.Error(w, "load upload failed", http.StatusInternalServerError)
+		return nil, false
+	}
+	if time.Now().After(u.ExpiresAt) {
+		http.Error(w, "upload expired", http.StatusGone)
+		return nil, false
+	}
+	return u, true
+}
+
+// ReapExpiredTusUploads deletes expired uploads and their chunks, returning
+// how many were removed. Finished uploads only lose their tus record.
+func (a *API) ReapExpiredTusUploads(ctx context.Context) (int, error) {
+	expired, err := a.DB.ExpiredTusUploads(ctx, 100)
+	if err != nil {
+		return 0, err
+	}
+	for _, u := range expired {
+		for _, c := range u.Chunks {
+			if err := a.Storage.Delete(c); err != nil {
+				log.Warn().Err(err).Str("chunk", c).Msg("delete expired tus chunk failed")
+			}
+		}
+		if err := a.DB.DeleteTusUpload(ctx, u.ID); err != nil {
+			return 0, err
+		}
+	}
+	return len(expired), nil
+}
+
+// parseTusMetadata decodes "key base64value,key2 base64value2".
+func parseTusMetadata(raw string) (map[string]string, error) {
+	meta := map[string]string{}
+	if strings.TrimSpace(raw) == "" {
+		return meta, nil
+	}
+	for _, pair := range strings.Split(raw, ",") {
+		key, val, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("malformed Upload-Metadata")
+		}
+		b, err := base64.StdEncoding.DecodeString(val)
+		if err != nil {
+			return nil, fmt.Errorf("Upload-Metadata %q: %w", key, err)
+		}
+		meta[key] = string(b)
+	}
+	return meta, nil
+}
+
+func newTusID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// tusChunkPath names the object for bytes received at offset. The random
+// suffix keeps concurrent PATCHes at the same offset from overwriting each
+// other; only the one that wins the offset update is kept.
+func tusChunkPath(id string, offset int64) (string, error) {
+	suffix, err := newTusID()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("tus/%s/%020d-%s", id, offset, suffix[:8]), nil
+}
+
+// chunkReader streams stored chunks in order, opening one at a time.
+type chunkReader struct {
+	store  storage.Storage
+	chunks []string
+	cur    io.ReadCloser
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if c.cur == nil {
+			if len(c.chunks) == 0 {
+				return 0, io.EOF
+			}
+			f, err := c.store.Open(c.chunks[0])
+			if err != nil {
+				return 0, fmt.Errorf("open chunk %s: %w", c.chunks[0], err)
+			}
+			c.cur, c.chunks = f, c.chunks[1:]
+		}
+		n, err := c.cur.Read(p)
+		if err == io.EOF {
+			_ = c.cur.Close()
+			c.cur = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (c *chunkReader) Close() {
+	if c.cur != nil {
+		_ = c.cur.Close()
+		c.cur = nil
+	}
+}
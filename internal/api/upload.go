@@ -1,17 +1,26 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/audio"
 	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/db"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/outbox"
 	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/queue"
 	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/storage"
 	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/pkg/utils"
 	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
 
 	"github.com/rs/zerolog/log"
 )
@@ -20,88 +29,323 @@ type API struct {
 	DB      *db.DB
 	Storage storage.Storage
 	Queue   *queue.NatsClient
+	// Outbox, when set, is nudged after a job is committed so it is
+	// published without waiting for the relay's next poll.
+	Outbox *outbox.Relay
+	// Tus configures the resumable upload endpoints; zero values use defaults.
+	Tus TusConfig
+	// Upload bounds accepted files; zero values use defaults.
+	Upload UploadConfig
+	// Share configures signed download URLs; disabled without keys.
+	Share ShareConfig
+	// Events wakes SSE streams on job changes; without it they poll.
+	Events *EventHub
+	// CancelCleanup removes what a cancelled job produced. Workers run it
+	// themselves; the API runs it for jobs whose worker was lost while
+	// cancelling (see ReapExpiredJobLeases).
+	CancelCleanup func(ctx context.Context, jm queue.JobMessage) error
 }
 
 type uploadResponse struct {
-	UploadID int64  `json:"upload_id"`
-	Status   string `json:"status"`
-	Path     string `json:"path"`
+	UploadID int64    `json:"upload_id"`
+	Status   string   `json:"status"`
+	Path     string   `json:"path"`
+	Profiles []string `json:"profiles"`
+	// LoudnessTarget is the normalization preset, omitted when not requested.
+	LoudnessTarget string `json:"loudness_target,omitempty"`
+	Priority       string `json:"priority"`
+	// RunAt is when a delayed job ("scheduled") will be queued.
+	RunAt  *time.Time `json:"run_at,omitempty"`
+	SHA256 string     `json:"sha256"`
+	// DuplicateOf is the oldest upload with identical content; Reused is set
+	// when its results were reused and no job was queued.
+	DuplicateOf *int64 `json:"duplicate_of,omitempty"`
+	Reused      bool   `json:"reused,omitempty"`
 }
 
-func (a *API) UploadHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	// 1. Parse multipart form (limit size e.g., 100MB)
-	if err := r.ParseMultipartForm(100 << 20); err != nil {
-		http.Error(w, "failed to parse multipart form: "+err.Error(), http.StatusBadRequest)
-		return
+// newUpload is what createUploadWithJob persists for a stored file.
+type newUpload struct {
+	Filename    string
+	Path        string
+	ContentType string
+	Size        int64
+	Profiles    []string // output profile names, validated
+	// LoudnessTarget is a validated audio.ParseLoudnessTarget spec, "" for none.
+	LoudnessTarget string
+	Priority       string // queue lane of the job, validated
+	// RunAt delays the job until then; nil queues it at once.
+	RunAt *time.Time
+	// TusID links the resumable upload that produced the file; it is marked
+	// complete in the same transaction.
+	TusID  string
+	SHA256 string // hex digest of the stored file
+	Dedupe string // dedupeReuse, dedupeLink or dedupeOff
+	// DuplicateOf is filled in by registerUpload.
+	DuplicateOf *int64
+}
+
+// resolveProfiles validates profile names and returns them canonicalized,
+// defaulting to audio.DefaultProfile.
+func resolveProfiles(list []string) ([]string, error) {
+	profiles, err := audio.ParseProfiles(strings.Join(list, ","))
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(profiles))
+	for i, p := range profiles {
+		names[i] = p.Name
+	}
+	return names, nil
+}
+
+// parseRunAt parses an RFC 3339 run_at. Empty, or a time already passed,
+// returns nil: the job is queued right away.
+func parseRunAt(s string) (*time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
 	}
-	file, header, err := r.FormFile("file")
+	t, err := time.Parse(time.RFC3339, s)
 	if err != nil {
-		http.Error(w, "field 'file' is required", http.StatusBadRequest)
-		return
+		return nil, fmt.Errorf("run_at must be an RFC 3339 timestamp, e.g. 2026-01-02T03:00:00Z")
+	}
+	if !t.After(time.Now()) {
+		return nil, nil
 	}
-	defer file.Close()
+	return &t, nil
+}
 
-	filename := filepath.Base(header.Filename)
-	dest := storage.BuildPath(filename)
+// resolveLoudnessTarget validates a loudness target spec; "" means none.
+func resolveLoudnessTarget(spec string) (string, error) {
+	t, err := audio.ParseLoudnessTarget(spec)
+	if err != nil || t == nil {
+		return "", err
+	}
+	return t.Name, nil
+}
 
-	// Save file via storage
-	n, err := a.Storage.Save(file, dest)
+// formFieldLimit bounds each non-file multipart field.
+const formFieldLimit = 4 << 10
+
+// UploadHandler streams the multipart "file" part straight to storage,
+// validating it on the way (see saveValidated), and queues its job unless an
+// identical upload's results can be reused (see registerUpload). The
+// "profiles", "loudness_target", "dedupe", "priority" and "run_at" fields
+// may come before or after the file.
+func (a *API) UploadHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	cfg := a.Upload.withDefaults()
+	// a large file streams for far longer than the server-wide timeouts
+	deadline := time.Now().Add(cfg.Timeout)
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(deadline)
+	_ = rc.SetWriteDeadline(deadline)
+	// leave room for the multipart framing and the small form fields
+	r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxSize+1<<20)
+	mr, err := r.MultipartReader()
 	if err != nil {
-		log.Error().Err(err).Msg("save file failed")
-		http.Error(w, "failed to save file: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "expected multipart/form-data: " + err.Error()})
 		return
 	}
 
-	// Persist record in DB
-	var uploadID int64
-	err = a.DB.Pool.QueryRow(ctx,
-		`INSERT INTO uploads (filename, path, content_type, size) VALUES ($1,$2,$3,$4) RETURNING id`,
-		filename, dest, header.Header.Get("Content-Type"), n,
-	).Scan(&uploadID)
+	var (
+		filename    string
+		dest        string
+		file        *validatedFile
+		profileVals []string
+		targetVal   string
+		dedupeVal   string
+		priorityVal string
+		runAtVal    string
+	)
+	fail := func(err error) {
+		if file != nil {
+			_ = a.Storage.Delete(dest)
+		}
+		var ae *apiError
+		if !errors.As(err, &ae) {
+			log.Error().Err(err).Str("path", dest).Msg("upload failed")
+		}
+		writeError(w, err)
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var mbe *http.MaxBytesError
+			if errors.As(err, &mbe) {
+				fail(tooLarge(cfg.MaxSize))
+			} else {
+				fail(&apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "malformed multipart body: " + err.Error()})
+			}
+			return
+		}
+		switch part.FormName() {
+		case "file":
+			if file != nil {
+				fail(&apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "only one 'file' part is allowed"})
+				return
+			}
+			filename = filepath.Base(part.FileName())
+			dest = storage.BuildPath(filename)
+			f, err := a.saveValidated(ctx, part, dest, cfg.MaxSize)
+			if err != nil {
+				fail(err)
+				return
+			}
+			file = f
+		case "profiles", "loudness_target", "dedupe", "priority", "run_at":
+			v, err := io.ReadAll(io.LimitReader(part, formFieldLimit+1))
+			if err != nil || len(v) > formFieldLimit {
+				fail(&apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "field '" + part.FormName() + "' is too long or unreadable"})
+				return
+			}
+			switch part.FormName() {
+			case "profiles":
+				profileVals = append(profileVals, string(v))
+			case "loudness_target":
+				targetVal = string(v)
+			case "priority":
+				priorityVal = string(v)
+			case "run_at":
+				runAtVal = string(v)
+			default:
+				dedupeVal = string(v)
+			}
+		}
+		_ = part.Close()
+	}
+	if file == nil {
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: "missing_file", Message: "field 'file' is required"})
+		return
+	}
 
+	profiles, err := resolveProfiles(profileVals)
 	if err != nil {
-		log.Error().Err(err).Msg("db insert failed")
-		http.Error(w, "db insert failed: "+err.Error(), http.StatusInternalServerError)
+		fail(&apiError{Status: http.StatusBadRequest, Code: "invalid_profile", Message: err.Error()})
 		return
 	}
-
-	// create a job record (queued) - basic
-	var jobID int64
-	err = a.DB.Pool.QueryRow(ctx,
-		`INSERT INTO jobs (upload_id, type, status) VALUES ($1,$2,'queued') RETURNING id`,
-		uploadID, "transcode",
-	).Scan(&jobID)
+	target, err := resolveLoudnessTarget(targetVal)
+	if err != nil {
+		fail(&apiError{Status: http.StatusBadRequest, Code: "invalid_loudness_target", Message: err.Error()})
+		return
+	}
+	dedupe, err := resolveDedupe(dedupeVal)
+	if err != nil {
+		fail(&apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: err.Error()})
+		return
+	}
+	priority, err := queue.ParsePriority(priorityVal)
+	if err != nil {
+		fail(&apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: err.Error()})
+		return
+	}
+	runAt, err := parseRunAt(runAtVal)
 	if err != nil {
-		// not fatal: still return upload id
-		log.Error().Err(err).Msg("job insert failed")
+		fail(&apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: err.Error()})
+		return
 	}
 
-	// publish job message (non-blocking)
-	if a.Queue != nil {
-		jm := queue.JobMessage{
-			JobID:    jobID,
-			UploadID: uploadID,
-			Type:     "transcode",
-		}
-		// context.Background() used for quick publish; you can pass r.Context()
-		if err := a.Queue.PublishJob(r.Context(), "jobs", jm); err != nil {
-			log.Error().Err(err).Msg("failed to publish job to nats")
-		} else {
-			log.Info().Int64("job", jobID).Msg("published job to nats")
-		}
+	// Persist upload, job and outbox message in one transaction so an upload
+	// never exists without a job that will eventually be published.
+	res, err := a.registerUpload(ctx, newUpload{
+		Filename:       filename,
+		Path:           dest,
+		ContentType:    file.ContentType,
+		Size:           file.Size,
+		Profiles:       profiles,
+		LoudnessTarget: target,
+		Priority:       priority,
+		RunAt:          runAt,
+		SHA256:         file.SHA256,
+		Dedupe:         dedupe,
+	})
+	if err != nil {
+		fail(fmt.Errorf("db insert failed: %w", err))
+		return
 	}
 
 	resp := uploadResponse{
-		UploadID: uploadID,
-		Status:   "queued",
-		Path:     dest,
+		UploadID:       res.UploadID,
+		Status:         "queued",
+		Path:           res.Path,
+		Profiles:       profiles,
+		LoudnessTarget: target,
+		Priority:       priority,
+		SHA256:         file.SHA256,
+		DuplicateOf:    res.DuplicateOf,
+		Reused:         res.Reused,
+	}
+	if res.Reused {
+		resp.Status = "done"
+	} else if runAt != nil {
+		resp.Status = "scheduled"
+		resp.RunAt = runAt
 	}
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(resp)
 
-	// optional: log
-	log.Info().Str("path", dest).Int64("size", n).Msgf("uploaded file id=%d job=%d", uploadID, jobID)
+	log.Info().Str("path", res.Path).Int64("size", file.Size).Str("container", file.Container).Str("codec", file.Codec).
+		Bool("reused", res.Reused).Msgf("uploaded file id=%d job=%d", res.UploadID, res.JobID)
+}
+
+// createUploadWithJob inserts the upload row and its transcode job (see
+// insertJob), all in one transaction.
+func (a *API) createUploadWithJob(ctx context.Context, u newUpload) (uploadID, jobID int64, err error) {
+	if u.Profiles == nil {
+		u.Profiles = []string{}
+	}
+	err = a.DB.WithTx(ctx, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx,
+			`INSERT INTO uploads (filename, path, content_type, size, profiles, loudness_target, sha256, duplicate_of)
+			 VALUES ($1,$2,$3,$4,$5,$6,NULLIF($7,''),$8) RETURNING id`,
+			u.Filename, u.Path, u.ContentType, u.Size, u.Profiles, u.LoudnessTarget, u.SHA256, u.DuplicateOf,
+		).Scan(&uploadID); err != nil {
+			return fmt.Errorf("insert upload: %w", err)
+		}
+		if jobID, err = insertJob(ctx, tx, uploadID, u.Priority, u.RunAt); err != nil {
+			return err
+		}
+		if u.TusID != "" {
+			if err := db.CompleteTusUpload(ctx, tx, u.TusID, uploadID); err != nil {
+				return fmt.Errorf("complete tus upload: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	if a.Outbox != nil && u.RunAt == nil {
+		a.Outbox.Notify()
+	}
+	return uploadID, jobID, nil
+}
+
+// insertJob adds a transcode job for an upload. Without runAt it is queued
+// along with the outbox entry that publishes it on its priority's subject;
+// with runAt it waits as "scheduled" until the scheduler promotes it.
+func insertJob(ctx context.Context, tx pgx.Tx, uploadID int64, priority string, runAt *time.Time) (int64, error) {
+	if priority == "" {
+		priority = queue.PriorityNormal
+	}
+	status := "queued"
+	if runAt != nil {
+		status = "scheduled"
+	}
+	var jobID int64
+	if err := tx.QueryRow(ctx,
+		`INSERT INTO jobs (upload_id, type, status, priority, run_at) VALUES ($1,$2,$3,$4,$5) RETURNING id`,
+		uploadID, "transcode", status, priority, runAt,
+	).Scan(&jobID); err != nil {
+		return 0, fmt.Errorf("insert job: %w", err)
+	}
+	if runAt != nil {
+		return jobID, nil
+	}
+	return jobID, publishJob(ctx, tx, db.JobRef{ID: jobID, UploadID: uploadID, Type: "transcode", Priority: priority})
 }
 
 func (a *API) GetUploadAnalysisHandler(w http.ResponseWriter, r *http.Request) {
@@ -112,22 +356,57 @@ func (a *API) GetUploadAnalysisHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid id", http.StatusBadRequest)
 		return
 	}
-	row := a.DB.Pool.QueryRow(ctx, `SELECT duration_seconds, integrated_lufs, bpm, musical_key, output_path FROM uploads WHERE id=$1`, id)
+	row := a.DB.Pool.QueryRow(ctx, `SELECT duration_seconds, integrated_lufs, loudness_range, true_peak_dbtp, bpm, musical_key, bpm_confidence, key_confidence, output_path, waveform_path FROM uploads WHERE id=$1`, id)
 	var dur sql.NullFloat64
-	var lufs sql.NullFloat64
+	var lufs, lra, truePeak sql.NullFloat64
 	var bpm sql.NullFloat64
 	var key sql.NullString
-	var out sql.NullString
-	if err := row.Scan(&dur, &lufs, &bpm, &key, &out); err != nil {
+	var bpmConf, keyConf sql.NullFloat64
+	var out, wave sql.NullString
+	if err := row.Scan(&dur, &lufs, &lra, &truePeak, &bpm, &key, &bpmConf, &keyConf, &out, &wave); err != nil {
 		http.Error(w, "not found", http.StatusNotFound)
 		return
 	}
+	outputs, err := a.DB.ListOutputs(ctx, id)
+	if err != nil {
+		log.Error().Err(err).Int64("upload", id).Msg("list outputs failed")
+		http.Error(w, "list outputs failed", http.StatusInternalServerError)
+		return
+	}
 	resp := map[string]interface{}{
 		"duration_seconds": utils.NilIfNullFloat(dur),
 		"integrated_lufs":  utils.NilIfNullFloat(lufs),
+		"loudness_range":   utils.NilIfNullFloat(lra),
+		"true_peak_dbtp":   utils.NilIfNullFloat(truePeak),
 		"bpm":              utils.NilIfNullFloat(bpm),
 		"musical_key":      utils.NilIfNullString(key),
+		"bpm_confidence":   utils.NilIfNullFloat(bpmConf),
+		"key_confidence":   utils.NilIfNullFloat(keyConf),
 		"output_path":      utils.NilIfNullString(out),
+		"waveform_path":    utils.NilIfNullString(wave),
+		"outputs":          outputs,
 	}
 	writeJSON(w, resp)
 }
+
+// GetUploadLoudnessHandler returns the stored BS.1770 measurement of an
+// upload's primary output, including the short-term loudness curve.
+func (a *API) GetUploadLoudnessHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var raw []byte
+	if err := a.DB.Pool.QueryRow(ctx, `SELECT loudness FROM uploads WHERE id=$1`, id).Scan(&raw); err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if raw == nil {
+		http.Error(w, "loudness not measured yet", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(raw)
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRunAt(t *testing.T) {
+	future := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	cases := []struct {
+		in   string
+		want *time.Time
+		err  bool
+	}{
+		{"", nil, false},
+		{"   ", nil, false},
+		{future.Format(time.RFC3339), &future, false},
+		{" " + future.Format(time.RFC3339) + "\n", &future, false},
+		{future.In(time.FixedZone("", 2*3600)).Format(time.RFC3339), &future, false},
+		// a time already passed queues the job right away
+		{"2001-01-01T00:00:00Z", nil, false},
+		{time.Now().Add(-time.Second).Format(time.RFC3339), nil, false},
+		{"tomorrow", nil, true},
+		{future.Format("2006-01-02 15:04:05"), nil, true},
+		{future.Format(time.RFC1123), nil, true},
+		{"1767322800", nil, true},
+	}
+	for _, tc := range cases {
+		got, err := parseRunAt(tc.in)
+		if tc.err {
+			require.Error(t, err, tc.in)
+			continue
+		}
+		require.NoError(t, err, tc.in)
+		if tc.want == nil {
+			require.Nil(t, got, tc.in)
+			continue
+		}
+		require.NotNil(t, got, tc.in)
+		require.True(t, tc.want.Equal(*got), "%s: got %s", tc.in, got)
+	}
+}
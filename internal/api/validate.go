@@ -0,0 +1,203 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/audio"
+	"github.com/rs/zerolog/log"
+)
+
+// UploadConfig bounds what POST /upload (and a completing tus upload) will
+// accept.
+type UploadConfig struct {
+	MaxSize     int64         // largest accepted file; default 1 GiB
+	MaxDuration time.Duration // longest accepted audio; default 4h
+	// ProbeBytes is how much of the head of each upload is kept for the
+	// synchronous ffprobe; default 16 MiB. Files that fit are probed whole,
+	// larger ones too when their head does not probe.
+	ProbeBytes   int64
+	ProbeTimeout time.Duration // default 15s
+	// Timeout bounds a whole POST /upload, overriding the server's read and
+	// write timeouts; default 1h.
+	Timeout time.Duration
+}
+
+func (c UploadConfig) withDefaults() UploadConfig {
+	if c.MaxSize <= 0 {
+		c.MaxSize = 1 << 30
+	}
+	if c.MaxDuration <= 0 {
+		c.MaxDuration = 4 * time.Hour
+	}
+	if c.ProbeBytes <= 0 {
+		c.ProbeBytes = 16 << 20
+	}
+	if c.ProbeTimeout <= 0 {
+		c.ProbeTimeout = 15 * time.Second
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = time.Hour
+	}
+	return c
+}
+
+// apiError is a client-facing failure rendered as {"error","message"}.
+type apiError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"error"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string { return e.Code + ": " + e.Message }
+
+// writeError renders err as JSON; anything that is not an *apiError is
+// reported as an opaque 500.
+func writeError(w http.ResponseWriter, err error) {
+	var ae *apiError
+	if !errors.As(err, &ae) {
+		ae = &apiError{Status: http.StatusInternalServerError, Code: "internal", Message: err.Error()}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(ae.Status)
+	writeJSON(w, ae)
+}
+
+// validatedFile describes an upload that passed sniffing and the probe.
+type validatedFile struct {
+	Size        int64
+	SHA256      string
+	Container   string
+	ContentType string
+	Codec       string
+	Duration    float64
+}
+
+// saveValidated streams src to dest while checking it: the first bytes must
+// sniff as a supported container, the whole body must fit maxSize, and
+// an ffprobe of the retained head (or of the whole stored file when the head
+// is not enough) must find an audio stream of non-zero duration within
+// cfg.MaxDuration. The stored object is removed on any
+// failure, so callers only need to clean up after later errors.
+func (a *API) saveValidated(ctx context.Context, src io.Reader, dest string, maxSize int64) (*validatedFile, error) {
+	cfg := a.Upload.withDefaults()
+
+	head := make([]byte, audio.SniffLen)
+	n, err := io.ReadFull(src, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, readError(err, maxSize)
+	}
+	if n == 0 {
+		return nil, &apiError{Status: http.StatusBadRequest, Code: "empty_file", Message: "uploaded file is empty"}
+	}
+	head = head[:n]
+	container, mimeType, err := audio.Sniff(head)
+	if err != nil {
+		return nil, &apiError{Status: http.StatusUnsupportedMediaType, Code: "unsupported_format", Message: err.Error()}
+	}
+
+	tmp, err := os.CreateTemp("", "phantom-probe-*."+container)
+	if err != nil {
+		return nil, fmt.Errorf("probe temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	// one byte past the limit tells an exact fit from an oversized body
+	body := io.LimitReader(io.MultiReader(bytes.NewReader(head), src), maxSize+1)
+	saved, err := a.Storage.Save(io.TeeReader(body, &headWriter{w: tmp, n: cfg.ProbeBytes}), dest)
+	if err != nil {
+		_ = a.Storage.Delete(dest)
+		return nil, readError(err, maxSize)
+	}
+	size := saved.Size
+	reject := func(e *apiError) (*validatedFile, error) {
+		_ = a.Storage.Delete(dest)
+		return nil, e
+	}
+	if size > maxSize {
+		return reject(tooLarge(maxSize))
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, cfg.ProbeTimeout)
+	defer cancel()
+	whole := size <= cfg.ProbeBytes
+	info, err := audio.ProbeStream(probeCtx, tmp.Name())
+	if err != nil && !whole {
+		// the head alone may not be decodable, e.g. an MP4 with its moov
+		// atom at the end; probe the stored file instead
+		log.Debug().Err(err).Str("path", dest).Msg("upload head probe failed, probing whole file")
+		info, err = a.probeStored(ctx, dest, cfg.ProbeTimeout)
+		whole = true
+	}
+	if err != nil {
+		log.Debug().Err(err).Str("path", dest).Msg("upload probe failed")
+		return reject(&apiError{Status: http.StatusUnprocessableEntity, Code: "not_audio", Message: "file has no decodable audio stream"})
+	}
+	// a truncated head may not reveal the duration; only a whole-file probe
+	// can prove it is zero
+	if info.Duration <= 0 && whole {
+		return reject(&apiError{Status: http.StatusUnprocessableEntity, Code: "empty_audio", Message: "audio stream has zero duration"})
+	}
+	if info.Duration > cfg.MaxDuration.Seconds() {
+		return reject(&apiError{Status: http.StatusUnprocessableEntity, Code: "too_long",
+			Message: fmt.Sprintf("audio is %s long, limit is %s", time.Duration(info.Duration*float64(time.Second)).Round(time.Second), cfg.MaxDuration)})
+	}
+	return &validatedFile{
+		Size:        size,
+		SHA256:      saved.SHA256,
+		Container:   container,
+		ContentType: mimeType,
+		Codec:       info.Codec,
+		Duration:    info.Duration,
+	}, nil
+}
+
+// probeStored runs ffprobe on the stored object at path.
+func (a *API) probeStored(ctx context.Context, path string, timeout time.Duration) (*audio.StreamInfo, error) {
+	local, cleanup, err := a.Storage.Materialize(path)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return audio.ProbeStream(ctx, local)
+}
+
+func tooLarge(limit int64) *apiError {
+	return &apiError{Status: http.StatusRequestEntityTooLarge, Code: "too_large", Message: fmt.Sprintf("upload exceeds %d bytes", limit)}
+}
+
+// readError maps request body failures to client errors.
+func readError(err error, limit int64) error {
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		return tooLarge(limit)
+	}
+	return fmt.Errorf("store upload: %w", err)
+}
+
+// headWriter keeps the first n bytes written to it and discards the rest
+// without error, so it can sit behind an io.TeeReader.
+type headWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (h *headWriter) Write(p []byte) (int, error) {
+	if h.n > 0 {
+		k := min(int64(len(p)), h.n)
+		if _, err := h.w.Write(p[:k]); err != nil {
+			return 0, err
+		}
+		h.n -= k
+	}
+	return len(p), nil
+}
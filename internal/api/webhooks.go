@@ -0,0 +1,215 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/db"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/webhook"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// webhookEvents are the job transitions a subscription can receive.
+var webhookEvents = []string{"job.queued", "job.running", "job.done", "job.failed", "job.cancelled"}
+
+type createWebhookRequest struct {
+	URL string `json:"url"`
+	// UploadID limits the subscription to the jobs of one upload; omitted,
+	// it receives events for every upload.
+	UploadID *int64   `json:"upload_id,omitempty"`
+	Events   []string `json:"events,omitempty"` // default: all webhookEvents
+	// Secret signs deliveries; one is generated when empty.
+	Secret string `json:"secret,omitempty"`
+}
+
+// createWebhookResponse is the only response that includes the secret.
+type createWebhookResponse struct {
+	*db.Webhook
+	Secret string `json:"secret"`
+}
+
+// CreateWebhookHandler subscribes a URL to job state changes.
+func (a *API) CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req createWebhookRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "invalid JSON body"})
+		return
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "url must be an absolute http(s) URL"})
+		return
+	}
+	events := webhookEvents
+	if len(req.Events) > 0 {
+		events = nil
+		for _, e := range req.Events {
+			if !slices.Contains(webhookEvents, e) {
+				writeError(w, &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "unknown event " + strconv.Quote(e)})
+				return
+			}
+			if !slices.Contains(events, e) {
+				events = append(events, e)
+			}
+		}
+	}
+	if req.Secret == "" {
+		if req.Secret, err = webhook.NewSecret(); err != nil {
+			writeError(w, err)
+			return
+		}
+	} else if len(req.Secret) < 16 {
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "secret must be at least 16 bytes"})
+		return
+	}
+	if req.UploadID != nil {
+		var exists bool
+		if err := a.DB.Pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM uploads WHERE id=$1)`, *req.UploadID).Scan(&exists); err != nil {
+			writeError(w, err)
+			return
+		}
+		if !exists {
+			writeError(w, &apiError{Status: http.StatusNotFound, Code: "not_found", Message: "upload not found"})
+			return
+		}
+	}
+
+	hook := &db.Webhook{URL: u.String(), Secret: req.Secret, UploadID: req.UploadID, Events: events}
+	if err := a.DB.CreateWebhook(ctx, hook); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/api/webhooks/"+strconv.FormatInt(hook.ID, 10))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, createWebhookResponse{Webhook: hook, Secret: hook.Secret})
+}
+
+// ListWebhooksHandler lists subscriptions, optionally ?upload_id=.
+func (a *API) ListWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	var uploadID *int64
+	if v := r.URL.Query().Get("upload_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			writeError(w, &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "invalid upload_id"})
+			return
+		}
+		uploadID = &id
+	}
+	hooks, err := a.DB.ListWebhooks(r.Context(), uploadID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, hooks)
+}
+
+// GetWebhookHandler returns one subscription, without its secret.
+func (a *API) GetWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	hook, ok := a.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, hook)
+}
+
+// DeleteWebhookHandler unsubscribes and drops the delivery log.
+func (a *API) DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "invalid id"})
+		return
+	}
+	ok, err := a.DB.DeleteWebhook(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if !ok {
+		writeError(w, &apiError{Status: http.StatusNotFound, Code: "not_found", Message: "webhook not found"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListWebhookDeliveriesHandler is the delivery log of a subscription, newest
+// first; ?status= filters by pending, delivered or failed and ?limit= (max
+// 500) caps the result.
+func (a *API) ListWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	hook, ok := a.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	status := q.Get("status")
+	if status != "" && status != "pending" && status != "delivered" && status != "failed" {
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "status must be pending, delivered or failed"})
+		return
+	}
+	limit := 100
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			writeError(w, &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "limit must be 1-500"})
+			return
+		}
+		limit = n
+	}
+	deliveries, err := a.DB.ListWebhookDeliveries(r.Context(), hook.ID, status, limit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, deliveries)
+}
+
+// GetWebhookDeliveryHandler returns one delivery with every attempt made.
+func (a *API) GetWebhookDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	hook, ok := a.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, "delivery"), 10, 64)
+	if err != nil {
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "invalid delivery id"})
+		return
+	}
+	dl, attempts, err := a.DB.GetWebhookDelivery(r.Context(), hook.ID, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, &apiError{Status: http.StatusNotFound, Code: "not_found", Message: "delivery not found"})
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, struct {
+		*db.WebhookDelivery
+		AttemptLog []db.WebhookAttempt `json:"attempt_log"`
+	}{dl, attempts})
+}
+
+// loadWebhook resolves {id}, writing the error response itself.
+func (a *API) loadWebhook(w http.ResponseWriter, r *http.Request) (*db.Webhook, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: "invalid id"})
+		return nil, false
+	}
+	hook, err := a.DB.GetWebhook(r.Context(), id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, &apiError{Status: http.StatusNotFound, Code: "not_found", Message: "webhook not found"})
+		return nil, false
+	}
+	if err != nil {
+		writeError(w, err)
+		return nil, false
+	}
+	return hook, true
+}
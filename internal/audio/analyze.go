@@ -3,6 +3,7 @@ package audio
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os/exec"
 	"time"
@@ -11,8 +12,87 @@ import (
 type AnalysisResult struct {
 	BPM float64 `json:"bpm"`
 	Key string  `json:"key"`
+	// Confidences are 0..1; the Python analyzer does not report them.
+	BPMConfidence float64 `json:"bpm_confidence,omitempty"`
+	KeyConfidence float64 `json:"key_confidence,omitempty"`
 }
 
+// Analyzer settings: mono 22.05 kHz keeps the FFTs cheap while covering the
+// chroma range; 1024/256 gives ~86 onset frames per second for tempo and
+// 8192-point frames resolve semitones down to chromaMinHz.
+const (
+	analysisRate   = 22050
+	onsetFFTSize   = 1024
+	onsetHop       = 256
+	chromaFFTSize  = 8192
+	chromaHop      = 4096
+	analysisFrames = 4096 // samples converted per Write batch
+)
+
+// Analyzer estimates tempo and key from mono PCM written incrementally.
+// It is not safe for concurrent use.
+type Analyzer struct {
+	rate   int
+	onset  *framer
+	chroma *framer
+	flux   onsetFlux
+	pcs    *chromaAccumulator
+	tmp    []float64
+}
+
+// NewAnalyzer returns an Analyzer for mono PCM at sampleRate.
+func NewAnalyzer(sampleRate int) *Analyzer {
+	a := &Analyzer{rate: sampleRate, pcs: newChromaAccumulator(chromaFFTSize, sampleRate)}
+	onsetSpec, chromaSpec := newSpectrum(onsetFFTSize), newSpectrum(chromaFFTSize)
+	a.onset = &framer{size: onsetFFTSize, hop: onsetHop, fn: func(f []float64) {
+		a.flux.add(onsetSpec.magnitudes(f))
+	}}
+	a.chroma = &framer{size: chromaFFTSize, hop: chromaHop, fn: func(f []float64) {
+		a.pcs.add(chromaSpec.magnitudes(f))
+	}}
+	return a
+}
+
+// Write feeds mono samples.
+func (a *Analyzer) Write(samples []float32) {
+	for len(samples) > 0 {
+		n := min(len(samples), analysisFrames)
+		a.tmp = a.tmp[:0]
+		for _, s := range samples[:n] {
+			a.tmp = append(a.tmp, float64(s))
+		}
+		a.onset.push(a.tmp)
+		a.chroma.push(a.tmp)
+		samples = samples[n:]
+	}
+}
+
+// Result estimates tempo and key from everything written so far.
+func (a *Analyzer) Result() *AnalysisResult {
+	res := &AnalysisResult{}
+	res.BPM, res.BPMConfidence = EstimateTempo(a.flux.envelope, float64(a.rate)/onsetHop)
+	res.Key, res.KeyConfidence = EstimateKey(a.pcs.chroma)
+	return res
+}
+
+// Analyze decodes inputPath to mono and estimates tempo and key natively.
+func Analyze(ctx context.Context, inputPath string) (*AnalysisResult, error) {
+	a := NewAnalyzer(analysisRate)
+	if err := DecodePCM(ctx, inputPath, PCMFormat{SampleRate: analysisRate, Channels: 1}, func(samples []float32) error {
+		a.Write(samples)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	res := a.Result()
+	if res.BPM == 0 && res.Key == "" {
+		return nil, errors.New("analysis failed: input too short or silent")
+	}
+	return res, nil
+}
+
+// AnalyzeWithPython runs tools/analyze.py (librosa). It is kept as an
+// optional cross-check of Analyze.
 func AnalyzeWithPython(ctx context.Context, pythonPath, scriptPath, inputPath string, timeout time.Duration) (*AnalysisResult, error) {
 	// pythonPath: e.g. "python" or full path to venv python
 	// scriptPath: path to tools/analyze.py
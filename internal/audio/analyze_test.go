@@ -0,0 +1,68 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+// clickTrack renders decaying 1 kHz blips at bpm for seconds.
+func clickTrack(rate int, bpm, seconds float64) []float32 {
+	out := make([]float32, int(float64(rate)*seconds))
+	period := 60 / bpm * float64(rate)
+	for beat := 0.0; int(beat) < len(out); beat += period {
+		for i := 0; i < rate/20 && int(beat)+i < len(out); i++ {
+			t := float64(i) / float64(rate)
+			out[int(beat)+i] += float32(math.Exp(-t*60) * math.Sin(2*math.Pi*1000*t))
+		}
+	}
+	return out
+}
+
+// chords renders each chord (MIDI note numbers) for secondsEach.
+func chords(rate int, secondsEach float64, progression ...[]int) []float32 {
+	n := int(float64(rate) * secondsEach)
+	var out []float32
+	for _, chord := range progression {
+		for i := 0; i < n; i++ {
+			var v float64
+			for _, note := range chord {
+				f := 440 * math.Pow(2, float64(note-69)/12)
+				v += math.Sin(2 * math.Pi * f * float64(i) / float64(rate))
+			}
+			out = append(out, float32(0.2*v))
+		}
+	}
+	return out
+}
+
+func TestAnalyzerTempo(t *testing.T) {
+	for _, bpm := range []float64{90, 120, 128, 174} {
+		a := NewAnalyzer(analysisRate)
+		a.Write(clickTrack(analysisRate, bpm, 30))
+		res := a.Result()
+		if math.Abs(res.BPM-bpm) > 1.5 {
+			t.Errorf("%v BPM clicks: estimated %v", bpm, res.BPM)
+		}
+		if res.BPMConfidence < 0.5 {
+			t.Errorf("%v BPM clicks: low confidence %v", bpm, res.BPMConfidence)
+		}
+	}
+}
+
+func TestAnalyzerKey(t *testing.T) {
+	cases := map[string][][]int{
+		// I-IV-V-I in C major
+		"C": {{60, 64, 67}, {65, 69, 72}, {67, 71, 74}, {60, 64, 67}},
+		// i-iv-V-i in A minor (harmonic minor dominant)
+		"Am": {{57, 60, 64}, {62, 65, 69}, {64, 68, 71}, {57, 60, 64}},
+		// I-V-vi-IV in E major
+		"E": {{64, 68, 71}, {71, 75, 78}, {73, 76, 80}, {69, 73, 76}},
+	}
+	for want, progression := range cases {
+		a := NewAnalyzer(analysisRate)
+		a.Write(chords(analysisRate, 2, progression...))
+		if res := a.Result(); res.Key != want {
+			t.Errorf("expected %s, got %s (confidence %v)", want, res.Key, res.KeyConfidence)
+		}
+	}
+}
@@ -1,14 +1,12 @@
 package audio
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"os/exec"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -50,73 +48,23 @@ func Probe(ctx context.Context, inputPath string) (*Info, error) {
 	return info, nil
 }
 
-// Transcode converts input to target outputPath with sane defaults.
-// Eg. outputPath ends with .mp3 or .opus etc.
+// Transcode converts input to outputPath with the default profile
+// (44.1 kHz stereo 192k MP3). Use TranscodeProfile for other formats.
 func Transcode(ctx context.Context, inputPath, outputPath string) error {
-	// ensure parent exists when writing outside of storage wrapper (caller creates dir)
-	// ffmpeg command:
-	// -y overwrite, -i input, -vn no video, set sample rate/channels/bitrate
-	args := []string{
-		"-y",
-		"-i", inputPath,
-		"-vn",
-		"-ar", "44100",
-		"-ac", "2",
-		"-b:a", "192k",
-		outputPath,
-	}
-	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
-	// capture stderr (ffmpeg prints progress there)
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("ffmpeg transcode error: %w | stderr: %s", err, stderr.String())
-	}
-	return nil
+	return TranscodeProfile(ctx, inputPath, outputPath, Profiles[DefaultProfile])
 }
 
-// Loudness runs ffmpeg loudnorm analysis (two-pass style) to estimate integrated LUFS.
-// This function runs ffmpeg with -af loudnorm=I=-16:TP=-1.5:LRA=11:print_format=summary
-// and parses the printed stats. It returns integrated LUFS as a float (negative value).
+// Loudness returns the integrated loudness (LUFS) of inputPath, measured
+// with the native BS.1770 meter. Use MeasureLoudness for the full statistics.
 func Loudness(ctx context.Context, inputPath string) (float64, error) {
-	// Use ffmpeg to output loudnorm stats
-	args := []string{
-		"-hide_banner",
-		"-i", inputPath,
-		"-filter_complex", "loudnorm=I=-16:TP=-1.5:LRA=11:print_format=summary",
-		"-f", "null",
-		"-",
-	}
-	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
-	stderrPipe, err := cmd.StderrPipe()
+	st, err := MeasureLoudness(ctx, inputPath)
 	if err != nil {
 		return 0, err
 	}
-	if err := cmd.Start(); err != nil {
-		return 0, err
-	}
-	scanner := bufio.NewScanner(stderrPipe)
-	var outLines []string
-	for scanner.Scan() {
-		l := scanner.Text()
-		outLines = append(outLines, l)
-	}
-	_ = cmd.Wait()
-	// join and parse for "Input Integrated:    -xx.xx LUFS" or "input_i"
-	text := strings.Join(outLines, "\n")
-	// Try to find "Input Integrated" pattern (human readable)
-	re1 := regexp.MustCompile(`Input Integrated:\s*([-+]?\d+(\.\d+)?)\s*LUFS`)
-	if m := re1.FindStringSubmatch(text); len(m) >= 2 {
-		val, _ := strconv.ParseFloat(m[1], 64)
-		return val, nil
-	}
-	// Try machine output fields like "input_i=-xx.xx"
-	re2 := regexp.MustCompile(`input_i=([-+]?\d+(\.\d+)?)`)
-	if m := re2.FindStringSubmatch(text); len(m) >= 2 {
-		val, _ := strconv.ParseFloat(m[1], 64)
-		return val, nil
+	if st.Integrated <= SilenceFloor {
+		return 0, errors.New("loudness not measurable: no audio above the gate")
 	}
-	return 0, errors.New("loudness not found")
+	return st.Integrated, nil
 }
 
 // GenerateWaveform produces a PNG waveform using ffmpeg showwavespic filter.
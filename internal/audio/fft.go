@@ -0,0 +1,89 @@
+package audio
+
+import (
+	"math"
+	"math/bits"
+)
+
+// fft computes an in-place radix-2 complex FFT; len(re) == len(im) must be a
+// power of two.
+func fft(re, im []float64) {
+	n := len(re)
+	if n <= 1 {
+		return
+	}
+	shift := 64 - uint(bits.TrailingZeros(uint(n)))
+	for i := 0; i < n; i++ {
+		j := int(bits.Reverse64(uint64(i)) >> shift)
+		if j > i {
+			re[i], re[j] = re[j], re[i]
+			im[i], im[j] = im[j], im[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		half := size / 2
+		step := -2 * math.Pi / float64(size)
+		for start := 0; start < n; start += size {
+			for k := 0; k < half; k++ {
+				wr, wi := math.Cos(step*float64(k)), math.Sin(step*float64(k))
+				a, b := start+k, start+k+half
+				tr := wr*re[b] - wi*im[b]
+				ti := wr*im[b] + wi*re[b]
+				re[b], im[b] = re[a]-tr, im[a]-ti
+				re[a], im[a] = re[a]+tr, im[a]+ti
+			}
+		}
+	}
+}
+
+// spectrum is a reusable windowed magnitude-spectrum calculator.
+type spectrum struct {
+	window []float64
+	re, im []float64
+	mag    []float64 // n/2+1 bins
+}
+
+func newSpectrum(n int) *spectrum {
+	s := &spectrum{
+		window: make([]float64, n),
+		re:     make([]float64, n),
+		im:     make([]float64, n),
+		mag:    make([]float64, n/2+1),
+	}
+	for i := range s.window {
+		s.window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n))
+	}
+	return s
+}
+
+// magnitudes returns |X[k]| of the Hann-windowed frame; the slice is reused.
+func (s *spectrum) magnitudes(frame []float64) []float64 {
+	for i, x := range frame {
+		s.re[i] = x * s.window[i]
+		s.im[i] = 0
+	}
+	fft(s.re, s.im)
+	for k := range s.mag {
+		s.mag[k] = math.Hypot(s.re[k], s.im[k])
+	}
+	return s.mag
+}
+
+// framer slices a sample stream into overlapping frames.
+type framer struct {
+	size, hop int
+	buf       []float64
+	fn        func(frame []float64)
+}
+
+func (f *framer) push(samples []float64) {
+	f.buf = append(f.buf, samples...)
+	start := 0
+	for len(f.buf)-start >= f.size {
+		f.fn(f.buf[start : start+f.size])
+		start += f.hop
+	}
+	// keep the unconsumed tail at the front of the buffer
+	n := copy(f.buf, f.buf[start:])
+	f.buf = f.buf[:n]
+}
@@ -0,0 +1,105 @@
+package audio
+
+import "math"
+
+// pitchClasses are chroma bin names starting at C, in the format the
+// analyzer reports keys ("C", "F#m", ...).
+var pitchClasses = [12]string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+
+// Krumhansl-Kessler key profiles (probe-tone ratings), tonic first.
+var (
+	majorProfile = [12]float64{6.35, 2.23, 3.48, 2.33, 4.38, 4.09, 2.52, 5.19, 2.39, 3.66, 2.29, 2.88}
+	minorProfile = [12]float64{6.33, 2.68, 3.52, 5.38, 2.60, 3.53, 2.54, 4.75, 3.98, 2.69, 3.34, 3.17}
+)
+
+// Chroma is accumulated only over this range: below it the FFT cannot
+// separate semitones, above it harmonics blur the pitch classes.
+const (
+	chromaMinHz = 60.0
+	chromaMaxHz = 2000.0
+)
+
+// chromaAccumulator folds magnitude spectra into a 12-bin pitch-class profile.
+type chromaAccumulator struct {
+	bins   []int // pitch class per FFT bin, -1 outside the range
+	chroma [12]float64
+}
+
+func newChromaAccumulator(fftSize, sampleRate int) *chromaAccumulator {
+	c := &chromaAccumulator{bins: make([]int, fftSize/2+1)}
+	for k := range c.bins {
+		c.bins[k] = -1
+		f := float64(k) * float64(sampleRate) / float64(fftSize)
+		if f < chromaMinHz || f > chromaMaxHz {
+			continue
+		}
+		midi := 69 + 12*math.Log2(f/440)
+		c.bins[k] = ((int(math.Round(midi)) % 12) + 12) % 12
+	}
+	return c
+}
+
+// add accumulates one frame, normalized to its strongest pitch class so loud
+// passages do not dominate the profile.
+func (c *chromaAccumulator) add(mag []float64) {
+	var frame [12]float64
+	for k, pc := range c.bins {
+		if pc >= 0 {
+			frame[pc] += mag[k] * mag[k]
+		}
+	}
+	var peak float64
+	for _, v := range frame {
+		peak = math.Max(peak, v)
+	}
+	if peak < 1e-9 {
+		return
+	}
+	for i, v := range frame {
+		c.chroma[i] += v / peak
+	}
+}
+
+// EstimateKey correlates a pitch-class profile against the 24 rotated
+// Krumhansl-Kessler profiles and returns the best key with its correlation
+// (clamped to 0..1) as confidence.
+func EstimateKey(chroma [12]float64) (key string, confidence float64) {
+	best := math.Inf(-1)
+	for tonic := 0; tonic < 12; tonic++ {
+		var rotated [12]float64
+		for i := range rotated {
+			rotated[i] = chroma[(tonic+i)%12]
+		}
+		if r := pearson(rotated, majorProfile); r > best {
+			best, key = r, pitchClasses[tonic]
+		}
+		if r := pearson(rotated, minorProfile); r > best {
+			best, key = r, pitchClasses[tonic]+"m"
+		}
+	}
+	if math.IsNaN(best) || math.IsInf(best, 0) {
+		return "", 0
+	}
+	return key, round2(math.Max(0, math.Min(1, best)))
+}
+
+func pearson(a, b [12]float64) float64 {
+	var ma, mb float64
+	for i := range a {
+		ma += a[i]
+		mb += b[i]
+	}
+	ma /= 12
+	mb /= 12
+	var num, da, db float64
+	for i := range a {
+		x, y := a[i]-ma, b[i]-mb
+		num += x * y
+		da += x * x
+		db += y * y
+	}
+	if da == 0 || db == 0 {
+		return math.NaN()
+	}
+	return num / math.Sqrt(da*db)
+}
@@ -0,0 +1,217 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LoudnessTarget is a normalization goal for ffmpeg's loudnorm filter.
+type LoudnessTarget struct {
+	Name string  `json:"name"`
+	I    float64 `json:"integrated_lufs"` // integrated loudness, LUFS
+	TP   float64 `json:"true_peak_dbtp"`  // maximum true peak, dBTP
+	LRA  float64 `json:"lra_lu"`          // loudness range, LU
+}
+
+// LoudnessTargets are the named presets accepted by ParseLoudnessTarget.
+var LoudnessTargets = map[string]LoudnessTarget{
+	"ebu-r128":  {Name: "ebu-r128", I: -23, TP: -1, LRA: 18},
+	"streaming": {Name: "streaming", I: -14, TP: -1, LRA: 11},
+	"podcast":   {Name: "podcast", I: -16, TP: -1.5, LRA: 11},
+}
+
+// ParseLoudnessTarget resolves a preset name or "custom:I[:TP[:LRA]]"
+// (e.g. "custom:-18:-1:9"). An empty string means no normalization and
+// returns nil.
+func ParseLoudnessTarget(s string) (*LoudnessTarget, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" || s == "none" {
+		return nil, nil
+	}
+	if t, ok := LoudnessTargets[s]; ok {
+		return &t, nil
+	}
+	rest, ok := strings.CutPrefix(s, "custom:")
+	if !ok {
+		names := make([]string, 0, len(LoudnessTargets))
+		for n := range LoudnessTargets {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown loudness target %q (known: %s, custom:I[:TP[:LRA]])", s, strings.Join(names, ", "))
+	}
+	// defaults for omitted fields follow the streaming preset
+	t := LoudnessTarget{Name: s, TP: -1, LRA: 11}
+	dst := []*float64{&t.I, &t.TP, &t.LRA}
+	parts := strings.Split(rest, ":")
+	if len(parts) > len(dst) {
+		return nil, fmt.Errorf("loudness target %q: too many values", s)
+	}
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return nil, fmt.Errorf("loudness target %q: %w", s, err)
+		}
+		*dst[i] = v
+	}
+	// ranges accepted by the loudnorm filter
+	if t.I < -70 || t.I > -5 || t.TP < -9 || t.TP > 0 || t.LRA < 1 || t.LRA > 50 {
+		return nil, fmt.Errorf("loudness target %q out of range (I -70..-5, TP -9..0, LRA 1..50)", s)
+	}
+	return &t, nil
+}
+
+func (t LoudnessTarget) filter() string {
+	return fmt.Sprintf("loudnorm=I=%g:TP=%g:LRA=%g", t.I, t.TP, t.LRA)
+}
+
+// LinearFilter is the second-pass loudnorm filter that applies the gain
+// derived from the first-pass measurement.
+func (t LoudnessTarget) LinearFilter(measured *LoudnormStats) string {
+	return fmt.Sprintf("%s:measured_I=%g:measured_TP=%g:measured_LRA=%g:measured_thresh=%g:offset=%g:linear=true",
+		t.filter(), measured.InputI, measured.InputTP, measured.InputLRA, measured.InputThresh, measured.TargetOffset)
+}
+
+// LoudnormStats is the JSON block loudnorm prints with print_format=json.
+// In the measurement pass only the input_* values are meaningful.
+type LoudnormStats struct {
+	InputI            float64 `json:"input_i"`
+	InputTP           float64 `json:"input_tp"`
+	InputLRA          float64 `json:"input_lra"`
+	InputThresh       float64 `json:"input_thresh"`
+	OutputI           float64 `json:"output_i"`
+	OutputTP          float64 `json:"output_tp"`
+	OutputLRA         float64 `json:"output_lra"`
+	OutputThresh      float64 `json:"output_thresh"`
+	NormalizationType string  `json:"normalization_type"`
+	TargetOffset      float64 `json:"target_offset"`
+}
+
+// UnmarshalJSON accepts loudnorm's string-encoded numbers ("-23.45", "-inf").
+func (s *LoudnormStats) UnmarshalJSON(b []byte) error {
+	var raw map[string]string
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	num := func(k string) float64 {
+		v, err := strconv.ParseFloat(raw[k], 64)
+		if err != nil {
+			return 0
+		}
+		return v
+	}
+	*s = LoudnormStats{
+		InputI:            num("input_i"),
+		InputTP:           num("input_tp"),
+		InputLRA:          num("input_lra"),
+		InputThresh:       num("input_thresh"),
+		OutputI:           num("output_i"),
+		OutputTP:          num("output_tp"),
+		OutputLRA:         num("output_lra"),
+		OutputThresh:      num("output_thresh"),
+		NormalizationType: raw["normalization_type"],
+		TargetOffset:      num("target_offset"),
+	}
+	return nil
+}
+
+// LoudnormMeasurement is what a measurement pass says about the input.
+type LoudnormMeasurement struct {
+	InputI      float64 `json:"input_i"`
+	InputTP     float64 `json:"input_tp"`
+	InputLRA    float64 `json:"input_lra"`
+	InputThresh float64 `json:"input_thresh"`
+}
+
+// Measurement drops the output_* figures of a measurement pass, which
+// describe a dynamic normalization that never ran.
+func (s *LoudnormStats) Measurement() LoudnormMeasurement {
+	return LoudnormMeasurement{InputI: s.InputI, InputTP: s.InputTP, InputLRA: s.InputLRA, InputThresh: s.InputThresh}
+}
+
+// ErrSilent is returned when the input has no measurable loudness.
+var ErrSilent = errors.New("input is silent; loudness cannot be normalized")
+
+// floor replaces loudnorm's "-inf" (digital silence) with a finite value so
+// the stats stay JSON-encodable.
+func floor(v float64) float64 {
+	if math.IsInf(v, -1) || math.IsNaN(v) {
+		return -99
+	}
+	return v
+}
+
+// parseLoudnormJSON extracts the last JSON object loudnorm wrote to stderr.
+func parseLoudnormJSON(stderr string) (*LoudnormStats, error) {
+	end := strings.LastIndex(stderr, "}")
+	if end < 0 {
+		return nil, errors.New("loudnorm stats not found")
+	}
+	start := strings.LastIndex(stderr[:end], "{")
+	if start < 0 {
+		return nil, errors.New("loudnorm stats not found")
+	}
+	var st LoudnormStats
+	if err := json.Unmarshal([]byte(stderr[start:end+1]), &st); err != nil {
+		return nil, fmt.Errorf("loudnorm stats: %w", err)
+	}
+	if math.IsInf(st.InputI, 0) || math.IsNaN(st.InputI) {
+		return nil, ErrSilent
+	}
+	for _, v := range []*float64{&st.InputTP, &st.InputLRA, &st.InputThresh, &st.OutputI, &st.OutputTP, &st.OutputLRA, &st.OutputThresh, &st.TargetOffset} {
+		*v = floor(*v)
+	}
+	return &st, nil
+}
+
+// MeasureLoudnorm runs the first loudnorm pass against target and returns
+// the measured input loudness, true peak, range and gating threshold.
+func MeasureLoudnorm(ctx context.Context, inputPath string, target LoudnessTarget) (*LoudnormStats, error) {
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-hide_banner", "-nostats",
+		"-i", inputPath,
+		"-vn",
+		"-af", target.filter()+":print_format=json",
+		"-f", "null", "-",
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg loudnorm measure error: %w | stderr: %s", err, stderr.String())
+	}
+	return parseLoudnormJSON(stderr.String())
+}
+
+// NormalizeProfile is the second loudnorm pass: it feeds the measurement
+// into a linear normalization and encodes the result with profile p.
+// loudnorm resamples to 192 kHz internally, so the output is set back to the
+// profile's rate or, when the profile keeps the source rate, to sourceRate.
+// The returned stats carry the filter's before/after figures; when a linear
+// gain would exceed the true-peak limit ffmpeg falls back to dynamic mode and
+// reports it in NormalizationType.
+func NormalizeProfile(ctx context.Context, inputPath, outputPath string, p Profile, target LoudnessTarget, measured *LoudnormStats, sourceRate int) (*LoudnormStats, error) {
+	filter := target.LinearFilter(measured) + ":print_format=json"
+
+	args := []string{"-hide_banner", "-nostats", "-y", "-i", inputPath, "-vn", "-af", filter}
+	args = append(args, p.EncodeArgs()...)
+	if p.SampleRate == 0 && sourceRate > 0 {
+		args = append(args, "-ar", strconv.Itoa(sourceRate))
+	}
+	args = append(args, outputPath)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg normalize (%s) error: %w | stderr: %s", p.Name, err, stderr.String())
+	}
+	return parseLoudnormJSON(stderr.String())
+}
@@ -0,0 +1,63 @@
+package audio
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseLoudnessTarget(t *testing.T) {
+	if tg, err := ParseLoudnessTarget(""); err != nil || tg != nil {
+		t.Fatalf("empty target: got %v, %v", tg, err)
+	}
+	tg, err := ParseLoudnessTarget("Podcast")
+	if err != nil || tg.I != -16 || tg.TP != -1.5 {
+		t.Fatalf("podcast: got %+v, %v", tg, err)
+	}
+	tg, err = ParseLoudnessTarget("custom:-18:-2")
+	if err != nil || tg.I != -18 || tg.TP != -2 || tg.LRA != 11 {
+		t.Fatalf("custom: got %+v, %v", tg, err)
+	}
+	for _, bad := range []string{"loud", "custom:", "custom:-3", "custom:-18:-1:9:1"} {
+		if _, err := ParseLoudnessTarget(bad); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+}
+
+func TestParseLoudnormJSON(t *testing.T) {
+	stderr := `Input #0, wav, from 'in.wav':
+[Parsed_loudnorm_0 @ 0x55d0c8a3c2c0]
+{
+	"input_i" : "-27.61",
+	"input_tp" : "-4.47",
+	"input_lra" : "18.06",
+	"input_thresh" : "-39.20",
+	"output_i" : "-16.58",
+	"output_tp" : "-1.50",
+	"output_lra" : "14.78",
+	"output_thresh" : "-27.71",
+	"normalization_type" : "dynamic",
+	"target_offset" : "0.58"
+}
+`
+	st, err := parseLoudnormJSON(stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.InputI != -27.61 || st.InputThresh != -39.2 || st.TargetOffset != 0.58 || st.NormalizationType != "dynamic" {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+	before, err := json.Marshal(st.Measurement())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"input_i":-27.61,"input_tp":-4.47,"input_lra":18.06,"input_thresh":-39.2}`; string(before) != want {
+		t.Fatalf("measurement: got %s, want %s", before, want)
+	}
+
+	silent := `{ "input_i" : "-inf", "input_tp" : "-inf", "input_lra" : "0.00", "input_thresh" : "-inf" }`
+	if _, err := parseLoudnormJSON(silent); !errors.Is(err, ErrSilent) {
+		t.Fatalf("silent input: got %v", err)
+	}
+}
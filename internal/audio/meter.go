@@ -0,0 +1,408 @@
+package audio
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+// Loudness measurement per ITU-R BS.1770-4 with the EBU Tech 3341/3342
+// momentary, short-term and loudness-range definitions.
+
+const (
+	// SilenceFloor stands in for -Inf (digital silence or nothing above the
+	// gates) so results stay JSON-encodable.
+	SilenceFloor = -120.0
+
+	absoluteGate    = -70.0 // LUFS
+	integratedGate  = -10.0 // LU below the absolute-gated level
+	rangeGate       = -20.0 // LU below the absolute-gated short-term level
+	momentaryChunks = 4     // 400 ms
+	shortTermChunks = 30    // 3 s
+	chunkDuration   = 100 * time.Millisecond
+	truePeakTaps    = 16 // interpolation filter taps per phase
+)
+
+// LoudnessStats is the result of a BS.1770 measurement. Curves hold one value
+// per CurveInterval; a curve point at index i covers the window ending at
+// (i+1)*CurveInterval, zero-padded at the start.
+type LoudnessStats struct {
+	Integrated    float64   `json:"integrated_lufs"`
+	Range         float64   `json:"loudness_range_lu"`
+	TruePeak      float64   `json:"true_peak_dbtp"`
+	SamplePeak    float64   `json:"sample_peak_dbfs"`
+	MaxMomentary  float64   `json:"max_momentary_lufs"`
+	MaxShortTerm  float64   `json:"max_short_term_lufs"`
+	Duration      float64   `json:"duration_seconds"`
+	CurveInterval float64   `json:"curve_interval_seconds"`
+	Momentary     []float64 `json:"momentary,omitempty"`
+	ShortTerm     []float64 `json:"short_term,omitempty"`
+}
+
+// Decimate returns a copy whose curves keep one point per step (a multiple
+// of the measurement interval), e.g. to store a 1 s short-term curve.
+func (s *LoudnessStats) Decimate(step time.Duration) *LoudnessStats {
+	out := *s
+	k := int(math.Round(step.Seconds() / s.CurveInterval))
+	if k <= 1 {
+		return &out
+	}
+	pick := func(v []float64) []float64 {
+		if v == nil {
+			return nil
+		}
+		r := make([]float64, 0, len(v)/k+1)
+		for i := k - 1; i < len(v); i += k {
+			r = append(r, v[i])
+		}
+		return r
+	}
+	out.Momentary = pick(s.Momentary)
+	out.ShortTerm = pick(s.ShortTerm)
+	out.CurveInterval = s.CurveInterval * float64(k)
+	return &out
+}
+
+// biquad is a transposed direct form II second-order section.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.z1
+	f.z1 = f.b1*x - f.a1*y + f.z2
+	f.z2 = f.b2*x - f.a2*y
+	return y
+}
+
+// kWeighting returns the BS.1770 pre-filter (high shelf) and RLB high-pass,
+// derived for sampleRate the same way libebur128 does so rates other than
+// 48 kHz match the reference response.
+func kWeighting(sampleRate int) (shelf, highpass biquad) {
+	fs := float64(sampleRate)
+
+	f0, g, q := 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / fs)
+	vh := math.Pow(10, g/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf = biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	f0, q = 38.13547087602444, 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / fs)
+	a0 = 1 + k/q + k*k
+	highpass = biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	return shelf, highpass
+}
+
+// channelWeights follows BS.1770 for ffmpeg's 5.0/5.1 layouts (surrounds
+// +1.5 dB, LFE excluded); every other layout weighs all channels equally.
+func channelWeights(channels int) []float64 {
+	w := make([]float64, channels)
+	for i := range w {
+		w[i] = 1
+	}
+	switch channels {
+	case 5: // FL FR FC BL BR
+		w[3], w[4] = 1.41, 1.41
+	case 6: // FL FR FC LFE BL BR
+		w[3], w[4], w[5] = 0, 1.41, 1.41
+	}
+	return w
+}
+
+// LoudnessMeter accumulates interleaved float PCM and computes BS.1770
+// loudness, loudness range and true peak. It is not safe for concurrent use.
+type LoudnessMeter struct {
+	rate, channels int
+	weights        []float64
+	filters        [][2]biquad
+
+	chunkFrames int
+	chunkSum    float64 // channel-weighted sum of squared K-weighted samples
+	chunkN      int
+	chunks      []float64 // mean square per 100 ms chunk
+	frames      int64
+
+	tp         *truePeakMeter
+	samplePeak float64
+}
+
+// NewLoudnessMeter returns a meter for PCM at sampleRate with the given
+// channel count.
+func NewLoudnessMeter(sampleRate, channels int) *LoudnessMeter {
+	m := &LoudnessMeter{
+		rate:        sampleRate,
+		channels:    channels,
+		weights:     channelWeights(channels),
+		filters:     make([][2]biquad, channels),
+		chunkFrames: int(math.Round(float64(sampleRate) * chunkDuration.Seconds())),
+		tp:          newTruePeakMeter(sampleRate, channels),
+	}
+	shelf, hp := kWeighting(sampleRate)
+	for c := range m.filters {
+		m.filters[c] = [2]biquad{shelf, hp}
+	}
+	return m
+}
+
+// Write feeds interleaved samples; a trailing partial frame is ignored.
+func (m *LoudnessMeter) Write(samples []float32) {
+	frames := len(samples) / m.channels
+	for f := 0; f < frames; f++ {
+		frame := samples[f*m.channels : (f+1)*m.channels]
+		var sum float64
+		for c, s := range frame {
+			x := float64(s)
+			if a := math.Abs(x); a > m.samplePeak {
+				m.samplePeak = a
+			}
+			y := m.filters[c][0].process(x)
+			y = m.filters[c][1].process(y)
+			sum += m.weights[c] * y * y
+		}
+		m.tp.write(frame)
+
+		m.chunkSum += sum
+		m.chunkN++
+		if m.chunkN == m.chunkFrames {
+			m.chunks = append(m.chunks, m.chunkSum/float64(m.chunkFrames))
+			m.chunkSum, m.chunkN = 0, 0
+		}
+	}
+	m.frames += int64(frames)
+}
+
+// Result computes the statistics for everything written so far.
+func (m *LoudnessMeter) Result() *LoudnessStats {
+	st := &LoudnessStats{
+		Duration:      float64(m.frames) / float64(m.rate),
+		CurveInterval: chunkDuration.Seconds(),
+		TruePeak:      toDB(m.tp.peak),
+		SamplePeak:    toDB(m.samplePeak),
+		MaxMomentary:  SilenceFloor,
+		MaxShortTerm:  SilenceFloor,
+	}
+	if st.TruePeak < st.SamplePeak {
+		// the interpolator can only undershoot through ripple; a true peak
+		// is never below the sample peak
+		st.TruePeak = st.SamplePeak
+	}
+
+	st.Momentary = make([]float64, len(m.chunks))
+	st.ShortTerm = make([]float64, len(m.chunks))
+	var blocks, shortTerm []float64 // mean squares of complete windows
+	for i := range m.chunks {
+		mz := windowMean(m.chunks, i, momentaryChunks)
+		sz := windowMean(m.chunks, i, shortTermChunks)
+		st.Momentary[i] = round2(lufs(mz))
+		st.ShortTerm[i] = round2(lufs(sz))
+		st.MaxMomentary = math.Max(st.MaxMomentary, st.Momentary[i])
+		st.MaxShortTerm = math.Max(st.MaxShortTerm, st.ShortTerm[i])
+		if i >= momentaryChunks-1 {
+			blocks = append(blocks, mz)
+		}
+		if i >= shortTermChunks-1 {
+			shortTerm = append(shortTerm, sz)
+		}
+	}
+
+	st.Integrated = gatedLoudness(blocks)
+	st.Range = loudnessRange(shortTerm)
+	return st
+}
+
+// windowMean is the mean of the n chunks ending at i, zero-padded before 0.
+func windowMean(chunks []float64, i, n int) float64 {
+	var sum float64
+	for j := i - n + 1; j <= i; j++ {
+		if j >= 0 {
+			sum += chunks[j]
+		}
+	}
+	return sum / float64(n)
+}
+
+// gatedLoudness applies the absolute and relative gates of BS.1770-4 to the
+// 400 ms block energies and returns the integrated loudness.
+func gatedLoudness(blocks []float64) float64 {
+	mean := func(gate float64) (float64, int) {
+		var sum float64
+		var n int
+		for _, z := range blocks {
+			if lufs(z) > gate {
+				sum += z
+				n++
+			}
+		}
+		if n == 0 {
+			return 0, 0
+		}
+		return sum / float64(n), n
+	}
+	abs, n := mean(absoluteGate)
+	if n == 0 {
+		return SilenceFloor
+	}
+	rel, n := mean(math.Max(absoluteGate, lufs(abs)+integratedGate))
+	if n == 0 {
+		return SilenceFloor
+	}
+	return round2(lufs(rel))
+}
+
+// loudnessRange implements EBU Tech 3342: the spread between the 10th and
+// 95th percentile of the gated short-term loudness distribution.
+func loudnessRange(shortTerm []float64) float64 {
+	var sum float64
+	var gated []float64
+	for _, z := range shortTerm {
+		if lufs(z) > absoluteGate {
+			sum += z
+			gated = append(gated, z)
+		}
+	}
+	if len(gated) == 0 {
+		return 0
+	}
+	rel := lufs(sum/float64(len(gated))) + rangeGate
+	var values []float64
+	for _, z := range gated {
+		if l := lufs(z); l > rel {
+			values = append(values, l)
+		}
+	}
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	at := func(p float64) float64 {
+		return values[int(math.Round(float64(len(values)-1)*p))]
+	}
+	return round2(at(0.95) - at(0.10))
+}
+
+// lufs converts a channel-weighted mean square to loudness.
+func lufs(z float64) float64 {
+	if z <= 0 {
+		return SilenceFloor
+	}
+	return math.Max(SilenceFloor, -0.691+10*math.Log10(z))
+}
+
+func toDB(amplitude float64) float64 {
+	if amplitude <= 0 {
+		return SilenceFloor
+	}
+	return round2(math.Max(SilenceFloor, 20*math.Log10(amplitude)))
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// truePeakMeter estimates inter-sample peaks by polyphase windowed-sinc
+// oversampling (4x below 96 kHz, 2x below 192 kHz) as BS.1770-4 Annex 2
+// recommends.
+type truePeakMeter struct {
+	factor int
+	coef   [][]float64 // [phase][tap]
+	hist   [][]float64 // per channel, 2*taps with mirrored writes
+	pos    int
+	peak   float64
+}
+
+func newTruePeakMeter(sampleRate, channels int) *truePeakMeter {
+	factor := 4
+	switch {
+	case sampleRate >= 192000:
+		factor = 1
+	case sampleRate >= 96000:
+		factor = 2
+	}
+	t := &truePeakMeter{factor: factor, hist: make([][]float64, channels)}
+	for c := range t.hist {
+		t.hist[c] = make([]float64, 2*truePeakTaps)
+	}
+	// Hann-windowed sinc centred on a tap of phase 0, so phase 0 reproduces
+	// the input samples and the other phases interpolate between them.
+	length := factor * truePeakTaps
+	center := float64(length / 2)
+	t.coef = make([][]float64, factor)
+	for p := range t.coef {
+		t.coef[p] = make([]float64, truePeakTaps)
+		for k := range t.coef[p] {
+			n := float64(k*factor + p)
+			x := (n - center) / float64(factor)
+			w := 0.5 - 0.5*math.Cos(2*math.Pi*n/float64(length))
+			t.coef[p][k] = sinc(x) * w
+		}
+	}
+	return t
+}
+
+func (t *truePeakMeter) write(frame []float32) {
+	t.pos = (t.pos + 1) % truePeakTaps
+	for c, s := range frame {
+		x := float64(s)
+		h := t.hist[c]
+		h[t.pos], h[t.pos+truePeakTaps] = x, x
+		if a := math.Abs(x); a > t.peak {
+			t.peak = a
+		}
+		// window[taps-1] is the newest sample
+		window := h[t.pos+1 : t.pos+1+truePeakTaps]
+		for p := 1; p < t.factor; p++ {
+			var y float64
+			for k, cf := range t.coef[p] {
+				y += cf * window[truePeakTaps-1-k]
+			}
+			if a := math.Abs(y); a > t.peak {
+				t.peak = a
+			}
+		}
+	}
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// MeasureLoudness decodes the first audio stream of path through ffmpeg and
+// runs it through a LoudnessMeter at the stream's native rate and layout.
+func MeasureLoudness(ctx context.Context, path string) (*LoudnessStats, error) {
+	info, err := ProbeStream(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if info.SampleRate <= 0 || info.Channels <= 0 {
+		return nil, errors.New("cannot determine sample rate or channel count")
+	}
+	m := NewLoudnessMeter(info.SampleRate, info.Channels)
+	format := PCMFormat{SampleRate: info.SampleRate, Channels: info.Channels}
+	if err := DecodePCM(ctx, path, format, func(samples []float32) error {
+		m.Write(samples)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return m.Result(), nil
+}
@@ -0,0 +1,82 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+// sine returns seconds of an interleaved sine at freq with the given peak
+// amplitude on the selected channels (others silent).
+func sine(rate, channels int, freq, amp, seconds float64, on ...int) []float32 {
+	frames := int(float64(rate) * seconds)
+	out := make([]float32, frames*channels)
+	for i := 0; i < frames; i++ {
+		v := float32(amp * math.Sin(2*math.Pi*freq*float64(i)/float64(rate)))
+		for _, c := range on {
+			out[i*channels+c] = v
+		}
+	}
+	return out
+}
+
+func near(t *testing.T, name string, got, want, tol float64) {
+	t.Helper()
+	if math.Abs(got-want) > tol {
+		t.Errorf("%s = %.3f, want %.3f ± %.2f", name, got, want, tol)
+	}
+}
+
+// BS.1770-4 calibration: a 0 dBFS 1 kHz sine in one channel reads -3.01 LKFS,
+// as does the same power split over both channels.
+func TestLoudnessMeterReferenceTone(t *testing.T) {
+	for _, rate := range []int{44100, 48000} {
+		m := NewLoudnessMeter(rate, 2)
+		m.Write(sine(rate, 2, 1000, 1, 5, 0))
+		st := m.Result()
+		near(t, "integrated", st.Integrated, -3.01, 0.05)
+		near(t, "true peak", st.TruePeak, 0, 0.1)
+		near(t, "range", st.Range, 0, 0.1)
+		near(t, "duration", st.Duration, 5, 0.001)
+		if len(st.ShortTerm) != 50 {
+			t.Errorf("short-term curve has %d points, want 50", len(st.ShortTerm))
+		}
+		near(t, "last short-term", st.ShortTerm[len(st.ShortTerm)-1], -3.01, 0.05)
+	}
+
+	m := NewLoudnessMeter(48000, 2)
+	m.Write(sine(48000, 2, 1000, math.Sqrt(0.5), 5, 0, 1))
+	near(t, "stereo -3 dBFS", m.Result().Integrated, -3.01, 0.05)
+}
+
+func TestLoudnessMeterGatingAndRange(t *testing.T) {
+	// 10 s at -20 LUFS followed by 10 s at -30 LUFS: both pass the relative
+	// gate, so the range is ~10 LU and the integrated value sits in between.
+	m := NewLoudnessMeter(48000, 1)
+	amp := func(l float64) float64 { return math.Pow(10, (l+3.01)/20) }
+	m.Write(sine(48000, 1, 1000, amp(-20), 10, 0))
+	m.Write(sine(48000, 1, 1000, amp(-30), 10, 0))
+	st := m.Result()
+	near(t, "range", st.Range, 10, 0.3)
+	near(t, "integrated", st.Integrated, -22.6, 0.2)
+
+	silent := NewLoudnessMeter(48000, 1)
+	silent.Write(make([]float32, 48000))
+	if got := silent.Result().Integrated; got != SilenceFloor {
+		t.Errorf("silence integrated = %v, want %v", got, SilenceFloor)
+	}
+}
+
+func TestTruePeakInterSample(t *testing.T) {
+	// fs/4 sine with a 45° phase offset: every sample sits at 0.707 of the
+	// peak, so the sample peak reads -3 dB while the true peak is 0 dBTP.
+	rate := 48000
+	out := make([]float32, rate)
+	for i := range out {
+		out[i] = float32(math.Sin(math.Pi/2*float64(i) + math.Pi/4))
+	}
+	m := NewLoudnessMeter(rate, 1)
+	m.Write(out)
+	st := m.Result()
+	near(t, "sample peak", st.SamplePeak, -3.01, 0.05)
+	near(t, "true peak", st.TruePeak, 0, 0.3)
+}
@@ -0,0 +1,167 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rendition is one rung of the adaptive streaming ladder, named
+// "<codec>-<kbps>" like the file profiles (e.g. "aac-128", "opus-96").
+type Rendition struct {
+	Name    string `json:"name"`
+	Codec   string `json:"codec"` // "aac" or "opus"
+	Bitrate int    `json:"bitrate_kbps"`
+}
+
+// DefaultLadder is packaged when no ladder is configured.
+var DefaultLadder = []Rendition{
+	{Name: "aac-64", Codec: "aac", Bitrate: 64},
+	{Name: "aac-128", Codec: "aac", Bitrate: 128},
+	{Name: "aac-256", Codec: "aac", Bitrate: 256},
+	{Name: "opus-64", Codec: "opus", Bitrate: 64},
+	{Name: "opus-128", Codec: "opus", Bitrate: 128},
+}
+
+// streamSampleRate is used for every rendition so segments of different
+// codecs line up; Opus only supports 48 kHz anyway.
+const streamSampleRate = 48000
+
+// Manifest file names written by PackageStreams.
+const (
+	HLSMasterName    = "master.m3u8"
+	DASHManifestName = "manifest.mpd"
+)
+
+// ParseLadder parses a comma separated list of renditions; an empty list
+// yields DefaultLadder. Renditions are ordered by codec, then bitrate.
+func ParseLadder(list string) ([]Rendition, error) {
+	if strings.TrimSpace(list) == "" {
+		return DefaultLadder, nil
+	}
+	var out []Rendition
+	seen := map[string]bool{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		codec, kbps, ok := strings.Cut(name, "-")
+		br, err := strconv.Atoi(kbps)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("rendition %q: want <codec>-<kbps>", name)
+		}
+		switch {
+		case codec == "aac" && br >= 32 && br <= 320:
+		case codec == "opus" && br >= 16 && br <= 256:
+		default:
+			return nil, fmt.Errorf("rendition %q: unsupported codec or bitrate (aac 32-320, opus 16-256)", name)
+		}
+		seen[name] = true
+		out = append(out, Rendition{Name: name, Codec: codec, Bitrate: br})
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Codec != out[j].Codec {
+			return out[i].Codec < out[j].Codec
+		}
+		return out[i].Bitrate < out[j].Bitrate
+	})
+	return out, nil
+}
+
+// PackageOptions tunes PackageStreams.
+type PackageOptions struct {
+	SegmentDuration time.Duration // default 6s
+	// Filter is an optional audio filter applied to every rendition, e.g. a
+	// LoudnessTarget.LinearFilter.
+	Filter string
+}
+
+// PackageStreams encodes inputPath into every rendition in one ffmpeg run
+// and segments them as fragmented MP4. It writes a DASH manifest
+// (DASHManifestName) and, over the same segments, an HLS master playlist
+// (HLSMasterName) with one media playlist per rendition. It returns the
+// names of all files written to outDir.
+func PackageStreams(ctx context.Context, inputPath, outDir string, ladder []Rendition, opts PackageOptions) ([]string, error) {
+	if len(ladder) == 0 {
+		return nil, fmt.Errorf("empty rendition ladder")
+	}
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, "ffmpeg", packageArgs(inputPath, outDir, ladder, opts)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg package error: %w | stderr: %s", err, stderr.String())
+	}
+	entries, err := os.ReadDir(outDir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			files = append(files, e.Name())
+		}
+	}
+	return files, nil
+}
+
+func packageArgs(inputPath, outDir string, ladder []Rendition, opts PackageOptions) []string {
+	seg := opts.SegmentDuration
+	if seg <= 0 {
+		seg = 6 * time.Second
+	}
+	args := []string{"-hide_banner", "-nostats", "-y", "-i", inputPath, "-vn"}
+	if opts.Filter != "" {
+		args = append(args, "-af", opts.Filter)
+	}
+	// one output stream per rendition, grouped into an adaptation set per
+	// codec since a DASH AdaptationSet must not mix codecs
+	sets := map[string][]string{}
+	var codecs []string
+	for i, r := range ladder {
+		n := strconv.Itoa(i)
+		encoder := r.Codec
+		if r.Codec == "opus" {
+			encoder = "libopus"
+		}
+		args = append(args,
+			"-map", "0:a:0",
+			"-c:a:"+n, encoder,
+			"-b:a:"+n, strconv.Itoa(r.Bitrate)+"k",
+		)
+		if sets[r.Codec] == nil {
+			codecs = append(codecs, r.Codec)
+		}
+		sets[r.Codec] = append(sets[r.Codec], n)
+	}
+	var adaptation []string
+	for i, c := range codecs {
+		adaptation = append(adaptation, fmt.Sprintf("id=%d,streams=%s", i, strings.Join(sets[c], ",")))
+	}
+	args = append(args,
+		"-ar", strconv.Itoa(streamSampleRate),
+		"-ac", "2",
+		// Opus in MP4 is still flagged experimental in older ffmpeg builds
+		"-strict", "experimental",
+		"-f", "dash",
+		"-seg_duration", strconv.FormatFloat(seg.Seconds(), 'f', -1, 64),
+		"-use_template", "1",
+		"-use_timeline", "1",
+		"-adaptation_sets", strings.Join(adaptation, " "),
+		"-init_seg_name", "init-$RepresentationID$.m4s",
+		"-media_seg_name", "chunk-$RepresentationID$-$Number%05d$.m4s",
+		"-hls_playlist", "1",
+		"-hls_master_name", HLSMasterName,
+		outDir+"/"+DASHManifestName,
+	)
+	return args
+}
@@ -0,0 +1,42 @@
+package audio
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLadder(t *testing.T) {
+	l, err := ParseLadder("")
+	require.NoError(t, err)
+	require.Equal(t, DefaultLadder, l)
+
+	l, err = ParseLadder("opus-96, AAC-192,aac-64,opus-96")
+	require.NoError(t, err)
+	require.Equal(t, []Rendition{
+		{Name: "aac-64", Codec: "aac", Bitrate: 64},
+		{Name: "aac-192", Codec: "aac", Bitrate: 192},
+		{Name: "opus-96", Codec: "opus", Bitrate: 96},
+	}, l)
+
+	for _, bad := range []string{"mp3-128", "aac", "aac-x", "opus-512"} {
+		_, err := ParseLadder(bad)
+		require.Error(t, err, bad)
+	}
+}
+
+func TestPackageArgs(t *testing.T) {
+	args := strings.Join(packageArgs("in.wav", "/tmp/out", DefaultLadder, PackageOptions{
+		SegmentDuration: 4 * time.Second,
+		Filter:          "loudnorm=I=-16",
+	}), " ")
+	require.Contains(t, args, "-af loudnorm=I=-16")
+	require.Contains(t, args, "-c:a:0 aac -b:a:0 64k")
+	require.Contains(t, args, "-c:a:4 libopus -b:a:4 128k")
+	require.Contains(t, args, "-adaptation_sets id=0,streams=0,1,2 id=1,streams=3,4")
+	require.Contains(t, args, "-seg_duration 4")
+	require.True(t, strings.HasSuffix(args, "-hls_master_name master.m3u8 /tmp/out/manifest.mpd"))
+	require.Equal(t, 5, strings.Count(args, "-map 0:a:0"))
+}
@@ -0,0 +1,87 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+	"strconv"
+)
+
+// PCMFormat is the layout DecodePCM resamples/remixes to.
+type PCMFormat struct {
+	SampleRate int
+	Channels   int
+}
+
+// pcmFramesPerRead bounds the slice handed to DecodePCM callbacks.
+const pcmFramesPerRead = 4096
+
+// DecodePCM streams the first audio stream of path as interleaved float32
+// samples in format f, calling fn for each block as ffmpeg produces it. The
+// slice is reused between calls. An error from fn stops ffmpeg and is
+// returned as is.
+func DecodePCM(ctx context.Context, path string, f PCMFormat, fn func(samples []float32) error) error {
+	if f.SampleRate <= 0 || f.Channels <= 0 {
+		return errors.New("pcm format needs a sample rate and channel count")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-hide_banner", "-nostats", "-v", "error",
+		"-i", path,
+		"-map", "0:a:0", "-vn",
+		"-f", "f32le", "-acodec", "pcm_f32le",
+		"-ar", strconv.Itoa(f.SampleRate),
+		"-ac", strconv.Itoa(f.Channels),
+		"-",
+	)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("ffmpeg decode start: %w", err)
+	}
+
+	frameBytes := 4 * f.Channels
+	buf := make([]byte, pcmFramesPerRead*frameBytes)
+	samples := make([]float32, pcmFramesPerRead*f.Channels)
+	var cbErr error
+	for {
+		n, rerr := io.ReadFull(stdout, buf)
+		n -= n % frameBytes
+		if n > 0 {
+			out := samples[:n/4]
+			for i := range out {
+				out[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[i*4:]))
+			}
+			if cbErr = fn(out); cbErr != nil {
+				cancel()
+				break
+			}
+		}
+		if rerr != nil {
+			if rerr != io.EOF && rerr != io.ErrUnexpectedEOF {
+				cbErr = rerr
+				cancel()
+			}
+			break
+		}
+	}
+	werr := cmd.Wait()
+	if cbErr != nil {
+		return cbErr
+	}
+	if werr != nil {
+		return fmt.Errorf("ffmpeg decode error: %w | stderr: %s", werr, stderr.String())
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+package audio
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// DefaultPeakZooms are the samples-per-pixel resolutions generated per upload.
+var DefaultPeakZooms = []int{256, 512, 2048}
+
+// peaksVersion is the audiowaveform data format version we read and write
+// (version 2 carries a channel count).
+const peaksVersion = 2
+
+// Peaks is min/max waveform data compatible with BBC audiowaveform's JSON and
+// binary (.dat) formats. Data holds, for each pixel and then each channel, a
+// min and a max value in the range of Bits (8 or 16).
+type Peaks struct {
+	SampleRate      int
+	SamplesPerPixel int
+	Channels        int
+	Bits            int
+	Data            []int16
+}
+
+// Length is the number of pixels.
+func (p *Peaks) Length() int {
+	if p.Channels == 0 {
+		return 0
+	}
+	return len(p.Data) / (2 * p.Channels)
+}
+
+// WithBits returns p requantized to 8 or 16 bits.
+func (p *Peaks) WithBits(bits int) (*Peaks, error) {
+	if bits != 8 && bits != 16 {
+		return nil, fmt.Errorf("unsupported bit depth %d (8 or 16)", bits)
+	}
+	if bits == p.Bits {
+		return p, nil
+	}
+	out := *p
+	out.Bits = bits
+	out.Data = make([]int16, len(p.Data))
+	for i, v := range p.Data {
+		if bits == 8 {
+			out.Data[i] = v >> 8
+		} else {
+			out.Data[i] = v << 8
+		}
+	}
+	return &out, nil
+}
+
+// MarshalJSON encodes the audiowaveform JSON format.
+func (p *Peaks) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Version         int     `json:"version"`
+		Channels        int     `json:"channels"`
+		SampleRate      int     `json:"sample_rate"`
+		SamplesPerPixel int     `json:"samples_per_pixel"`
+		Bits            int     `json:"bits"`
+		Length          int     `json:"length"`
+		Data            []int16 `json:"data"`
+	}{peaksVersion, p.Channels, p.SampleRate, p.SamplesPerPixel, p.Bits, p.Length(), p.Data})
+}
+
+// peaksHeader is the little-endian header of the binary format.
+type peaksHeader struct {
+	Version         int32
+	Flags           uint32 // bit 0 set: 8-bit data
+	SampleRate      int32
+	SamplesPerPixel int32
+	Length          uint32
+	Channels        int32
+}
+
+// WriteBinary encodes the audiowaveform binary (.dat) format.
+func (p *Peaks) WriteBinary(w io.Writer) error {
+	h := peaksHeader{
+		Version:         peaksVersion,
+		SampleRate:      int32(p.SampleRate),
+		SamplesPerPixel: int32(p.SamplesPerPixel),
+		Length:          uint32(p.Length()),
+		Channels:        int32(p.Channels),
+	}
+	if p.Bits == 8 {
+		h.Flags = 1
+	}
+	bw := bufio.NewWriter(w)
+	if err := binary.Write(bw, binary.LittleEndian, h); err != nil {
+		return err
+	}
+	if p.Bits == 8 {
+		b := make([]byte, len(p.Data))
+		for i, v := range p.Data {
+			b[i] = byte(int8(v))
+		}
+		if _, err := bw.Write(b); err != nil {
+			return err
+		}
+	} else if err := binary.Write(bw, binary.LittleEndian, p.Data); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// ReadPeaks decodes the audiowaveform binary format (versions 1 and 2).
+func ReadPeaks(r io.Reader) (*Peaks, error) {
+	br := bufio.NewReader(r)
+	var version int32
+	if err := binary.Read(br, binary.LittleEndian, &version); err != nil {
+		return nil, fmt.Errorf("peaks header: %w", err)
+	}
+	if version != 1 && version != 2 {
+		return nil, fmt.Errorf("unsupported peaks version %d", version)
+	}
+	var rest struct {
+		Flags           uint32
+		SampleRate      int32
+		SamplesPerPixel int32
+		Length          uint32
+	}
+	if err := binary.Read(br, binary.LittleEndian, &rest); err != nil {
+		return nil, fmt.Errorf("peaks header: %w", err)
+	}
+	channels := int32(1)
+	if version == 2 {
+		if err := binary.Read(br, binary.LittleEndian, &channels); err != nil {
+			return nil, fmt.Errorf("peaks header: %w", err)
+		}
+	}
+	if channels < 1 || channels > 24 {
+		return nil, fmt.Errorf("bad peaks channel count %d", channels)
+	}
+	p := &Peaks{
+		SampleRate:      int(rest.SampleRate),
+		SamplesPerPixel: int(rest.SamplesPerPixel),
+		Channels:        int(channels),
+		Bits:            16,
+		Data:            make([]int16, int(rest.Length)*2*int(channels)),
+	}
+	if rest.Flags&1 != 0 {
+		p.Bits = 8
+		b := make([]byte, len(p.Data))
+		if _, err := io.ReadFull(br, b); err != nil {
+			return nil, fmt.Errorf("peaks data: %w", err)
+		}
+		for i, v := range b {
+			p.Data[i] = int16(int8(v))
+		}
+		return p, nil
+	}
+	if err := binary.Read(br, binary.LittleEndian, p.Data); err != nil {
+		return nil, fmt.Errorf("peaks data: %w", err)
+	}
+	return p, nil
+}
+
+// PeaksBuilder computes 16-bit min/max peaks at several zoom levels in one
+// pass over interleaved float PCM.
+type PeaksBuilder struct {
+	channels int
+	levels   []*peakLevel
+}
+
+type peakLevel struct {
+	peaks    *Peaks
+	min, max []float32
+	n        int
+}
+
+// NewPeaksBuilder returns a builder for PCM at sampleRate with channels,
+// producing one Peaks per zoom (samples per pixel).
+func NewPeaksBuilder(sampleRate, channels int, zooms []int) *PeaksBuilder {
+	b := &PeaksBuilder{channels: channels}
+	for _, z := range zooms {
+		lv := &peakLevel{
+			peaks: &Peaks{SampleRate: sampleRate, SamplesPerPixel: z, Channels: channels, Bits: 16},
+			min:   make([]float32, channels),
+			max:   make([]float32, channels),
+		}
+		lv.reset()
+		b.levels = append(b.levels, lv)
+	}
+	return b
+}
+
+func (lv *peakLevel) reset() {
+	for c := range lv.min {
+		lv.min[c], lv.max[c] = math.MaxFloat32, -math.MaxFloat32
+	}
+	lv.n = 0
+}
+
+func (lv *peakLevel) flush() {
+	for c := range lv.min {
+		lv.peaks.Data = append(lv.peaks.Data, quantize16(lv.min[c]), quantize16(lv.max[c]))
+	}
+	lv.reset()
+}
+
+func quantize16(v float32) int16 {
+	return int16(math.Max(-32768, math.Min(32767, math.Round(float64(v)*32767))))
+}
+
+// Write feeds interleaved samples; a trailing partial frame is ignored.
+func (b *PeaksBuilder) Write(samples []float32) {
+	frames := len(samples) / b.channels
+	for _, lv := range b.levels {
+		for f := 0; f < frames; f++ {
+			for c := 0; c < b.channels; c++ {
+				v := samples[f*b.channels+c]
+				lv.min[c] = min(lv.min[c], v)
+				lv.max[c] = max(lv.max[c], v)
+			}
+			lv.n++
+			if lv.n == lv.peaks.SamplesPerPixel {
+				lv.flush()
+			}
+		}
+	}
+}
+
+// Result returns one Peaks per zoom, in the order given to NewPeaksBuilder,
+// including a final partial pixel.
+func (b *PeaksBuilder) Result() []*Peaks {
+	out := make([]*Peaks, len(b.levels))
+	for i, lv := range b.levels {
+		if lv.n > 0 {
+			lv.flush()
+		}
+		out[i] = lv.peaks
+	}
+	return out
+}
+
+// GeneratePeaks decodes inputPath at its native rate and channel layout and
+// returns peaks for each zoom level.
+func GeneratePeaks(ctx context.Context, inputPath string, zooms []int) ([]*Peaks, error) {
+	info, err := ProbeStream(ctx, inputPath)
+	if err != nil {
+		return nil, err
+	}
+	if info.SampleRate <= 0 || info.Channels <= 0 {
+		return nil, errors.New("cannot determine sample rate or channel count")
+	}
+	b := NewPeaksBuilder(info.SampleRate, info.Channels, zooms)
+	if err := DecodePCM(ctx, inputPath, PCMFormat{SampleRate: info.SampleRate, Channels: info.Channels}, func(samples []float32) error {
+		b.Write(samples)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return b.Result(), nil
+}
+
+// Zoom merges pixels into a coarser level; spp must be a multiple of
+// p.SamplesPerPixel.
+func (p *Peaks) Zoom(spp int) (*Peaks, error) {
+	if spp == p.SamplesPerPixel {
+		return p, nil
+	}
+	if spp < p.SamplesPerPixel || spp%p.SamplesPerPixel != 0 {
+		return nil, fmt.Errorf("zoom %d is not a multiple of %d", spp, p.SamplesPerPixel)
+	}
+	k := spp / p.SamplesPerPixel
+	stride := 2 * p.Channels
+	out := *p
+	out.SamplesPerPixel = spp
+	out.Data = make([]int16, 0, (p.Length()/k+1)*stride)
+	for px := 0; px < p.Length(); px += k {
+		end := min(px+k, p.Length())
+		for c := 0; c < p.Channels; c++ {
+			lo, hi := int16(math.MaxInt16), int16(math.MinInt16)
+			for i := px; i < end; i++ {
+				lo = min(lo, p.Data[i*stride+2*c])
+				hi = max(hi, p.Data[i*stride+2*c+1])
+			}
+			out.Data = append(out.Data, lo, hi)
+		}
+	}
+	return &out, nil
+}
@@ -0,0 +1,88 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestPeaksBuilderAndBinaryRoundTrip(t *testing.T) {
+	// stereo: left ramps -1..1 over 8 frames, right is constant 0.5
+	var pcm []float32
+	for i := 0; i < 10; i++ {
+		pcm = append(pcm, -1+float32(i)*0.25, 0.5)
+	}
+	b := NewPeaksBuilder(8000, 2, []int{4, 8})
+	b.Write(pcm[:6]) // split writes must not matter
+	b.Write(pcm[6:])
+	levels := b.Result()
+
+	z4 := levels[0]
+	if z4.Length() != 3 {
+		t.Fatalf("zoom 4 length = %d, want 3 (incl. partial pixel)", z4.Length())
+	}
+	// pixel 0: left min -1, max -0.25; right 0.5/0.5
+	want := []int16{-32767, -8192, 16384, 16384}
+	for i, v := range want {
+		if z4.Data[i] != v {
+			t.Fatalf("zoom 4 data[%d] = %d, want %d", i, z4.Data[i], v)
+		}
+	}
+	if levels[1].Length() != 2 {
+		t.Fatalf("zoom 8 length = %d, want 2", levels[1].Length())
+	}
+	merged, err := z4.Zoom(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range merged.Data {
+		if merged.Data[i] != levels[1].Data[i] {
+			t.Fatalf("zoom 4->8 data[%d] = %d, want %d", i, merged.Data[i], levels[1].Data[i])
+		}
+	}
+	if _, err := z4.Zoom(6); err == nil {
+		t.Fatal("zoom 6 from 4: expected error")
+	}
+
+	for _, bits := range []int{16, 8} {
+		p, err := z4.WithBits(bits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := p.WriteBinary(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if want := 24 + len(p.Data)*bits/8; buf.Len() != want {
+			t.Fatalf("%d-bit .dat is %d bytes, want %d", bits, buf.Len(), want)
+		}
+		got, err := ReadPeaks(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Bits != bits || got.Channels != 2 || got.SamplesPerPixel != 4 || got.SampleRate != 8000 {
+			t.Fatalf("header mismatch: %+v", got)
+		}
+		for i := range p.Data {
+			if got.Data[i] != p.Data[i] {
+				t.Fatalf("%d-bit data[%d] = %d, want %d", bits, i, got.Data[i], p.Data[i])
+			}
+		}
+	}
+
+	p8, _ := z4.WithBits(8)
+	raw, err := json.Marshal(p8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Version, Channels, Bits, Length int
+		Data                            []int
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Version != 2 || doc.Channels != 2 || doc.Bits != 8 || doc.Length != 3 || doc.Data[0] != -128 {
+		t.Fatalf("unexpected json %s", raw)
+	}
+}
@@ -0,0 +1,174 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Profile is a named output format: encoder, container and encoding parameters.
+type Profile struct {
+	Name       string `json:"name"`
+	Codec      string `json:"codec"`                 // ffmpeg encoder, e.g. libmp3lame
+	Ext        string `json:"ext"`                   // output file extension (container)
+	Bitrate    string `json:"bitrate,omitempty"`     // CBR/ABR target, e.g. "192k"
+	VBRQuality string `json:"vbr_quality,omitempty"` // encoder -q:a value for VBR
+	SampleRate int    `json:"sample_rate,omitempty"` // 0 keeps the source rate
+	Channels   int    `json:"channels,omitempty"`    // 0 keeps the source layout
+	SampleFmt  string `json:"sample_fmt,omitempty"`  // ffmpeg -sample_fmt
+	BitDepth   int    `json:"bit_depth,omitempty"`   // for lossless output
+}
+
+// DefaultProfile matches the historical fixed output (44.1 kHz stereo 192k MP3).
+const DefaultProfile = "mp3-192"
+
+// Profiles are the output formats clients can request by name.
+var Profiles = map[string]Profile{
+	"mp3-192":  {Name: "mp3-192", Codec: "libmp3lame", Ext: "mp3", Bitrate: "192k", SampleRate: 44100, Channels: 2},
+	"mp3-320":  {Name: "mp3-320", Codec: "libmp3lame", Ext: "mp3", Bitrate: "320k", SampleRate: 44100, Channels: 2},
+	"mp3-v0":   {Name: "mp3-v0", Codec: "libmp3lame", Ext: "mp3", VBRQuality: "0", SampleRate: 44100, Channels: 2},
+	"mp3-v2":   {Name: "mp3-v2", Codec: "libmp3lame", Ext: "mp3", VBRQuality: "2", SampleRate: 44100, Channels: 2},
+	"opus-96":  {Name: "opus-96", Codec: "libopus", Ext: "opus", Bitrate: "96k", SampleRate: 48000, Channels: 2},
+	"opus-160": {Name: "opus-160", Codec: "libopus", Ext: "opus", Bitrate: "160k", SampleRate: 48000, Channels: 2},
+	"aac-128":  {Name: "aac-128", Codec: "aac", Ext: "m4a", Bitrate: "128k", SampleRate: 44100, Channels: 2},
+	"aac-256":  {Name: "aac-256", Codec: "aac", Ext: "m4a", Bitrate: "256k", SampleRate: 44100, Channels: 2},
+	"flac-16":  {Name: "flac-16", Codec: "flac", Ext: "flac", SampleFmt: "s16", BitDepth: 16},
+	"flac-24":  {Name: "flac-24", Codec: "flac", Ext: "flac", SampleFmt: "s32", BitDepth: 24},
+	"wav-16":   {Name: "wav-16", Codec: "pcm_s16le", Ext: "wav", BitDepth: 16},
+	"wav-24":   {Name: "wav-24", Codec: "pcm_s24le", Ext: "wav", BitDepth: 24},
+	"wav-32f":  {Name: "wav-32f", Codec: "pcm_f32le", Ext: "wav", BitDepth: 32},
+}
+
+// ProfileNames lists the known profiles, sorted.
+func ProfileNames() []string {
+	names := make([]string, 0, len(Profiles))
+	for n := range Profiles {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseProfiles resolves a comma-separated list of profile names, dropping
+// duplicates. An empty list yields the default profile.
+func ParseProfiles(list string) ([]Profile, error) {
+	var out []Profile
+	seen := map[string]bool{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		p, ok := Profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown profile %q (known: %s)", name, strings.Join(ProfileNames(), ", "))
+		}
+		seen[name] = true
+		out = append(out, p)
+	}
+	if len(out) == 0 {
+		out = append(out, Profiles[DefaultProfile])
+	}
+	return out, nil
+}
+
+// EncodeArgs returns the ffmpeg output options for this profile.
+func (p Profile) EncodeArgs() []string {
+	args := []string{"-c:a", p.Codec}
+	if p.Bitrate != "" {
+		args = append(args, "-b:a", p.Bitrate)
+	}
+	if p.VBRQuality != "" {
+		args = append(args, "-q:a", p.VBRQuality)
+	}
+	if p.SampleRate > 0 {
+		args = append(args, "-ar", strconv.Itoa(p.SampleRate))
+	}
+	if p.Channels > 0 {
+		args = append(args, "-ac", strconv.Itoa(p.Channels))
+	}
+	if p.SampleFmt != "" {
+		args = append(args, "-sample_fmt", p.SampleFmt)
+	}
+	if p.Codec == "flac" && p.BitDepth > 0 {
+		args = append(args, "-bits_per_raw_sample", strconv.Itoa(p.BitDepth))
+	}
+	return args
+}
+
+// TranscodeProfile encodes inputPath to outputPath using profile p.
+func TranscodeProfile(ctx context.Context, inputPath, outputPath string, p Profile) error {
+	args := []string{"-y", "-i", inputPath, "-vn"}
+	args = append(args, p.EncodeArgs()...)
+	args = append(args, outputPath)
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg transcode (%s) error: %w | stderr: %s", p.Name, err, stderr.String())
+	}
+	return nil
+}
+
+// StreamInfo describes the first audio stream of a file as ffprobe reports it.
+type StreamInfo struct {
+	Codec      string  `json:"codec"`
+	SampleRate int     `json:"sample_rate"`
+	Channels   int     `json:"channels"`
+	BitDepth   int     `json:"bit_depth,omitempty"`
+	BitRate    int64   `json:"bit_rate"` // bits/s; container average for VBR
+	Duration   float64 `json:"duration_seconds"`
+}
+
+// ProbeStream returns codec-level details of the first audio stream.
+func ProbeStream(ctx context.Context, path string) (*StreamInfo, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-select_streams", "a:0",
+		"-show_entries", "stream=codec_name,sample_rate,channels,bit_rate,bits_per_raw_sample,bits_per_sample:format=bit_rate,duration",
+		"-of", "json",
+		path,
+	)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	var raw struct {
+		Streams []struct {
+			CodecName        string `json:"codec_name"`
+			SampleRate       string `json:"sample_rate"`
+			Channels         int    `json:"channels"`
+			BitRate          string `json:"bit_rate"`
+			BitsPerRawSample string `json:"bits_per_raw_sample"`
+			BitsPerSample    int    `json:"bits_per_sample"`
+		} `json:"streams"`
+		Format struct {
+			BitRate  string `json:"bit_rate"`
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(out, &raw); err != nil {
+		return nil, fmt.Errorf("ffprobe json: %w", err)
+	}
+	if len(raw.Streams) == 0 {
+		return nil, fmt.Errorf("no audio stream in %s", path)
+	}
+	s := raw.Streams[0]
+	info := &StreamInfo{Codec: s.CodecName, Channels: s.Channels, BitDepth: s.BitsPerSample}
+	info.SampleRate, _ = strconv.Atoi(s.SampleRate)
+	if d, err := strconv.Atoi(s.BitsPerRawSample); err == nil && d > 0 {
+		info.BitDepth = d
+	}
+	if br, err := strconv.ParseInt(s.BitRate, 10, 64); err == nil {
+		info.BitRate = br
+	} else if br, err := strconv.ParseInt(raw.Format.BitRate, 10, 64); err == nil {
+		info.BitRate = br
+	}
+	info.Duration, _ = strconv.ParseFloat(raw.Format.Duration, 64)
+	return info, nil
+}
@@ -0,0 +1,55 @@
+package audio
+
+import (
+	"bytes"
+	"errors"
+)
+
+// SniffLen is how many leading bytes Sniff looks at.
+const SniffLen = 64
+
+// ErrUnsupportedFormat is returned by Sniff for content that does not start
+// like a supported audio container.
+var ErrUnsupportedFormat = errors.New("unsupported or unrecognised audio container")
+
+// Sniff identifies the audio container from the file's magic numbers and
+// returns a short container name and its MIME type.
+func Sniff(head []byte) (container, mimeType string, err error) {
+	has := func(off int, sig string) bool {
+		return len(head) >= off+len(sig) && bytes.Equal(head[off:off+len(sig)], []byte(sig))
+	}
+	switch {
+	case has(0, "ID3"):
+		return "mp3", "audio/mpeg", nil
+	case has(0, "RIFF") && has(8, "WAVE"), has(0, "RF64") && has(8, "WAVE"), has(0, "BW64") && has(8, "WAVE"):
+		return "wav", "audio/wav", nil
+	case has(0, "fLaC"):
+		return "flac", "audio/flac", nil
+	case has(0, "OggS"):
+		return "ogg", "audio/ogg", nil
+	case has(0, "FORM") && (has(8, "AIFF") || has(8, "AIFC")):
+		return "aiff", "audio/aiff", nil
+	case has(4, "ftyp"):
+		return "mp4", "audio/mp4", nil
+	case has(0, "\x1a\x45\xdf\xa3"):
+		return "webm", "audio/webm", nil
+	case has(0, "caff"):
+		return "caf", "audio/x-caf", nil
+	case has(0, "#!AMR"):
+		return "amr", "audio/amr", nil
+	case has(0, "wvpk"):
+		return "wv", "audio/x-wavpack", nil
+	case has(0, "MAC "):
+		return "ape", "audio/x-ape", nil
+	}
+	// raw frame streams without a container header
+	if len(head) >= 2 && head[0] == 0xFF {
+		switch {
+		case head[1]&0xF6 == 0xF0: // ADTS, layer bits 00
+			return "aac", "audio/aac", nil
+		case head[1]&0xE0 == 0xE0 && head[1]&0x06 != 0: // MPEG audio frame sync
+			return "mp3", "audio/mpeg", nil
+		}
+	}
+	return "", "", ErrUnsupportedFormat
+}
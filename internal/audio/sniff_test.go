@@ -0,0 +1,27 @@
+package audio
+
+import "testing"
+
+func TestSniff(t *testing.T) {
+	cases := map[string]string{
+		"ID3\x04\x00":                      "mp3",
+		"\xff\xfb\x90\x64":                 "mp3",
+		"\xff\xf1\x50\x80":                 "aac",
+		"RIFF\x24\x08\x00\x00WAVEfmt ":     "wav",
+		"fLaC\x00\x00\x00\x22":             "flac",
+		"OggS\x00\x02":                     "ogg",
+		"FORM\x00\x00\x00\x00AIFFCOMM":     "aiff",
+		"\x00\x00\x00\x20ftypM4A \x00\x00": "mp4",
+	}
+	for head, want := range cases {
+		got, _, err := Sniff([]byte(head))
+		if err != nil || got != want {
+			t.Errorf("Sniff(%q) = %q, %v; want %q", head, got, err, want)
+		}
+	}
+	for _, head := range []string{"", "%PDF-1.7", "\x89PNG\r\n\x1a\n", "RIFF\x24\x08\x00\x00AVI ", "\xff\xd8\xff\xe0"} {
+		if got, _, err := Sniff([]byte(head)); err == nil {
+			t.Errorf("Sniff(%q) = %q, want error", head, got)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package audio
+
+import "math"
+
+// Tempo search range and prior; the log-normal prior around 120 BPM (one
+// octave deviation) resolves the usual half/double-tempo ambiguity the same
+// way librosa's default tempo estimator does.
+const (
+	minBPM      = 40.0
+	maxBPM      = 240.0
+	priorBPM    = 120.0
+	priorOctave = 1.0
+)
+
+// onsetFlux turns successive magnitude spectra into a spectral-flux onset
+// strength envelope (positive log-magnitude differences summed over bins).
+type onsetFlux struct {
+	prev     []float64
+	envelope []float64
+}
+
+func (o *onsetFlux) add(mag []float64) {
+	if o.prev == nil {
+		o.prev = make([]float64, len(mag))
+	}
+	var flux float64
+	for k, m := range mag {
+		l := math.Log1p(1000 * m)
+		if d := l - o.prev[k]; d > 0 {
+			flux += d
+		}
+		o.prev[k] = l
+	}
+	o.envelope = append(o.envelope, flux)
+}
+
+// EstimateTempo returns the dominant tempo of an onset-strength envelope
+// sampled at fps frames per second, and a 0..1 confidence (the normalized
+// autocorrelation at the chosen period).
+func EstimateTempo(envelope []float64, fps float64) (bpm, confidence float64) {
+	minLag := int(math.Floor(60 * fps / maxBPM))
+	maxLag := int(math.Ceil(60 * fps / minBPM))
+	if minLag < 1 {
+		minLag = 1
+	}
+	if len(envelope) < 2*maxLag {
+		return 0, 0
+	}
+
+	// remove the slowly varying loudness trend (~1 s moving average) so the
+	// autocorrelation sees pulses, not level changes
+	o := make([]float64, len(envelope))
+	win := int(fps)
+	var sum float64
+	for i, v := range envelope {
+		sum += v
+		if i >= win {
+			sum -= envelope[i-win]
+		}
+		n := math.Min(float64(i+1), float64(win))
+		if d := v - sum/n; d > 0 {
+			o[i] = d
+		}
+	}
+
+	ac := make([]float64, maxLag+2)
+	for lag := range ac {
+		var s float64
+		for i := lag; i < len(o); i++ {
+			s += o[i] * o[i-lag]
+		}
+		// unbiased: compensate for the shrinking overlap at long lags
+		ac[lag] = s / float64(len(o)-lag)
+	}
+	if ac[0] <= 0 {
+		return 0, 0
+	}
+
+	best, bestScore := 0, 0.0
+	for lag := minLag; lag <= maxLag; lag++ {
+		b := 60 * fps / float64(lag)
+		prior := math.Exp(-0.5 * math.Pow(math.Log2(b/priorBPM)/priorOctave, 2))
+		if score := ac[lag] * prior; score > bestScore {
+			best, bestScore = lag, score
+		}
+	}
+	if best == 0 {
+		return 0, 0
+	}
+
+	// parabolic interpolation around the peak for sub-frame resolution
+	lag := float64(best)
+	if y0, y1, y2 := ac[best-1], ac[best], ac[best+1]; y0-2*y1+y2 != 0 {
+		if d := 0.5 * (y0 - y2) / (y0 - 2*y1 + y2); math.Abs(d) < 1 {
+			lag += d
+		}
+	}
+	confidence = math.Max(0, math.Min(1, ac[best]/ac[0]))
+	return round2(60 * fps / lag), round2(confidence)
+}
@@ -2,26 +2,114 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
-// TryClaimJob attempts to transition a queued job to running and returns true if claimed.
-func (d *DB) TryClaimJob(ctx context.Context, jobID int64, workerName string) (bool, error) {
+// TryClaimJob attempts to transition a queued job to running and returns true
+// if claimed. The claim makes workerName the job's owner with a lease of ttl,
+// which RenewJobLease must keep extending.
+func (d *DB) TryClaimJob(ctx context.Context, jobID int64, workerName string, ttl time.Duration) (bool, error) {
 	// We change status only if currently queued
-	// Also set updated timestamp or last_error cleared
 	tag, err := d.Pool.Exec(ctx,
 		`UPDATE jobs
-		 SET status='running', last_error='', progress=1
-		 WHERE id=$1 AND status='queued'`, jobID)
+		 SET status='running', last_error='', progress=1,
+		     claimed_by=$2, heartbeat_at=now(), lease_expires_at=now() + make_interval(secs => $3)
+		 WHERE id=$1 AND status='queued'`, jobID, workerName, ttl.Seconds())
 	if err != nil {
 		return false, fmt.Errorf("claim update error: %w", err)
 	}
-	if tag.RowsAffected() == 0 {
-		// not claimed (already running or done)
-		return false, nil
+	// not claimed (already running or done) when nothing changed
+	return tag.RowsAffected() == 1, nil
+}
+
+// RenewJobLease records a heartbeat from workerName and extends its lease on
+// the job by ttl. owned is false when the job is no longer running under
+// this worker (the reaper gave it away); status is the job's current status,
+// "cancelling" when a cancellation is pending.
+func (d *DB) RenewJobLease(ctx context.Context, jobID int64, workerName string, ttl time.Duration) (status string, owned bool, err error) {
+	err = d.Pool.QueryRow(ctx,
+		`UPDATE jobs SET heartbeat_at=now(), lease_expires_at=now() + make_interval(secs => $3)
+		 WHERE id=$1 AND claimed_by=$2 AND status IN ('running', 'processing', 'cancelling')
+		 RETURNING status`, jobID, workerName, ttl.Seconds()).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return status, true, nil
+}
+
+// ReapedJob is a job taken from a worker whose lease expired. Status is
+// where the reaper moved it: "queued" for another attempt, "failed" once
+// that was its last attempt, or still "cancelling" if it was being
+// cancelled, for the caller to clean up and finish.
+type ReapedJob struct {
+	JobRef
+	Status string
+	Worker string // the previous owner
+}
+
+// ReapExpiredLeases takes up to limit running jobs whose lease expired away
+// from their owner. Losing the worker counts as a failed attempt: the job
+// goes back to "queued" with its retry count bumped, or to "failed" when no
+// retry is left. The caller publishes requeued jobs and dead-letters failed
+// ones within tx. A job being cancelled stays "cancelling", unowned, with a
+// fresh lease of cancelLease: the caller cleans up after it and calls
+// FinishCancelledJob, and should it fail to, the job is reaped again.
+func ReapExpiredLeases(ctx context.Context, tx pgx.Tx, limit int, cancelLease time.Duration) ([]ReapedJob, error) {
+	rows, err := tx.Query(ctx,
+		`WITH expired AS (
+			SELECT id, claimed_by FROM jobs
+			WHERE status IN ('running', 'processing', 'cancelling') AND lease_expires_at < now()
+			ORDER BY lease_expires_at LIMIT $1 FOR UPDATE SKIP LOCKED)
+		 UPDATE jobs j SET
+		   status = CASE WHEN j.status = 'cancelling' THEN j.status
+		                 WHEN j.retry_count + 1 >= j.max_retries THEN 'failed'
+		                 ELSE 'queued' END,
+		   retry_count = CASE WHEN j.status = 'cancelling' THEN j.retry_count ELSE j.retry_count + 1 END,
+		   last_error = CASE WHEN j.status = 'cancelling' THEN j.last_error
+		                     ELSE 'lease expired: ' || COALESCE(j.claimed_by, 'unknown worker') || ' stopped sending heartbeats' END,
+		   progress = CASE WHEN j.status = 'cancelling' THEN j.progress ELSE 0 END,
+		   claimed_by = CASE WHEN j.status = 'cancelling' THEN NULL ELSE j.claimed_by END,
+		   lease_expires_at = CASE WHEN j.status = 'cancelling' THEN now() + make_interval(secs => $2::int) END,
+		   logs = COALESCE(j.logs,'') || E'\n' || 'reaper: lease of ' || COALESCE(j.claimed_by, 'unknown worker') || ' expired'
+		 FROM expired WHERE j.id = expired.id
+		 RETURNING j.id, j.upload_id, COALESCE(j.type, ''), j.priority, j.status, COALESCE(expired.claimed_by, '')`,
+		limit, int(cancelLease.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	var jobs []ReapedJob
+	var ids []int64
+	for rows.Next() {
+		var j ReapedJob
+		if err := rows.Scan(&j.ID, &j.UploadID, &j.Type, &j.Priority, &j.Status, &j.Worker); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		jobs = append(jobs, j)
+		ids = append(ids, j.ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
 	}
-	// optionally insert an audit row in another table here
-	_ = time.Now()
-	return true, nil
+	// close the steps of the abandoned attempt; a retry re-initializes them
+	// and FinishCancelledJob closes those of a cancelled one
+	_, err = tx.Exec(ctx,
+		`UPDATE job_steps s SET
+		   status = CASE WHEN s.status = 'running' THEN 'failed' ELSE 'skipped' END,
+		   error = 'lease expired',
+		   finished_at = now()
+		 FROM jobs j
+		 WHERE s.job_id = j.id AND j.id = ANY($1) AND j.status <> 'cancelling' AND s.status IN ('pending', 'running')`, ids)
+	return jobs, err
 }
@@ -0,0 +1,205 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DeadLetter is the failure context of a job that exhausted its retries.
+type DeadLetter struct {
+	ID         int64           `json:"id"`
+	JobID      int64           `json:"job_id"`
+	UploadID   *int64          `json:"upload_id"`
+	Type       string          `json:"type"`
+	Priority   string          `json:"priority"`
+	Worker     string          `json:"worker,omitempty"`
+	RetryCount int             `json:"retry_count"`
+	MaxRetries int             `json:"max_retries"`
+	LastError  string          `json:"last_error"`
+	Logs       string          `json:"logs"`
+	Steps      json.RawMessage `json:"steps"` // job_steps of the last attempt
+	FailedAt   time.Time       `json:"failed_at"`
+	RequeuedAt *time.Time      `json:"requeued_at,omitempty"`
+}
+
+// DeadLetterFilter selects dead letters; zero fields match everything.
+type DeadLetterFilter struct {
+	JobIDs   []int64
+	UploadID *int64
+	Type     string
+	Error    string // case-insensitive substring of last_error
+	Since    *time.Time
+	Until    *time.Time
+	// IncludeRequeued also matches dead letters whose job was requeued.
+	IncludeRequeued bool
+}
+
+// where renders f as a condition on dead_letters aliased dl, numbering its
+// parameters after those already in args.
+func (f DeadLetterFilter) where(args []any) (string, []any) {
+	conds := []string{"true"}
+	add := func(cond string, v any) {
+		args = append(args, v)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if len(f.JobIDs) > 0 {
+		add("dl.job_id = ANY($%d)", f.JobIDs)
+	}
+	if f.UploadID != nil {
+		add("dl.upload_id = $%d", *f.UploadID)
+	}
+	if f.Type != "" {
+		add("dl.type = $%d", f.Type)
+	}
+	if f.Error != "" {
+		add("strpos(lower(dl.last_error), lower($%d)) > 0", f.Error)
+	}
+	if f.Since != nil {
+		add("dl.failed_at >= $%d", *f.Since)
+	}
+	if f.Until != nil {
+		add("dl.failed_at < $%d", *f.Until)
+	}
+	if !f.IncludeRequeued {
+		conds = append(conds, "dl.requeued_at IS NULL")
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+const deadLetterColumns = `dl.id, dl.job_id, dl.upload_id, dl.type, dl.priority, dl.worker, dl.retry_count, dl.max_retries,
+	dl.last_error, dl.logs, dl.steps, dl.failed_at, dl.requeued_at`
+
+func scanDeadLetter(row pgx.Row) (*DeadLetter, error) {
+	dl := &DeadLetter{}
+	err := row.Scan(&dl.ID, &dl.JobID, &dl.UploadID, &dl.Type, &dl.Priority, &dl.Worker, &dl.RetryCount, &dl.MaxRetries,
+		&dl.LastError, &dl.Logs, &dl.Steps, &dl.FailedAt, &dl.RequeuedAt)
+	if err != nil {
+		return nil, err
+	}
+	return dl, nil
+}
+
+// DeadLetterJob settles worker's job that exhausted its retries as failed
+// and records its dead letter (see RecordDeadLetter) in the same
+// transaction. Like SettleJob it returns false, changing nothing, when a
+// cancellation was requested meanwhile, and ErrLeaseLost when the job is no
+// longer running under worker.
+func (d *DB) DeadLetterJob(ctx context.Context, id int64, appendLog, worker, subject string) (bool, error) {
+	var settled bool
+	err := d.WithTx(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`UPDATE jobs SET status='failed', progress=0, lease_expires_at=NULL,
+			   logs = CASE WHEN $1 = '' THEN logs ELSE COALESCE(logs,'') || E'\n' || $1 END
+			 WHERE id=$2 AND claimed_by=$3 AND status IN ('running', 'processing')`, appendLog, id, worker)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return settleRefused(ctx, tx, id, worker)
+		}
+		settled = true
+		_, err = RecordDeadLetter(ctx, tx, id, worker, subject)
+		return err
+	})
+	return settled, err
+}
+
+// RecordDeadLetter snapshots a failed job into dead_letters and writes the
+// letter to the outbox for subject.
+func RecordDeadLetter(ctx context.Context, tx pgx.Tx, id int64, worker, subject string) (*DeadLetter, error) {
+	dl, err := scanDeadLetter(tx.QueryRow(ctx,
+		`INSERT INTO dead_letters AS dl (job_id, upload_id, type, priority, worker, retry_count, max_retries, last_error, logs, steps)
+		 SELECT j.id, j.upload_id, COALESCE(j.type, ''), j.priority, $2, COALESCE(j.retry_count, 0), COALESCE(j.max_retries, 0),
+		   COALESCE(j.last_error, ''), COALESCE(j.logs, ''),
+		   COALESCE((SELECT jsonb_agg(jsonb_build_object(
+		       'name', s.name, 'status', s.status, 'critical', s.critical, 'attempt', s.attempt,
+		       'error', s.error, 'outputs', s.outputs, 'started_at', s.started_at, 'finished_at', s.finished_at)
+		     ORDER BY s.position) FROM job_steps s WHERE s.job_id = j.id), '[]')
+		 FROM jobs j WHERE j.id=$1
+		 RETURNING `+deadLetterColumns, id, worker))
+	if err != nil {
+		return nil, fmt.Errorf("insert dead letter: %w", err)
+	}
+	return dl, InsertOutbox(ctx, tx, subject, dl)
+}
+
+// ListDeadLetters returns up to limit dead letters matching f, newest first,
+// with an id below beforeID when it is positive.
+func (d *DB) ListDeadLetters(ctx context.Context, f DeadLetterFilter, beforeID int64, limit int) ([]*DeadLetter, error) {
+	where, args := f.where([]any{beforeID, limit})
+	rows, err := d.Pool.Query(ctx,
+		`SELECT `+deadLetterColumns+` FROM dead_letters dl
+		 WHERE ($1::bigint <= 0 OR dl.id < $1) AND `+where+`
+		 ORDER BY dl.id DESC LIMIT $2`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []*DeadLetter{}
+	for rows.Next() {
+		dl, err := scanDeadLetter(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, dl)
+	}
+	return out, rows.Err()
+}
+
+// RequeueFailedJob puts a failed job back to "queued" with a fresh retry
+// budget and marks its open dead letters requeued. It returns pgx.ErrNoRows
+// when the job does not exist or is not failed; the caller publishes the job
+// within tx.
+func RequeueFailedJob(ctx context.Context, tx pgx.Tx, id int64) (*JobRef, error) {
+	jobs, err := requeueJobs(ctx, tx, `SELECT id FROM jobs WHERE id=$1 AND status='failed' FOR UPDATE`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, pgx.ErrNoRows
+	}
+	return &jobs[0], nil
+}
+
+// RequeueDeadLetters does what RequeueFailedJob does for up to limit failed
+// jobs with an open dead letter matching f, in job id order. Jobs being
+// requeued by a concurrent call are skipped.
+func RequeueDeadLetters(ctx context.Context, tx pgx.Tx, f DeadLetterFilter, limit int) ([]JobRef, error) {
+	f.IncludeRequeued = false
+	where, args := f.where([]any{limit})
+	return requeueJobs(ctx, tx,
+		`SELECT j.id FROM jobs j
+		 WHERE j.status='failed' AND EXISTS (SELECT 1 FROM dead_letters dl WHERE dl.job_id = j.id AND `+where+`)
+		 ORDER BY j.id LIMIT $1 FOR UPDATE SKIP LOCKED`, args...)
+}
+
+// requeueJobs requeues the jobs whose ids pick selects.
+func requeueJobs(ctx context.Context, tx pgx.Tx, pick string, args ...any) ([]JobRef, error) {
+	rows, err := tx.Query(ctx,
+		`WITH picked AS (`+pick+`),
+		 marked AS (
+			UPDATE dead_letters SET requeued_at = now()
+			WHERE requeued_at IS NULL AND job_id IN (SELECT id FROM picked))
+		 UPDATE jobs SET status='queued', retry_count=0, last_error='', progress=0,
+		   logs = COALESCE(logs,'') || E'\n' || 'requeued'
+		 WHERE id IN (SELECT id FROM picked)
+		 RETURNING id, upload_id, COALESCE(type, ''), priority`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var jobs []JobRef
+	for rows.Next() {
+		var j JobRef
+		if err := rows.Scan(&j.ID, &j.UploadID, &j.Type, &j.Priority); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
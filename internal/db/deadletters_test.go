@@ -0,0 +1,45 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadLetterFilterWhere(t *testing.T) {
+	upload := int64(4)
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	until := since.Add(24 * time.Hour)
+	cases := []struct {
+		name  string
+		f     DeadLetterFilter
+		args  []any
+		where string
+		want  []any
+	}{
+		{"empty", DeadLetterFilter{}, nil,
+			"true AND dl.requeued_at IS NULL", nil},
+		{"empty with requeued", DeadLetterFilter{IncludeRequeued: true}, nil,
+			"true", nil},
+		{"job ids", DeadLetterFilter{JobIDs: []int64{1, 2}}, nil,
+			"true AND dl.job_id = ANY($1) AND dl.requeued_at IS NULL", []any{[]int64{1, 2}}},
+		{"after the caller's parameters", DeadLetterFilter{Type: "transcode", IncludeRequeued: true}, []any{int64(0), 50},
+			"true AND dl.type = $3", []any{int64(0), 50, "transcode"}},
+		{"every field", DeadLetterFilter{
+			JobIDs: []int64{9}, UploadID: &upload, Type: "transcode", Error: "FFmpeg",
+			Since: &since, Until: &until,
+		}, []any{100},
+			"true AND dl.job_id = ANY($2) AND dl.upload_id = $3 AND dl.type = $4" +
+				" AND strpos(lower(dl.last_error), lower($5)) > 0 AND dl.failed_at >= $6 AND dl.failed_at < $7" +
+				" AND dl.requeued_at IS NULL",
+			[]any{100, []int64{9}, int64(4), "transcode", "FFmpeg", since, until}},
+		{"time range only", DeadLetterFilter{Until: &until}, []any{1},
+			"true AND dl.failed_at < $2 AND dl.requeued_at IS NULL", []any{1, until}},
+	}
+	for _, tc := range cases {
+		where, args := tc.f.where(tc.args)
+		require.Equal(t, tc.where, where, tc.name)
+		require.Equal(t, tc.want, args, tc.name)
+	}
+}
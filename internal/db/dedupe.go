@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// UploadMatch is an earlier upload with the same content hash.
+type UploadMatch struct {
+	ID             int64
+	Path           string
+	Profiles       []string
+	LoudnessTarget string
+	DuplicateOf    *int64
+	// JobStatus is the status of the upload's latest job, "" if it has none
+	// (uploads that reused another's results).
+	JobStatus string
+	// Outputs are the names of the outputs recorded for the upload.
+	Outputs []string
+}
+
+// FindUploadsBySHA256 returns uploads whose content hashes to sum, oldest
+// first.
+func (d *DB) FindUploadsBySHA256(ctx context.Context, sum string) ([]*UploadMatch, error) {
+	rows, err := d.Pool.Query(ctx,
+		`SELECT u.id, u.path, u.profiles, u.loudness_target, u.duplicate_of,
+		        COALESCE((SELECT j.status FROM jobs j WHERE j.upload_id = u.id ORDER BY j.id DESC LIMIT 1), ''),
+		        ARRAY(SELECT o.name FROM outputs o WHERE o.upload_id = u.id ORDER BY o.name)
+		 FROM uploads u WHERE u.sha256 = $1 ORDER BY u.id LIMIT 50`, sum)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*UploadMatch
+	for rows.Next() {
+		m := &UploadMatch{}
+		if err := rows.Scan(&m.ID, &m.Path, &m.Profiles, &m.LoudnessTarget, &m.DuplicateOf, &m.JobStatus, &m.Outputs); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// CloneUploadResults copies the analysis columns of upload from onto upload
+// to, together with the named outputs and all waveform peak levels. The
+// copies point at from's stored files; nothing is duplicated in storage.
+// output_path is set to the first profile's output.
+func CloneUploadResults(ctx context.Context, q Execer, from, to int64, profiles []string) error {
+	if len(profiles) == 0 {
+		return fmt.Errorf("clone upload %d: no profiles", from)
+	}
+	if _, err := q.Exec(ctx,
+		`UPDATE uploads d SET
+		   duration_seconds = s.duration_seconds, integrated_lufs = s.integrated_lufs,
+		   loudness_range = s.loudness_range, true_peak_dbtp = s.true_peak_dbtp, loudness = s.loudness,
+		   bpm = s.bpm, musical_key = s.musical_key, bpm_confidence = s.bpm_confidence,
+		   key_confidence = s.key_confidence, waveform_path = s.waveform_path, streaming = s.streaming,
+		   output_path = (SELECT o.path FROM outputs o WHERE o.upload_id = s.id AND o.name = $3)
+		 FROM uploads s WHERE s.id = $1 AND d.id = $2`,
+		from, to, profiles[0]); err != nil {
+		return fmt.Errorf("copy analysis: %w", err)
+	}
+	if _, err := q.Exec(ctx,
+		`INSERT INTO outputs (upload_id, job_id, name, path, codec, container, bitrate, sample_rate, channels, bit_depth, size,
+		                      duration_seconds, loudness_target, loudness_before, loudness_after)
+		 SELECT $2, job_id, name, path, codec, container, bitrate, sample_rate, channels, bit_depth, size,
+		        duration_seconds, loudness_target, loudness_before, loudness_after
+		 FROM outputs WHERE upload_id = $1 AND name = ANY($3)`,
+		from, to, profiles); err != nil {
+		return fmt.Errorf("copy outputs: %w", err)
+	}
+	if _, err := q.Exec(ctx,
+		`INSERT INTO waveform_peaks (upload_id, samples_per_pixel, channels, sample_rate, bits, length, path)
+		 SELECT $2, samples_per_pixel, channels, sample_rate, bits, length, path
+		 FROM waveform_peaks WHERE upload_id = $1`,
+		from, to); err != nil {
+		return fmt.Errorf("copy peaks: %w", err)
+	}
+	return nil
+}
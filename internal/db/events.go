@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// JobEventsChannel is the NOTIFY channel the jobs_record_events trigger
+// signals on.
+const JobEventsChannel = "job_events"
+
+// JobEvent is one recorded change of a job's status, progress or log.
+type JobEvent struct {
+	ID        int64     `json:"id"`
+	JobID     int64     `json:"job_id"`
+	UploadID  *int64    `json:"upload_id"`
+	Kind      string    `json:"kind"` // status, progress or log
+	Status    string    `json:"status"`
+	Progress  int       `json:"progress"`
+	Log       string    `json:"log,omitempty"` // the line appended by this change
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// JobEventNotice is the payload of a JobEventsChannel notification.
+type JobEventNotice struct {
+	ID       int64  `json:"id"`
+	JobID    int64  `json:"job_id"`
+	UploadID *int64 `json:"upload_id"`
+}
+
+// JobEventFilter selects the events of one job or of every job of one upload.
+type JobEventFilter struct {
+	JobID    *int64
+	UploadID *int64
+}
+
+// ListJobEvents returns up to limit events matching f with an id above
+// afterID, oldest first.
+func (d *DB) ListJobEvents(ctx context.Context, f JobEventFilter, afterID int64, limit int) ([]JobEvent, error) {
+	rows, err := d.Pool.Query(ctx,
+		`SELECT id, job_id, upload_id, kind, COALESCE(status, ''), COALESCE(progress, 0), log, created_at
+		 FROM job_events
+		 WHERE ($1::int IS NULL OR job_id = $1) AND ($2::int IS NULL OR upload_id = $2) AND id > $3
+		 ORDER BY id LIMIT $4`,
+		f.JobID, f.UploadID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []JobEvent
+	for rows.Next() {
+		var e JobEvent
+		if err := rows.Scan(&e.ID, &e.JobID, &e.UploadID, &e.Kind, &e.Status, &e.Progress, &e.Log, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// ListenJobEvents holds a pool connection listening on JobEventsChannel and
+// calls fn for every notification until ctx is cancelled or the connection
+// fails. Notifications sent while nobody listens are lost; callers re-read
+// job_events after reconnecting.
+func (d *DB) ListenJobEvents(ctx context.Context, fn func(JobEventNotice)) error {
+	conn, err := d.Pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, "LISTEN "+JobEventsChannel); err != nil {
+		return err
+	}
+	for {
+		n, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			// the connection may still be listening; don't hand it back
+			_ = conn.Conn().Close(context.Background())
+			return err
+		}
+		var notice JobEventNotice
+		if json.Unmarshal([]byte(n.Payload), &notice) == nil {
+			fn(notice)
+		}
+	}
+}
+
+// PurgeJobEvents deletes events older than olderThan.
+func (d *DB) PurgeJobEvents(ctx context.Context, olderThan time.Duration) (int64, error) {
+	tag, err := d.Pool.Exec(ctx,
+		`DELETE FROM job_events WHERE created_at < now() - make_interval(secs => $1)`, olderThan.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
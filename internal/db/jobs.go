@@ -2,17 +2,42 @@ package db
 
 import (
 	"context"
+	"errors"
 	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
+// ErrJobFinished is returned when cancelling a job that already ended.
+var ErrJobFinished = errors.New("job already finished")
+
+// ErrLeaseLost is returned when a worker records the outcome of a run on a
+// job it no longer owns: the reaper took the job away after its lease expired.
+var ErrLeaseLost = errors.New("job lease lost")
+
 type JobModel struct {
-	ID        int64     `db:"id"`
-	UploadID  int64     `db:"upload_id"`
-	Type      string    `db:"type"`
-	Status    string    `db:"status"`
-	Progress  int       `db:"progress"`
-	Logs      string    `db:"logs"`
-	CreatedAt time.Time `db:"created_at"`
+	ID       int64      `db:"id"`
+	UploadID int64      `db:"upload_id"`
+	Type     string     `db:"type"`
+	Status   string     `db:"status"`
+	Priority string     `db:"priority"`
+	Progress int        `db:"progress"`
+	Logs     string     `db:"logs"`
+	RunAt    *time.Time `db:"run_at"` // set for delayed jobs
+	// ClaimedBy is the worker that ran the job last; it owns a running job
+	// until LeaseExpiresAt.
+	ClaimedBy      *string    `db:"claimed_by"`
+	HeartbeatAt    *time.Time `db:"heartbeat_at"`
+	LeaseExpiresAt *time.Time `db:"lease_expires_at"`
+	CreatedAt      time.Time  `db:"created_at"`
+}
+
+// JobRef is what publishing a job needs: the fields of its queue message.
+type JobRef struct {
+	ID       int64
+	UploadID int64
+	Type     string
+	Priority string
 }
 
 func (d *DB) CreateJob(ctx context.Context, uploadID int64, jtype string) (int64, error) {
@@ -25,15 +50,15 @@ func (d *DB) CreateJob(ctx context.Context, uploadID int64, jtype string) (int64
 
 func (d *DB) GetJob(ctx context.Context, id int64) (*JobModel, error) {
 	j := &JobModel{}
-	row := d.Pool.QueryRow(ctx, `SELECT id, upload_id, type, status, progress, logs, created_at FROM jobs WHERE id=$1`, id)
-	if err := row.Scan(&j.ID, &j.UploadID, &j.Type, &j.Status, &j.Progress, &j.Logs, &j.CreatedAt); err != nil {
+	row := d.Pool.QueryRow(ctx, `SELECT id, upload_id, type, status, priority, progress, logs, run_at, claimed_by, heartbeat_at, lease_expires_at, created_at FROM jobs WHERE id=$1`, id)
+	if err := row.Scan(&j.ID, &j.UploadID, &j.Type, &j.Status, &j.Priority, &j.Progress, &j.Logs, &j.RunAt, &j.ClaimedBy, &j.HeartbeatAt, &j.LeaseExpiresAt, &j.CreatedAt); err != nil {
 		return nil, err
 	}
 	return j, nil
 }
 
 func (d *DB) ListJobs(ctx context.Context, limit, offset int) ([]*JobModel, error) {
-	rows, err := d.Pool.Query(ctx, `SELECT id, upload_id, type, status, progress, logs, created_at FROM jobs ORDER BY created_at DESC LIMIT $1 OFFSET $2`, limit, offset)
+	rows, err := d.Pool.Query(ctx, `SELECT id, upload_id, type, status, priority, progress, logs, run_at, claimed_by, heartbeat_at, lease_expires_at, created_at FROM jobs ORDER BY created_at DESC LIMIT $1 OFFSET $2`, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -41,7 +66,7 @@ func (d *DB) ListJobs(ctx context.Context, limit, offset int) ([]*JobModel, erro
 	var jobs []*JobModel
 	for rows.Next() {
 		j := &JobModel{}
-		if err := rows.Scan(&j.ID, &j.UploadID, &j.Type, &j.Status, &j.Progress, &j.Logs, &j.CreatedAt); err != nil {
+		if err := rows.Scan(&j.ID, &j.UploadID, &j.Type, &j.Status, &j.Priority, &j.Progress, &j.Logs, &j.RunAt, &j.ClaimedBy, &j.HeartbeatAt, &j.LeaseExpiresAt, &j.CreatedAt); err != nil {
 			return nil, err
 		}
 		jobs = append(jobs, j)
@@ -58,3 +83,121 @@ func (d *DB) UpdateJobStatus(ctx context.Context, id int64, status string, progr
 	_, err := d.Pool.Exec(ctx, `UPDATE jobs SET status=$1, progress=$2 WHERE id=$3`, status, progress, id)
 	return err
 }
+
+// UpdateJobProgress is UpdateJobStatus for the worker running the job: a
+// pending cancellation ("cancelling") keeps its status.
+func (d *DB) UpdateJobProgress(ctx context.Context, id int64, status string, progress int, appendLog string) error {
+	_, err := d.Pool.Exec(ctx,
+		`UPDATE jobs SET status = CASE WHEN status = 'cancelling' THEN status ELSE $1 END, progress=$2,
+		   logs = CASE WHEN $3 = '' THEN logs ELSE COALESCE(logs,'') || E'\n' || $3 END
+		 WHERE id=$4`, status, progress, appendLog, id)
+	return err
+}
+
+// SettleJob records the outcome of worker's run (done, failed, or queued
+// for a retry). It returns false, changing nothing, when a cancellation was
+// requested meanwhile; the caller then finishes the job as cancelled. It
+// returns ErrLeaseLost when the job is no longer running under worker.
+func (d *DB) SettleJob(ctx context.Context, id int64, worker, status string, progress int, appendLog string) (bool, error) {
+	tag, err := d.Pool.Exec(ctx,
+		`UPDATE jobs SET status=$1, progress=$2, lease_expires_at=NULL,
+		   logs = CASE WHEN $3 = '' THEN logs ELSE COALESCE(logs,'') || E'\n' || $3 END
+		 WHERE id=$4 AND claimed_by=$5 AND status IN ('running', 'processing')`, status, progress, appendLog, id, worker)
+	if err != nil {
+		return false, err
+	}
+	if tag.RowsAffected() == 1 {
+		return true, nil
+	}
+	return false, settleRefused(ctx, d.Pool, id, worker)
+}
+
+// settleRefused tells why worker could not settle job id: nil when a
+// cancellation is pending under its lease, ErrLeaseLost otherwise.
+func settleRefused(ctx context.Context, q Execer, id int64, worker string) error {
+	var cancelling bool
+	if err := q.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM jobs WHERE id=$1 AND claimed_by=$2 AND status='cancelling')`,
+		id, worker).Scan(&cancelling); err != nil {
+		return err
+	}
+	if !cancelling {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// RecordJobFailure counts a failed attempt of worker's run of job id and
+// returns the job's retry count and budget. It returns ErrLeaseLost when
+// the job is no longer running under worker.
+func (d *DB) RecordJobFailure(ctx context.Context, id int64, worker, errMsg string) (retryCount, maxRetries int, err error) {
+	err = d.Pool.QueryRow(ctx,
+		`UPDATE jobs SET retry_count = retry_count + 1, last_error = $1
+		 WHERE id=$2 AND claimed_by=$3 AND status IN ('running', 'processing', 'cancelling')
+		 RETURNING retry_count, max_retries`, errMsg, id, worker).Scan(&retryCount, &maxRetries)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, 0, ErrLeaseLost
+	}
+	return retryCount, maxRetries, err
+}
+
+// RequestJobCancel cancels a queued or scheduled job outright and moves a
+// running one to "cancelling" for its worker to stop. It returns the new status, or
+// ErrJobFinished (with the current status) for a job that already ended.
+func (d *DB) RequestJobCancel(ctx context.Context, id int64) (string, error) {
+	var status string
+	err := d.Pool.QueryRow(ctx,
+		`UPDATE jobs SET status = CASE WHEN status IN ('queued', 'scheduled') THEN 'cancelled' ELSE 'cancelling' END,
+		   logs = COALESCE(logs,'') || E'\n' || 'cancel requested'
+		 WHERE id=$1 AND status IN ('scheduled', 'queued', 'running', 'processing', 'cancelling')
+		 RETURNING status`, id).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		if err := d.Pool.QueryRow(ctx, `SELECT status FROM jobs WHERE id=$1`, id).Scan(&status); err != nil {
+			return "", err
+		}
+		return status, ErrJobFinished
+	}
+	return status, err
+}
+
+// FinishCancelledJob moves a cancelling job held by worker to "cancelled"
+// and closes its unfinished steps. worker is "" for a job the reaper took
+// from its worker. It returns ErrLeaseLost when the job is not cancelling
+// under worker, e.g. because the reaper took it over meanwhile.
+func (d *DB) FinishCancelledJob(ctx context.Context, id int64, worker, appendLog string) error {
+	return d.WithTx(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`UPDATE jobs SET status='cancelled', lease_expires_at=NULL, logs = COALESCE(logs,'') || E'\n' || $1
+			 WHERE id=$2 AND status='cancelling' AND claimed_by IS NOT DISTINCT FROM NULLIF($3, '')`, appendLog, id, worker)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrLeaseLost
+		}
+		_, err = tx.Exec(ctx,
+			`UPDATE job_steps SET status='skipped', error='cancelled', finished_at=now()
+			 WHERE job_id=$1 AND status IN ('pending', 'running')`, id)
+		return err
+	})
+}
+
+// QueuedJobsByPriority counts queued jobs per priority lane; lanes without
+// queued jobs are absent.
+func (d *DB) QueuedJobsByPriority(ctx context.Context) (map[string]int64, error) {
+	rows, err := d.Pool.Query(ctx, `SELECT priority, count(*) FROM jobs WHERE status='queued' GROUP BY priority`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]int64{}
+	for rows.Next() {
+		var p string
+		var n int64
+		if err := rows.Scan(&p, &n); err != nil {
+			return nil, err
+		}
+		out[p] = n
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS uploads (
+	id SERIAL PRIMARY KEY,
+	filename TEXT,
+	path TEXT,
+	output_path TEXT,
+	content_type TEXT,
+	size BIGINT,
+	status TEXT DEFAULT 'queued',
+	duration_seconds DOUBLE PRECISION,
+	integrated_lufs DOUBLE PRECISION,
+	bpm DOUBLE PRECISION,
+	musical_key TEXT,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS jobs (
+	id SERIAL PRIMARY KEY,
+	upload_id INT REFERENCES uploads(id),
+	type TEXT,
+	status TEXT DEFAULT 'queued',
+	progress INT DEFAULT 0,
+	logs TEXT DEFAULT '',
+	retry_count INT DEFAULT 0,
+	max_retries INT DEFAULT 3,
+	last_error TEXT DEFAULT '',
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS jobs_upload_id_idx ON jobs (upload_id);
+CREATE INDEX IF NOT EXISTS jobs_status_idx ON jobs (status);
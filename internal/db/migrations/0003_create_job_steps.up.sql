@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS job_steps (
+	id BIGSERIAL PRIMARY KEY,
+	job_id INT NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	position INT NOT NULL DEFAULT 0,
+	depends_on TEXT[] NOT NULL DEFAULT '{}',
+	critical BOOLEAN NOT NULL DEFAULT true,
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempt INT NOT NULL DEFAULT 0,
+	error TEXT NOT NULL DEFAULT '',
+	outputs JSONB NOT NULL DEFAULT '{}',
+	started_at TIMESTAMP WITH TIME ZONE,
+	finished_at TIMESTAMP WITH TIME ZONE,
+	UNIQUE (job_id, name)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS outputs;
+ALTER TABLE uploads DROP COLUMN IF EXISTS profiles;
@@ -0,0 +1,19 @@
+ALTER TABLE uploads ADD COLUMN IF NOT EXISTS profiles TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE TABLE IF NOT EXISTS outputs (
+	id BIGSERIAL PRIMARY KEY,
+	upload_id INT NOT NULL REFERENCES uploads(id) ON DELETE CASCADE,
+	job_id INT REFERENCES jobs(id) ON DELETE SET NULL,
+	name TEXT NOT NULL,
+	path TEXT NOT NULL,
+	codec TEXT NOT NULL DEFAULT '',
+	container TEXT NOT NULL DEFAULT '',
+	bitrate BIGINT,
+	sample_rate INT,
+	channels INT,
+	bit_depth INT,
+	size BIGINT NOT NULL DEFAULT 0,
+	duration_seconds DOUBLE PRECISION,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+	UNIQUE (upload_id, name)
+);
@@ -0,0 +1,6 @@
+ALTER TABLE outputs
+	DROP COLUMN IF EXISTS loudness_after,
+	DROP COLUMN IF EXISTS loudness_before,
+	DROP COLUMN IF EXISTS loudness_target;
+
+ALTER TABLE uploads DROP COLUMN IF EXISTS loudness_target;
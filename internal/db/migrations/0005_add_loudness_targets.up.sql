@@ -0,0 +1,6 @@
+ALTER TABLE uploads ADD COLUMN IF NOT EXISTS loudness_target TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE outputs
+	ADD COLUMN IF NOT EXISTS loudness_target TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS loudness_before JSONB,
+	ADD COLUMN IF NOT EXISTS loudness_after JSONB;
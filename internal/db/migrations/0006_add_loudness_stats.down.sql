@@ -0,0 +1,4 @@
+ALTER TABLE uploads
+	DROP COLUMN IF EXISTS loudness,
+	DROP COLUMN IF EXISTS true_peak_dbtp,
+	DROP COLUMN IF EXISTS loudness_range;
@@ -0,0 +1,4 @@
+ALTER TABLE uploads
+	ADD COLUMN IF NOT EXISTS loudness_range DOUBLE PRECISION,
+	ADD COLUMN IF NOT EXISTS true_peak_dbtp DOUBLE PRECISION,
+	ADD COLUMN IF NOT EXISTS loudness JSONB;
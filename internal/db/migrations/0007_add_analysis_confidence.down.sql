@@ -0,0 +1,3 @@
+ALTER TABLE uploads
+	DROP COLUMN IF EXISTS key_confidence,
+	DROP COLUMN IF EXISTS bpm_confidence;
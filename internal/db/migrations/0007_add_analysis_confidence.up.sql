@@ -0,0 +1,3 @@
+ALTER TABLE uploads
+	ADD COLUMN IF NOT EXISTS bpm_confidence DOUBLE PRECISION,
+	ADD COLUMN IF NOT EXISTS key_confidence DOUBLE PRECISION;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS waveform_peaks;
+ALTER TABLE uploads DROP COLUMN IF EXISTS waveform_path;
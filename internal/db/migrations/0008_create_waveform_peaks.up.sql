@@ -0,0 +1,14 @@
+ALTER TABLE uploads ADD COLUMN IF NOT EXISTS waveform_path TEXT;
+
+CREATE TABLE IF NOT EXISTS waveform_peaks (
+	id BIGSERIAL PRIMARY KEY,
+	upload_id INT NOT NULL REFERENCES uploads(id) ON DELETE CASCADE,
+	samples_per_pixel INT NOT NULL,
+	channels INT NOT NULL,
+	sample_rate INT NOT NULL,
+	bits INT NOT NULL,
+	length INT NOT NULL,
+	path TEXT NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+	UNIQUE (upload_id, samples_per_pixel)
+);
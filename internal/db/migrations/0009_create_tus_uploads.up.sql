@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS tus_uploads (
+	id TEXT PRIMARY KEY,
+	upload_length BIGINT NOT NULL,
+	upload_offset BIGINT NOT NULL DEFAULT 0,
+	metadata JSONB NOT NULL DEFAULT '{}',
+	raw_metadata TEXT NOT NULL DEFAULT '',
+	chunks TEXT[] NOT NULL DEFAULT '{}',
+	upload_id INT REFERENCES uploads(id) ON DELETE SET NULL,
+	expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS tus_uploads_expires_at_idx ON tus_uploads (expires_at);
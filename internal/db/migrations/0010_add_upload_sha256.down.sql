@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS uploads_sha256_idx;
+
+ALTER TABLE uploads
+	DROP COLUMN IF EXISTS duplicate_of,
+	DROP COLUMN IF EXISTS sha256;
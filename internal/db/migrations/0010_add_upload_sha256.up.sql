@@ -0,0 +1,5 @@
+ALTER TABLE uploads
+	ADD COLUMN IF NOT EXISTS sha256 TEXT,
+	ADD COLUMN IF NOT EXISTS duplicate_of INT REFERENCES uploads(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS uploads_sha256_idx ON uploads (sha256);
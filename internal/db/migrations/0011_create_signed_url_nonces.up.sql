@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS signed_url_nonces (
+	nonce TEXT PRIMARY KEY,
+	expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	used_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS signed_url_nonces_expires_at_idx ON signed_url_nonces (expires_at);
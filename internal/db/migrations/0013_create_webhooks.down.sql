@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS jobs_enqueue_webhooks ON jobs;
+DROP FUNCTION IF EXISTS enqueue_job_webhooks();
+DROP TABLE IF EXISTS webhook_delivery_attempts;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
@@ -0,0 +1,80 @@
+-- upload_id NULL subscribes to the jobs of every upload.
+CREATE TABLE IF NOT EXISTS webhooks (
+	id SERIAL PRIMARY KEY,
+	url TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	upload_id INT REFERENCES uploads(id) ON DELETE CASCADE,
+	events TEXT[] NOT NULL DEFAULT '{job.queued,job.running,job.done,job.failed}',
+	active BOOLEAN NOT NULL DEFAULT true,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS webhooks_upload_id_idx ON webhooks (upload_id);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+	id BIGSERIAL PRIMARY KEY,
+	webhook_id INT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+	job_id INT REFERENCES jobs(id) ON DELETE SET NULL,
+	event TEXT NOT NULL,
+	payload JSONB NOT NULL,
+	-- pending until a 2xx response (delivered) or the last attempt (failed)
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempts INT NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+	last_status_code INT,
+	last_error TEXT NOT NULL DEFAULT '',
+	delivered_at TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_idx ON webhook_deliveries (webhook_id, id DESC);
+
+CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+	id BIGSERIAL PRIMARY KEY,
+	delivery_id BIGINT NOT NULL REFERENCES webhook_deliveries(id) ON DELETE CASCADE,
+	attempt INT NOT NULL,
+	status_code INT,
+	error TEXT NOT NULL DEFAULT '',
+	duration_ms INT NOT NULL,
+	attempted_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_delivery_attempts_delivery_idx ON webhook_delivery_attempts (delivery_id, attempt);
+
+-- Deliveries are queued by a trigger so every writer of jobs.status (API,
+-- worker pool, pipeline, manual PATCH) produces them in its own transaction.
+CREATE OR REPLACE FUNCTION enqueue_job_webhooks() RETURNS trigger AS $$
+DECLARE
+	ev TEXT := 'job.' || NEW.status;
+BEGIN
+	IF TG_OP = 'UPDATE' AND NEW.status IS NOT DISTINCT FROM OLD.status THEN
+		RETURN NEW;
+	END IF;
+	IF NEW.status NOT IN ('queued', 'running', 'done', 'failed') THEN
+		RETURN NEW;
+	END IF;
+	INSERT INTO webhook_deliveries (webhook_id, job_id, event, payload)
+	SELECT w.id, NEW.id, ev, jsonb_build_object(
+		'event', ev,
+		'job_id', NEW.id,
+		'upload_id', NEW.upload_id,
+		'type', NEW.type,
+		'status', NEW.status,
+		'previous_status', CASE WHEN TG_OP = 'UPDATE' THEN OLD.status END,
+		'progress', NEW.progress,
+		'retry_count', NEW.retry_count,
+		'error', NULLIF(NEW.last_error, ''),
+		'occurred_at', now())
+	FROM webhooks w
+	WHERE w.active
+	  AND (w.upload_id IS NULL OR w.upload_id = NEW.upload_id)
+	  AND ev = ANY (w.events);
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS jobs_enqueue_webhooks ON jobs;
+CREATE TRIGGER jobs_enqueue_webhooks
+	AFTER INSERT OR UPDATE OF status ON jobs
+	FOR EACH ROW EXECUTE FUNCTION enqueue_job_webhooks();
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS jobs_record_events ON jobs;
+DROP FUNCTION IF EXISTS record_job_event();
+DROP TABLE IF EXISTS job_events;
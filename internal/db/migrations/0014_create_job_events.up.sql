@@ -0,0 +1,52 @@
+-- Every status, progress or log change of a job, in commit order per job.
+-- The id doubles as the SSE event id clients resume from.
+CREATE TABLE IF NOT EXISTS job_events (
+	id BIGSERIAL PRIMARY KEY,
+	job_id INT NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+	upload_id INT,
+	kind TEXT NOT NULL, -- status, progress or log
+	status TEXT,
+	progress INT,
+	log TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS job_events_job_idx ON job_events (job_id, id);
+CREATE INDEX IF NOT EXISTS job_events_upload_idx ON job_events (upload_id, id);
+
+-- The notification only carries ids (NOTIFY payloads are limited to 8000
+-- bytes and log lines can hold ffmpeg stderr); listeners read the rows.
+CREATE OR REPLACE FUNCTION record_job_event() RETURNS trigger AS $$
+DECLARE
+	k TEXT;
+	line TEXT := '';
+	eid BIGINT;
+BEGIN
+	IF TG_OP = 'INSERT' THEN
+		k := 'status';
+	ELSE
+		IF length(COALESCE(NEW.logs, '')) > length(COALESCE(OLD.logs, '')) THEN
+			line := btrim(substr(NEW.logs, length(COALESCE(OLD.logs, '')) + 1), E'\n');
+		END IF;
+		IF NEW.status IS DISTINCT FROM OLD.status THEN
+			k := 'status';
+		ELSIF NEW.progress IS DISTINCT FROM OLD.progress THEN
+			k := 'progress';
+		ELSIF line <> '' THEN
+			k := 'log';
+		ELSE
+			RETURN NEW;
+		END IF;
+	END IF;
+	INSERT INTO job_events (job_id, upload_id, kind, status, progress, log)
+	VALUES (NEW.id, NEW.upload_id, k, NEW.status, NEW.progress, line)
+	RETURNING id INTO eid;
+	PERFORM pg_notify('job_events', json_build_object('id', eid, 'job_id', NEW.id, 'upload_id', NEW.upload_id)::text);
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS jobs_record_events ON jobs;
+CREATE TRIGGER jobs_record_events
+	AFTER INSERT OR UPDATE OF status, progress, logs ON jobs
+	FOR EACH ROW EXECUTE FUNCTION record_job_event();
@@ -0,0 +1,32 @@
+-- Jobs can end as "cancelled"; webhooks get a job.cancelled event for it.
+ALTER TABLE webhooks ALTER COLUMN events SET DEFAULT '{job.queued,job.running,job.done,job.failed,job.cancelled}';
+
+CREATE OR REPLACE FUNCTION enqueue_job_webhooks() RETURNS trigger AS $$
+DECLARE
+	ev TEXT := 'job.' || NEW.status;
+BEGIN
+	IF TG_OP = 'UPDATE' AND NEW.status IS NOT DISTINCT FROM OLD.status THEN
+		RETURN NEW;
+	END IF;
+	IF NEW.status NOT IN ('queued', 'running', 'done', 'failed', 'cancelled') THEN
+		RETURN NEW;
+	END IF;
+	INSERT INTO webhook_deliveries (webhook_id, job_id, event, payload)
+	SELECT w.id, NEW.id, ev, jsonb_build_object(
+		'event', ev,
+		'job_id', NEW.id,
+		'upload_id', NEW.upload_id,
+		'type', NEW.type,
+		'status', NEW.status,
+		'previous_status', CASE WHEN TG_OP = 'UPDATE' THEN OLD.status END,
+		'progress', NEW.progress,
+		'retry_count', NEW.retry_count,
+		'error', NULLIF(NEW.last_error, ''),
+		'occurred_at', now())
+	FROM webhooks w
+	WHERE w.active
+	  AND (w.upload_id IS NULL OR w.upload_id = NEW.upload_id)
+	  AND ev = ANY (w.events);
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
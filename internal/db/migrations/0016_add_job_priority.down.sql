@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS jobs_queued_priority_idx;
+ALTER TABLE jobs DROP COLUMN IF EXISTS priority;
@@ -0,0 +1,4 @@
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS priority TEXT NOT NULL DEFAULT 'normal'
+	CHECK (priority IN ('high', 'normal', 'low'));
+
+CREATE INDEX IF NOT EXISTS jobs_queued_priority_idx ON jobs (priority) WHERE status = 'queued';
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS job_schedules;
+DROP INDEX IF EXISTS jobs_scheduled_run_at_idx;
+ALTER TABLE jobs DROP COLUMN IF EXISTS run_at;
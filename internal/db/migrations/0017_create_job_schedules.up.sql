@@ -0,0 +1,19 @@
+-- Jobs with a run_at in the future wait as "scheduled", without an outbox
+-- entry, until the scheduler promotes them to "queued".
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS run_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS jobs_scheduled_run_at_idx ON jobs (run_at) WHERE status = 'scheduled';
+
+-- Recurring maintenance tasks. The tasks themselves are defined in code;
+-- these rows hold their interval and the shared run state, so each runs once
+-- per interval however many API replicas there are.
+CREATE TABLE IF NOT EXISTS job_schedules (
+	name TEXT PRIMARY KEY,
+	every_seconds INT NOT NULL CHECK (every_seconds > 0),
+	enabled BOOLEAN NOT NULL DEFAULT true,
+	next_run_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+	last_run_at TIMESTAMP WITH TIME ZONE,
+	last_duration_ms INT,
+	last_error TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
@@ -0,0 +1,22 @@
+-- A snapshot of every job that failed for good, taken when its last retry
+-- failed. Requeueing the job keeps the row and stamps requeued_at; a job that
+-- fails again gets a new row.
+CREATE TABLE IF NOT EXISTS dead_letters (
+	id BIGSERIAL PRIMARY KEY,
+	job_id INT NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+	upload_id INT,
+	type TEXT NOT NULL DEFAULT '',
+	priority TEXT NOT NULL DEFAULT 'normal',
+	worker TEXT NOT NULL DEFAULT '',
+	retry_count INT NOT NULL,
+	max_retries INT NOT NULL,
+	last_error TEXT NOT NULL DEFAULT '',
+	logs TEXT NOT NULL DEFAULT '',
+	-- the job_steps rows of the last attempt
+	steps JSONB NOT NULL DEFAULT '[]',
+	failed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+	requeued_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS dead_letters_job_id_idx ON dead_letters (job_id);
+CREATE INDEX IF NOT EXISTS dead_letters_open_idx ON dead_letters (failed_at) WHERE requeued_at IS NULL;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS jobs_lease_expires_idx;
+ALTER TABLE jobs DROP COLUMN IF EXISTS heartbeat_at;
+ALTER TABLE jobs DROP COLUMN IF EXISTS lease_expires_at;
+ALTER TABLE jobs DROP COLUMN IF EXISTS claimed_by;
@@ -0,0 +1,14 @@
+-- The worker running a job owns it until lease_expires_at and keeps pushing
+-- that forward while it is alive; the reaper requeues jobs whose lease ran
+-- out.
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS claimed_by TEXT;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS lease_expires_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS heartbeat_at TIMESTAMP WITH TIME ZONE;
+
+-- Jobs already running have no owner to renew their lease; give them the
+-- default job timeout before the reaper considers them dead.
+UPDATE jobs SET lease_expires_at = now() + interval '10 minutes'
+WHERE status IN ('running', 'processing', 'cancelling') AND lease_expires_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS jobs_lease_expires_idx ON jobs (lease_expires_at)
+	WHERE status IN ('running', 'processing', 'cancelling');
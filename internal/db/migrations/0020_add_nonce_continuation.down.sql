@@ -0,0 +1 @@
+ALTER TABLE signed_url_nonces DROP COLUMN IF EXISTS continuation_hash;
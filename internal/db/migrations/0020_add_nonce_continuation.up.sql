@@ -0,0 +1,3 @@
+-- the hash of the token a single-use link's first response hands out; Range
+-- requests presenting it may continue that download
+ALTER TABLE signed_url_nonces ADD COLUMN IF NOT EXISTS continuation_hash TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ClaimNonce records the first use of a single-use URL token; ok is false
+// if it was already used. continuation is the token the first response
+// hands to its client so it can continue the download (see ContinueNonce);
+// only its hash is stored. expiresAt (the URL's expiry) only bounds how long
+// the row is kept.
+func (d *DB) ClaimNonce(ctx context.Context, nonce, continuation string, expiresAt time.Time) (ok bool, err error) {
+	err = d.Pool.QueryRow(ctx,
+		`INSERT INTO signed_url_nonces (nonce, continuation_hash, expires_at) VALUES ($1,$2,$3)
+		 ON CONFLICT (nonce) DO NOTHING
+		 RETURNING true`,
+		nonce, hashContinuation(continuation), expiresAt).Scan(&ok)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return ok, err
+}
+
+// ContinueNonce reports whether continuation is the token handed out with
+// the first use of nonce.
+func (d *DB) ContinueNonce(ctx context.Context, nonce, continuation string) (bool, error) {
+	var ok bool
+	err := d.Pool.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM signed_url_nonces
+		   WHERE nonce=$1 AND continuation_hash <> '' AND continuation_hash=$2 AND expires_at > now())`,
+		nonce, hashContinuation(continuation)).Scan(&ok)
+	return ok, err
+}
+
+func hashContinuation(token string) string {
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ReleaseNonce forgets a token's use, so a first request that could not be
+// served does not use up the link.
+func (d *DB) ReleaseNonce(ctx context.Context, nonce string) error {
+	_, err := d.Pool.Exec(ctx, `DELETE FROM signed_url_nonces WHERE nonce=$1`, nonce)
+	return err
+}
+
+// PurgeExpiredNonces deletes tokens whose URLs can no longer verify.
+func (d *DB) PurgeExpiredNonces(ctx context.Context) (int64, error) {
+	tag, err := d.Pool.Exec(ctx, `DELETE FROM signed_url_nonces WHERE expires_at < now()`)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// OutboxEntry is a message waiting to be published to NATS.
+type OutboxEntry struct {
+	ID        int64
+	Subject   string
+	Payload   []byte
+	Attempts  int
+	CreatedAt time.Time
+}
+
+// InsertOutbox records payload for later publishing. Call it with the same
+// transaction that writes the rows the message refers to.
+func InsertOutbox(ctx context.Context, q Execer, subject string, payload any) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("outbox payload: %w", err)
+	}
+	_, err = q.Exec(ctx, `INSERT INTO outbox (subject, payload) VALUES ($1, $2)`, subject, b)
+	return err
+}
+
+// RelayOutbox locks up to limit pending entries, hands each to publish in id
+// order and marks it sent. It stops at the first publish error so ordering is
+// kept; that entry's attempt count and error are recorded. Concurrent relays
+// skip rows another relay holds.
+func (d *DB) RelayOutbox(ctx context.Context, limit int, publish func(e OutboxEntry) error) (sent int, err error) {
+	err = d.WithTx(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx,
+			`SELECT id, subject, payload, attempts, created_at FROM outbox
+			 WHERE sent_at IS NULL ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED`, limit)
+		if err != nil {
+			return err
+		}
+		var entries []OutboxEntry
+		for rows.Next() {
+			var e OutboxEntry
+			if err := rows.Scan(&e.ID, &e.Subject, &e.Payload, &e.Attempts, &e.CreatedAt); err != nil {
+				rows.Close()
+				return err
+			}
+			entries = append(entries, e)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, e := range entries {
+			if perr := publish(e); perr != nil {
+				_, err := tx.Exec(ctx,
+					`UPDATE outbox SET attempts = attempts + 1, last_error = $1 WHERE id=$2`, perr.Error(), e.ID)
+				if err != nil {
+					return err
+				}
+				return nil
+			}
+			if _, err := tx.Exec(ctx, `UPDATE outbox SET sent_at = now(), attempts = attempts + 1 WHERE id=$1`, e.ID); err != nil {
+				return err
+			}
+			sent++
+		}
+		return nil
+	})
+	return sent, err
+}
+
+// OutboxBacklog returns the number of unsent entries and the age of the oldest one.
+func (d *DB) OutboxBacklog(ctx context.Context) (pending int64, oldest time.Duration, err error) {
+	var oldestSecs float64
+	err = d.Pool.QueryRow(ctx,
+		`SELECT count(*), COALESCE(EXTRACT(EPOCH FROM now() - min(created_at)), 0)
+		 FROM outbox WHERE sent_at IS NULL`).Scan(&pending, &oldestSecs)
+	return pending, time.Duration(oldestSecs * float64(time.Second)), err
+}
+
+// PurgeSentOutbox deletes entries published more than olderThan ago.
+func (d *DB) PurgeSentOutbox(ctx context.Context, olderThan time.Duration) (int64, error) {
+	tag, err := d.Pool.Exec(ctx,
+		`DELETE FROM outbox WHERE sent_at IS NOT NULL AND sent_at < now() - make_interval(secs => $1)`,
+		olderThan.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Output is one transcoded rendition of an upload, named after its profile.
+type Output struct {
+	ID         int64    `json:"id"`
+	UploadID   int64    `json:"upload_id"`
+	JobID      *int64   `json:"job_id,omitempty"`
+	Name       string   `json:"name"`
+	Path       string   `json:"path"`
+	Codec      string   `json:"codec"`
+	Container  string   `json:"container"`
+	Bitrate    *int64   `json:"bitrate,omitempty"` // bits/s
+	SampleRate *int     `json:"sample_rate,omitempty"`
+	Channels   *int     `json:"channels,omitempty"`
+	BitDepth   *int     `json:"bit_depth,omitempty"`
+	Size       int64    `json:"size"`
+	Duration   *float64 `json:"duration_seconds,omitempty"`
+	// LoudnessTarget names the normalization preset ("" when not normalized);
+	// LoudnessBefore is the measured input loudness, LoudnessAfter the
+	// normalization pass's before/after figures.
+	LoudnessTarget string          `json:"loudness_target,omitempty"`
+	LoudnessBefore json.RawMessage `json:"loudness_before,omitempty"`
+	LoudnessAfter  json.RawMessage `json:"loudness_after,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+// UpsertOutput records an output, replacing a previous one with the same
+// name for the upload (e.g. from an earlier attempt).
+func (d *DB) UpsertOutput(ctx context.Context, o *Output) error {
+	return d.Pool.QueryRow(ctx,
+		`INSERT INTO outputs (upload_id, job_id, name, path, codec, container, bitrate, sample_rate, channels, bit_depth, size,
+		                      duration_seconds, loudness_target, loudness_before, loudness_after)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15)
+		 ON CONFLICT (upload_id, name) DO UPDATE SET
+		   job_id = EXCLUDED.job_id, path = EXCLUDED.path, codec = EXCLUDED.codec, container = EXCLUDED.container,
+		   bitrate = EXCLUDED.bitrate, sample_rate = EXCLUDED.sample_rate, channels = EXCLUDED.channels,
+		   bit_depth = EXCLUDED.bit_depth, size = EXCLUDED.size, duration_seconds = EXCLUDED.duration_seconds,
+		   loudness_target = EXCLUDED.loudness_target, loudness_before = EXCLUDED.loudness_before,
+		   loudness_after = EXCLUDED.loudness_after, created_at = now()
+		 RETURNING id, created_at`,
+		o.UploadID, o.JobID, o.Name, o.Path, o.Codec, o.Container, o.Bitrate, o.SampleRate, o.Channels,
+		o.BitDepth, o.Size, o.Duration, o.LoudnessTarget, o.LoudnessBefore, o.LoudnessAfter,
+	).Scan(&o.ID, &o.CreatedAt)
+}
+
+// ListOutputs returns an upload's outputs ordered by name.
+func (d *DB) ListOutputs(ctx context.Context, uploadID int64) ([]*Output, error) {
+	rows, err := d.Pool.Query(ctx,
+		`SELECT id, upload_id, job_id, name, path, codec, container, bitrate, sample_rate, channels, bit_depth,
+		        size, duration_seconds, loudness_target, loudness_before, loudness_after, created_at
+		 FROM outputs WHERE upload_id=$1 ORDER BY name`, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	outs := []*Output{}
+	for rows.Next() {
+		o := &Output{}
+		if err := rows.Scan(&o.ID, &o.UploadID, &o.JobID, &o.Name, &o.Path, &o.Codec, &o.Container, &o.Bitrate,
+			&o.SampleRate, &o.Channels, &o.BitDepth, &o.Size, &o.Duration, &o.LoudnessTarget, &o.LoudnessBefore, &o.LoudnessAfter,
+			&o.CreatedAt); err != nil {
+			return nil, err
+		}
+		outs = append(outs, o)
+	}
+	return outs, rows.Err()
+}
+
+// GetOutput returns the named output of an upload; pgx.ErrNoRows if absent.
+func (d *DB) GetOutput(ctx context.Context, uploadID int64, name string) (*Output, error) {
+	o := &Output{}
+	err := d.Pool.QueryRow(ctx,
+		`SELECT id, upload_id, job_id, name, path, codec, container, bitrate, sample_rate, channels, bit_depth,
+		        size, duration_seconds, loudness_target, loudness_before, loudness_after, created_at
+		 FROM outputs WHERE upload_id=$1 AND name=$2`, uploadID, name,
+	).Scan(&o.ID, &o.UploadID, &o.JobID, &o.Name, &o.Path, &o.Codec, &o.Container, &o.Bitrate,
+		&o.SampleRate, &o.Channels, &o.BitDepth, &o.Size, &o.Duration, &o.LoudnessTarget, &o.LoudnessBefore, &o.LoudnessAfter,
+		&o.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// ClearUploadResults forgets the outputs, peaks, waveform and streaming
+// package recorded for an upload, e.g. after its job was cancelled. The
+// stored files are the caller's to delete.
+func (d *DB) ClearUploadResults(ctx context.Context, uploadID int64) error {
+	return d.WithTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM outputs WHERE upload_id=$1`, uploadID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM waveform_peaks WHERE upload_id=$1`, uploadID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx,
+			`UPDATE uploads SET output_path=NULL, waveform_path=NULL, streaming=NULL WHERE id=$1`, uploadID)
+		return err
+	})
+}
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// WaveformPeaks describes a stored audiowaveform .dat file for one zoom level.
+type WaveformPeaks struct {
+	UploadID        int64     `json:"upload_id"`
+	SamplesPerPixel int       `json:"samples_per_pixel"`
+	Channels        int       `json:"channels"`
+	SampleRate      int       `json:"sample_rate"`
+	Bits            int       `json:"bits"`
+	Length          int       `json:"length"`
+	Path            string    `json:"path"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// UpsertWaveformPeaks records (or replaces) the peaks file for a zoom level.
+func (d *DB) UpsertWaveformPeaks(ctx context.Context, p *WaveformPeaks) error {
+	return d.Pool.QueryRow(ctx,
+		`INSERT INTO waveform_peaks (upload_id, samples_per_pixel, channels, sample_rate, bits, length, path)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7)
+		 ON CONFLICT (upload_id, samples_per_pixel) DO UPDATE SET
+		   channels = EXCLUDED.channels, sample_rate = EXCLUDED.sample_rate, bits = EXCLUDED.bits,
+		   length = EXCLUDED.length, path = EXCLUDED.path, created_at = now()
+		 RETURNING created_at`,
+		p.UploadID, p.SamplesPerPixel, p.Channels, p.SampleRate, p.Bits, p.Length, p.Path,
+	).Scan(&p.CreatedAt)
+}
+
+// ListWaveformPeaks returns an upload's peak levels, finest zoom first.
+func (d *DB) ListWaveformPeaks(ctx context.Context, uploadID int64) ([]*WaveformPeaks, error) {
+	rows, err := d.Pool.Query(ctx,
+		`SELECT upload_id, samples_per_pixel, channels, sample_rate, bits, length, path, created_at
+		 FROM waveform_peaks WHERE upload_id=$1 ORDER BY samples_per_pixel`, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	levels := []*WaveformPeaks{}
+	for rows.Next() {
+		p := &WaveformPeaks{}
+		if err := rows.Scan(&p.UploadID, &p.SamplesPerPixel, &p.Channels, &p.SampleRate, &p.Bits, &p.Length,
+			&p.Path, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		levels = append(levels, p)
+	}
+	return levels, rows.Err()
+}
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// JobSchedule is the stored state of a recurring maintenance task.
+type JobSchedule struct {
+	Name           string     `json:"name"`
+	EverySeconds   int        `json:"every_seconds"`
+	Enabled        bool       `json:"enabled"`
+	NextRunAt      time.Time  `json:"next_run_at"`
+	LastRunAt      *time.Time `json:"last_run_at,omitempty"`
+	LastDurationMS *int       `json:"last_duration_ms,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+}
+
+// TryAdvisoryXactLock takes the transaction-scoped advisory lock named key
+// without waiting; it is released when tx ends.
+func TryAdvisoryXactLock(ctx context.Context, tx pgx.Tx, key string) (bool, error) {
+	var ok bool
+	err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock(hashtext($1))`, key).Scan(&ok)
+	return ok, err
+}
+
+// PromoteDueJobs moves up to limit scheduled jobs whose run_at has passed to
+// "queued", oldest run_at first, and returns them so the caller can publish
+// them in the same transaction.
+func PromoteDueJobs(ctx context.Context, tx pgx.Tx, limit int) ([]JobRef, error) {
+	rows, err := tx.Query(ctx,
+		`UPDATE jobs SET status='queued', logs = COALESCE(logs,'') || E'\n' || 'scheduler: promoted'
+		 WHERE id IN (
+			SELECT id FROM jobs WHERE status='scheduled' AND run_at <= now()
+			ORDER BY run_at LIMIT $1 FOR UPDATE SKIP LOCKED)
+		 RETURNING id, upload_id, type, priority`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var jobs []JobRef
+	for rows.Next() {
+		var j JobRef
+		if err := rows.Scan(&j.ID, &j.UploadID, &j.Type, &j.Priority); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// EnsureJobSchedule creates the schedule row with its default interval, due
+// one interval from now. An existing row keeps its (possibly edited) state.
+func (d *DB) EnsureJobSchedule(ctx context.Context, name string, every time.Duration) error {
+	_, err := d.Pool.Exec(ctx,
+		`INSERT INTO job_schedules (name, every_seconds, next_run_at)
+		 VALUES ($1, $2::int, now() + make_interval(secs => $2::int))
+		 ON CONFLICT (name) DO NOTHING`, name, int(every.Seconds()))
+	return err
+}
+
+// ClaimJobSchedule reports whether the named schedule is due and, if so,
+// moves its next run one interval ahead. Of several replicas asking at the
+// same time exactly one gets true.
+func (d *DB) ClaimJobSchedule(ctx context.Context, name string) (bool, error) {
+	tag, err := d.Pool.Exec(ctx,
+		`UPDATE job_schedules SET last_run_at = now(), next_run_at = now() + make_interval(secs => every_seconds)
+		 WHERE name=$1 AND enabled AND next_run_at <= now()`, name)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// RecordJobScheduleRun stores the outcome of a claimed run.
+func (d *DB) RecordJobScheduleRun(ctx context.Context, name string, took time.Duration, errMsg string) error {
+	_, err := d.Pool.Exec(ctx,
+		`UPDATE job_schedules SET last_duration_ms=$2, last_error=$3 WHERE name=$1`,
+		name, int(took.Milliseconds()), errMsg)
+	return err
+}
+
+// ListJobSchedules returns every schedule by name.
+func (d *DB) ListJobSchedules(ctx context.Context) ([]JobSchedule, error) {
+	rows, err := d.Pool.Query(ctx,
+		`SELECT name, every_seconds, enabled, next_run_at, last_run_at, last_duration_ms, last_error
+		 FROM job_schedules ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	schedules := []JobSchedule{}
+	for rows.Next() {
+		var s JobSchedule
+		if err := rows.Scan(&s.Name, &s.EverySeconds, &s.Enabled, &s.NextRunAt, &s.LastRunAt, &s.LastDurationMS, &s.LastError); err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, rows.Err()
+}
+
+// UpdateJobSchedule changes a schedule's interval and/or enabled flag; nil
+// leaves a field as is. A new interval counts from the last run. It returns
+// pgx.ErrNoRows for an unknown name.
+func (d *DB) UpdateJobSchedule(ctx context.Context, name string, every *time.Duration, enabled *bool) (*JobSchedule, error) {
+	var secs *int
+	if every != nil {
+		n := int(every.Seconds())
+		secs = &n
+	}
+	s := &JobSchedule{}
+	err := d.Pool.QueryRow(ctx,
+		`UPDATE job_schedules SET
+		   every_seconds = COALESCE($2::int, every_seconds),
+		   enabled = COALESCE($3, enabled),
+		   next_run_at = CASE WHEN $2::int IS NULL THEN next_run_at
+		                      ELSE COALESCE(last_run_at, created_at) + make_interval(secs => $2::int) END
+		 WHERE name=$1
+		 RETURNING name, every_seconds, enabled, next_run_at, last_run_at, last_duration_ms, last_error`,
+		name, secs, enabled).Scan(&s.Name, &s.EverySeconds, &s.Enabled, &s.NextRunAt, &s.LastRunAt, &s.LastDurationMS, &s.LastError)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
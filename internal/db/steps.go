@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// JobStep is the persisted state of one pipeline stage of a job.
+type JobStep struct {
+	Name       string          `json:"name"`
+	Position   int             `json:"position"`
+	DependsOn  []string        `json:"depends_on"`
+	Critical   bool            `json:"critical"`
+	Status     string          `json:"status"`
+	Attempt    int             `json:"attempt"`
+	Error      string          `json:"error,omitempty"`
+	Outputs    json.RawMessage `json:"outputs"`
+	StartedAt  *time.Time      `json:"started_at,omitempty"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+	DurationMs *int64          `json:"duration_ms,omitempty"`
+}
+
+// InitJobSteps (re)creates the step rows for a new attempt: every step goes
+// back to pending and its attempt counter is bumped.
+func (d *DB) InitJobSteps(ctx context.Context, jobID int64, steps []JobStep) error {
+	for _, s := range steps {
+		deps := s.DependsOn
+		if deps == nil {
+			deps = []string{}
+		}
+		_, err := d.Pool.Exec(ctx,
+			`INSERT INTO job_steps (job_id, name, position, depends_on, critical, status, attempt)
+			 VALUES ($1,$2,$3,$4,$5,'pending',1)
+			 ON CONFLICT (job_id, name) DO UPDATE SET
+			   position = EXCLUDED.position, depends_on = EXCLUDED.depends_on, critical = EXCLUDED.critical,
+			   status = 'pending', attempt = job_steps.attempt + 1, error = '', outputs = '{}',
+			   started_at = NULL, finished_at = NULL`,
+			jobID, s.Name, s.Position, deps, s.Critical)
+		if err != nil {
+			return fmt.Errorf("init step %s: %w", s.Name, err)
+		}
+	}
+	return nil
+}
+
+// StartJobStep marks a step running.
+func (d *DB) StartJobStep(ctx context.Context, jobID int64, name string) error {
+	_, err := d.Pool.Exec(ctx,
+		`UPDATE job_steps SET status='running', started_at=now() WHERE job_id=$1 AND name=$2`, jobID, name)
+	return err
+}
+
+// FinishJobStep records a step's final status, error text and outputs.
+func (d *DB) FinishJobStep(ctx context.Context, jobID int64, name, status, errMsg string, outputs any) error {
+	if outputs == nil {
+		outputs = map[string]any{}
+	}
+	b, err := json.Marshal(outputs)
+	if err != nil {
+		return fmt.Errorf("step outputs: %w", err)
+	}
+	_, err = d.Pool.Exec(ctx,
+		`UPDATE job_steps SET status=$1, error=$2, outputs=$3,
+		   finished_at=now(), started_at=COALESCE(started_at, now())
+		 WHERE job_id=$4 AND name=$5`, status, errMsg, b, jobID, name)
+	return err
+}
+
+// ListJobSteps returns a job's steps in pipeline order.
+func (d *DB) ListJobSteps(ctx context.Context, jobID int64) ([]*JobStep, error) {
+	rows, err := d.Pool.Query(ctx,
+		`SELECT name, position, depends_on, critical, status, attempt, error, outputs, started_at, finished_at
+		 FROM job_steps WHERE job_id=$1 ORDER BY position, name`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	steps := []*JobStep{}
+	for rows.Next() {
+		s := &JobStep{}
+		if err := rows.Scan(&s.Name, &s.Position, &s.DependsOn, &s.Critical, &s.Status, &s.Attempt,
+			&s.Error, &s.Outputs, &s.StartedAt, &s.FinishedAt); err != nil {
+			return nil, err
+		}
+		if s.StartedAt != nil && s.FinishedAt != nil {
+			ms := s.FinishedAt.Sub(*s.StartedAt).Milliseconds()
+			s.DurationMs = &ms
+		}
+		steps = append(steps, s)
+	}
+	return steps, rows.Err()
+}
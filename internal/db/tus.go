@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrTusCompleted is returned by CompleteTusUpload when the upload was
+// already completed (or terminated) by another request.
+var ErrTusCompleted = errors.New("tus upload already completed")
+
+// TusUpload is an in-progress (or recently finished) resumable upload. The
+// received bytes live in storage as one object per PATCH request, listed in
+// Chunks in offset order.
+type TusUpload struct {
+	ID          string
+	Length      int64
+	Offset      int64
+	Metadata    map[string]string
+	RawMetadata string // Upload-Metadata header as sent, echoed on HEAD
+	Chunks      []string
+	UploadID    *int64 // set once the file was assembled and queued
+	ExpiresAt   time.Time
+	CreatedAt   time.Time
+}
+
+// CreateTusUpload inserts a new resumable upload at offset 0.
+func (d *DB) CreateTusUpload(ctx context.Context, u *TusUpload) error {
+	if u.Metadata == nil {
+		u.Metadata = map[string]string{}
+	}
+	return d.Pool.QueryRow(ctx,
+		`INSERT INTO tus_uploads (id, upload_length, metadata, raw_metadata, expires_at)
+		 VALUES ($1,$2,$3,$4,$5) RETURNING created_at`,
+		u.ID, u.Length, u.Metadata, u.RawMetadata, u.ExpiresAt,
+	).Scan(&u.CreatedAt)
+}
+
+// GetTusUpload returns the upload or pgx.ErrNoRows.
+func (d *DB) GetTusUpload(ctx context.Context, id string) (*TusUpload, error) {
+	u := &TusUpload{}
+	err := d.Pool.QueryRow(ctx,
+		`SELECT id, upload_length, upload_offset, metadata, raw_metadata, chunks, upload_id, expires_at, created_at
+		 FROM tus_uploads WHERE id=$1`, id,
+	).Scan(&u.ID, &u.Length, &u.Offset, &u.Metadata, &u.RawMetadata, &u.Chunks, &u.UploadID, &u.ExpiresAt, &u.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// AppendTusChunk advances the offset by n and records chunk, but only if the
+// upload is still at offset; false means another request got there first
+// (the caller should discard its chunk). expiresAt extends the deadline.
+func (d *DB) AppendTusChunk(ctx context.Context, id string, offset, n int64, chunk string, expiresAt time.Time) (bool, error) {
+	tag, err := d.Pool.Exec(ctx,
+		`UPDATE tus_uploads
+		 SET upload_offset = upload_offset + $3, chunks = array_append(chunks, $4), expires_at = $5, updated_at = now()
+		 WHERE id=$1 AND upload_offset=$2 AND upload_offset + $3 <= upload_length`,
+		id, offset, n, chunk, expiresAt)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// CompleteTusUpload links the assembled upload and drops the chunk list. Use
+// the transaction that creates the upload row, and roll it back on
+// ErrTusCompleted: a concurrent request already created one.
+func CompleteTusUpload(ctx context.Context, q Execer, id string, uploadID int64) error {
+	tag, err := q.Exec(ctx,
+		`UPDATE tus_uploads SET upload_id=$2, chunks='{}', updated_at=now()
+		 WHERE id=$1 AND upload_id IS NULL`, id, uploadID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTusCompleted
+	}
+	return nil
+}
+
+// DeleteTusUpload removes the row; the caller deletes stored chunks.
+func (d *DB) DeleteTusUpload(ctx context.Context, id string) error {
+	_, err := d.Pool.Exec(ctx, `DELETE FROM tus_uploads WHERE id=$1`, id)
+	return err
+}
+
+// ExpiredTusUploads lists up to limit uploads whose deadline has passed.
+func (d *DB) ExpiredTusUploads(ctx context.Context, limit int) ([]*TusUpload, error) {
+	rows, err := d.Pool.Query(ctx,
+		`SELECT id, upload_length, upload_offset, chunks, upload_id, expires_at
+		 FROM tus_uploads WHERE expires_at < now() ORDER BY expires_at LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*TusUpload
+	for rows.Next() {
+		u := &TusUpload{}
+		if err := rows.Scan(&u.ID, &u.Length, &u.Offset, &u.Chunks, &u.UploadID, &u.ExpiresAt); err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,256 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Webhook is a subscription to job state changes. Deliveries are queued by
+// the jobs_enqueue_webhooks trigger; UploadID nil subscribes to every upload.
+type Webhook struct {
+	ID        int64     `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`
+	UploadID  *int64    `json:"upload_id"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is one event queued for one subscription.
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	WebhookID      int64           `json:"webhook_id"`
+	JobID          *int64          `json:"job_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"` // pending, delivered or failed
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"` // pending only
+	LastStatusCode *int            `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+// WebhookAttempt is the outcome of one POST of a delivery.
+type WebhookAttempt struct {
+	Attempt     int       `json:"attempt"`
+	StatusCode  *int      `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMs  int64     `json:"duration_ms"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+// DueDelivery is a delivery handed to the dispatcher with its target.
+type DueDelivery struct {
+	ID       int64
+	Event    string
+	Payload  []byte
+	Attempts int // attempts made before this one
+	URL      string
+	Secret   string
+}
+
+const webhookColumns = `id, url, secret, upload_id, events, active, created_at`
+
+func scanWebhook(row pgx.Row) (*Webhook, error) {
+	w := &Webhook{}
+	if err := row.Scan(&w.ID, &w.URL, &w.Secret, &w.UploadID, &w.Events, &w.Active, &w.CreatedAt); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// CreateWebhook inserts w and fills in its ID and CreatedAt.
+func (d *DB) CreateWebhook(ctx context.Context, w *Webhook) error {
+	w.Active = true
+	return d.Pool.QueryRow(ctx,
+		`INSERT INTO webhooks (url, secret, upload_id, events) VALUES ($1,$2,$3,$4) RETURNING id, created_at`,
+		w.URL, w.Secret, w.UploadID, w.Events,
+	).Scan(&w.ID, &w.CreatedAt)
+}
+
+// GetWebhook returns the subscription or pgx.ErrNoRows.
+func (d *DB) GetWebhook(ctx context.Context, id int64) (*Webhook, error) {
+	return scanWebhook(d.Pool.QueryRow(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE id=$1`, id))
+}
+
+// ListWebhooks returns all subscriptions, or those of one upload when
+// uploadID is set.
+func (d *DB) ListWebhooks(ctx context.Context, uploadID *int64) ([]*Webhook, error) {
+	rows, err := d.Pool.Query(ctx,
+		`SELECT `+webhookColumns+` FROM webhooks
+		 WHERE $1::int IS NULL OR upload_id = $1 ORDER BY id`, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	hooks := []*Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, w)
+	}
+	return hooks, rows.Err()
+}
+
+// DeleteWebhook removes a subscription and its delivery log. It returns
+// false if there was none.
+func (d *DB) DeleteWebhook(ctx context.Context, id int64) (bool, error) {
+	tag, err := d.Pool.Exec(ctx, `DELETE FROM webhooks WHERE id=$1`, id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+const deliveryColumns = `id, webhook_id, job_id, event, payload, status, attempts,
+	CASE WHEN status = 'pending' THEN next_attempt_at END, last_status_code, last_error, delivered_at, created_at`
+
+func scanDelivery(row pgx.Row) (*WebhookDelivery, error) {
+	dl := &WebhookDelivery{}
+	err := row.Scan(&dl.ID, &dl.WebhookID, &dl.JobID, &dl.Event, &dl.Payload, &dl.Status, &dl.Attempts,
+		&dl.NextAttemptAt, &dl.LastStatusCode, &dl.LastError, &dl.DeliveredAt, &dl.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return dl, nil
+}
+
+// ListWebhookDeliveries returns the newest deliveries of a subscription,
+// optionally only those with status.
+func (d *DB) ListWebhookDeliveries(ctx context.Context, webhookID int64, status string, limit int) ([]*WebhookDelivery, error) {
+	rows, err := d.Pool.Query(ctx,
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries
+		 WHERE webhook_id=$1 AND ($2 = '' OR status = $2) ORDER BY id DESC LIMIT $3`,
+		webhookID, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []*WebhookDelivery{}
+	for rows.Next() {
+		dl, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, dl)
+	}
+	return out, rows.Err()
+}
+
+// GetWebhookDelivery returns one delivery of a subscription with its
+// attempts, or pgx.ErrNoRows.
+func (d *DB) GetWebhookDelivery(ctx context.Context, webhookID, id int64) (*WebhookDelivery, []WebhookAttempt, error) {
+	dl, err := scanDelivery(d.Pool.QueryRow(ctx,
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE webhook_id=$1 AND id=$2`, webhookID, id))
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := d.Pool.Query(ctx,
+		`SELECT attempt, status_code, error, duration_ms, attempted_at FROM webhook_delivery_attempts
+		 WHERE delivery_id=$1 ORDER BY attempt`, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	attempts := []WebhookAttempt{}
+	for rows.Next() {
+		var a WebhookAttempt
+		if err := rows.Scan(&a.Attempt, &a.StatusCode, &a.Error, &a.DurationMs, &a.AttemptedAt); err != nil {
+			return nil, nil, err
+		}
+		attempts = append(attempts, a)
+	}
+	return dl, attempts, rows.Err()
+}
+
+// ClaimDueDeliveries picks up to limit pending deliveries whose next attempt
+// is due and pushes that time out by lease, so concurrent dispatchers skip
+// them and a dispatcher that dies mid-attempt only delays them.
+func (d *DB) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]DueDelivery, error) {
+	rows, err := d.Pool.Query(ctx,
+		`WITH due AS (
+		   SELECT id FROM webhook_deliveries
+		   WHERE status = 'pending' AND next_attempt_at <= now()
+		   ORDER BY next_attempt_at, id LIMIT $1 FOR UPDATE SKIP LOCKED
+		 )
+		 UPDATE webhook_deliveries dl SET next_attempt_at = now() + make_interval(secs => $2)
+		 FROM due, webhooks w
+		 WHERE dl.id = due.id AND w.id = dl.webhook_id
+		 RETURNING dl.id, dl.event, dl.payload, dl.attempts, w.url, w.secret`,
+		limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var due []DueDelivery
+	for rows.Next() {
+		var dl DueDelivery
+		if err := rows.Scan(&dl.ID, &dl.Event, &dl.Payload, &dl.Attempts, &dl.URL, &dl.Secret); err != nil {
+			return nil, err
+		}
+		due = append(due, dl)
+	}
+	return due, rows.Err()
+}
+
+// RecordWebhookAttempt logs one attempt of a delivery and moves it on: to
+// delivered when delivered is true, to failed when retryAt is zero, otherwise
+// back to pending until retryAt. statusCode 0 means no response was received.
+func (d *DB) RecordWebhookAttempt(ctx context.Context, id int64, statusCode int, errMsg string, took time.Duration, delivered bool, retryAt time.Time) error {
+	var code *int
+	if statusCode != 0 {
+		code = &statusCode
+	}
+	status := "pending"
+	switch {
+	case delivered:
+		status = "delivered"
+	case retryAt.IsZero():
+		status = "failed"
+	}
+	return d.WithTx(ctx, func(tx pgx.Tx) error {
+		var attempt int
+		err := tx.QueryRow(ctx,
+			`UPDATE webhook_deliveries SET
+			   attempts = attempts + 1, status = $2, last_status_code = $3, last_error = $4,
+			   next_attempt_at = COALESCE($5, next_attempt_at),
+			   delivered_at = CASE WHEN $2 = 'delivered' THEN now() END
+			 WHERE id=$1 RETURNING attempts`,
+			id, status, code, errMsg, nullTime(retryAt)).Scan(&attempt)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx,
+			`INSERT INTO webhook_delivery_attempts (delivery_id, attempt, status_code, error, duration_ms)
+			 VALUES ($1,$2,$3,$4,$5)`,
+			id, attempt, code, errMsg, took.Milliseconds())
+		return err
+	})
+}
+
+// PurgeWebhookDeliveries deletes finished deliveries created more than
+// olderThan ago.
+func (d *DB) PurgeWebhookDeliveries(ctx context.Context, olderThan time.Duration) (int64, error) {
+	tag, err := d.Pool.Exec(ctx,
+		`DELETE FROM webhook_deliveries WHERE status <> 'pending' AND created_at < now() - make_interval(secs => $1)`,
+		olderThan.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -40,11 +40,79 @@ var (
 			Help: "HTTP requests processed",
 		}, []string{"path", "method", "status"},
 	)
+	OutboxPending = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "goaudio_outbox_pending",
+			Help: "Outbox entries not yet published",
+		},
+	)
+	OutboxLag = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "goaudio_outbox_lag_seconds",
+			Help: "Age of the oldest unpublished outbox entry",
+		},
+	)
+	OutboxPublished = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "goaudio_outbox_published_total",
+			Help: "Outbox publish attempts by result",
+		}, []string{"result"},
+	)
+	QueueDepth = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "goaudio_queue_depth",
+			Help: "Queued jobs per priority lane",
+		}, []string{"lane"},
+	)
+	LaneBuffered = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "goaudio_worker_lane_buffered",
+			Help: "Jobs held in this worker's memory per priority lane",
+		}, []string{"lane"},
+	)
+	DeadLetters = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "goaudio_dead_letters_total",
+			Help: "Jobs dead-lettered after exhausting their retries",
+		},
+	)
+	JobsRequeued = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "goaudio_jobs_requeued_total",
+			Help: "Failed jobs put back into the queue through the API",
+		},
+	)
+	LeasesExpired = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "goaudio_job_leases_expired_total",
+			Help: "Running jobs reaped after their worker's lease expired, by new status (queued, failed, cancelled)",
+		}, []string{"status"},
+	)
+	JobsPromoted = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "goaudio_scheduled_jobs_promoted_total",
+			Help: "Delayed jobs moved into the queue once due",
+		},
+	)
+	ScheduleRuns = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "goaudio_schedule_runs_total",
+			Help: "Recurring schedule runs by schedule and result (ok, failed)",
+		}, []string{"schedule", "result"},
+	)
+	WebhookDeliveries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "goaudio_webhook_deliveries_total",
+			Help: "Webhook delivery attempts by result (ok, retry, failed)",
+		}, []string{"result"},
+	)
 )
 
 // Ensure internal/metrics.Register() has sync.Once guard
 func Register() {
 	registerOnce.Do(func() {
-		prometheus.MustRegister(JobsProcessed, JobDuration, JobFailures, CurrentJobs, HTTPRequests)
+		prometheus.MustRegister(JobsProcessed, JobDuration, JobFailures, CurrentJobs, HTTPRequests,
+			OutboxPending, OutboxLag, OutboxPublished, WebhookDeliveries,
+			QueueDepth, LaneBuffered, JobsPromoted, ScheduleRuns, DeadLetters, JobsRequeued, LeasesExpired)
 	})
 }
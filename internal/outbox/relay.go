@@ -0,0 +1,114 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/db"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// Publisher is the part of queue.NatsClient the relay needs.
+type Publisher interface {
+	Publish(ctx context.Context, subject string, data []byte) error
+}
+
+// Relay publishes outbox rows written alongside uploads/jobs and marks them
+// sent. Several relays (one per API replica) can run against the same table.
+// It runs in the API process and logs through its zerolog logger.
+type Relay struct {
+	db        *db.DB
+	pub       Publisher
+	interval  time.Duration
+	batchSize int
+	retention time.Duration
+	wake      chan struct{}
+}
+
+// NewRelay creates a relay polling every interval; Notify triggers an early pass.
+func NewRelay(database *db.DB, pub Publisher, interval time.Duration) *Relay {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &Relay{
+		db:        database,
+		pub:       pub,
+		interval:  interval,
+		batchSize: 100,
+		retention: 24 * time.Hour,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Notify asks the relay to run now instead of waiting for the next tick.
+func (r *Relay) Notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run loops until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	lastPurge := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+
+		r.drain(ctx)
+		r.observe(ctx)
+
+		if time.Since(lastPurge) > time.Hour {
+			if n, err := r.db.PurgeSentOutbox(ctx, r.retention); err != nil {
+				log.Warn().Err(err).Msg("outbox purge failed")
+			} else if n > 0 {
+				log.Info().Int64("rows", n).Msg("outbox purged")
+			}
+			lastPurge = time.Now()
+		}
+	}
+}
+
+// drain publishes full batches until the backlog is empty or publishing fails.
+func (r *Relay) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		var failed bool
+		sent, err := r.db.RelayOutbox(ctx, r.batchSize, func(e db.OutboxEntry) error {
+			pubCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+			if err := r.pub.Publish(pubCtx, e.Subject, e.Payload); err != nil {
+				metrics.OutboxPublished.WithLabelValues("error").Inc()
+				log.Warn().Err(err).Int64("outbox_id", e.ID).Int("attempts", e.Attempts+1).Msg("outbox publish failed")
+				failed = true
+				return err
+			}
+			metrics.OutboxPublished.WithLabelValues("ok").Inc()
+			return nil
+		})
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Error().Err(err).Msg("outbox relay failed")
+			}
+			return
+		}
+		if failed || sent < r.batchSize {
+			return
+		}
+	}
+}
+
+func (r *Relay) observe(ctx context.Context) {
+	pending, oldest, err := r.db.OutboxBacklog(ctx)
+	if err != nil {
+		return
+	}
+	metrics.OutboxPending.Set(float64(pending))
+	metrics.OutboxLag.Set(oldest.Seconds())
+}
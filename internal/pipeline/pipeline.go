@@ -0,0 +1,148 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Step statuses as stored in job_steps.status.
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped"
+)
+
+// Outputs is the free-form result a stage reports (paths, measurements...).
+type Outputs map[string]any
+
+// Stage is one unit of work in a job pipeline.
+type Stage struct {
+	Name      string
+	DependsOn []string
+	// Optional stages may fail without failing the job; stages that depend
+	// on a failed optional stage are skipped.
+	Optional bool
+	Run      func(ctx context.Context) (Outputs, error)
+}
+
+// Recorder persists step state; see processing's job_steps recorder.
+type Recorder interface {
+	Init(ctx context.Context, stages []Stage) error
+	Start(ctx context.Context, stage Stage) error
+	Finish(ctx context.Context, stage Stage, status string, err error, out Outputs) error
+}
+
+// Pipeline is a validated set of stages in dependency order.
+type Pipeline struct {
+	stages []Stage
+}
+
+// New validates names and dependencies and orders stages so every stage runs
+// after its dependencies. Independent stages keep their declaration order.
+func New(stages ...Stage) (*Pipeline, error) {
+	byName := make(map[string]int, len(stages))
+	for i, s := range stages {
+		if s.Name == "" || s.Run == nil {
+			return nil, fmt.Errorf("stage %d: name and Run are required", i)
+		}
+		if _, dup := byName[s.Name]; dup {
+			return nil, fmt.Errorf("duplicate stage %q", s.Name)
+		}
+		byName[s.Name] = i
+	}
+	for _, s := range stages {
+		for _, dep := range s.DependsOn {
+			if _, ok := byName[dep]; !ok {
+				return nil, fmt.Errorf("stage %q depends on unknown stage %q", s.Name, dep)
+			}
+		}
+	}
+
+	// Kahn's algorithm, always picking the earliest-declared ready stage
+	ordered := make([]Stage, 0, len(stages))
+	placed := make(map[string]bool, len(stages))
+	for len(ordered) < len(stages) {
+		progressed := false
+		for _, s := range stages {
+			if placed[s.Name] {
+				continue
+			}
+			ready := true
+			for _, dep := range s.DependsOn {
+				if !placed[dep] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				ordered = append(ordered, s)
+				placed[s.Name] = true
+				progressed = true
+				break
+			}
+		}
+		if !progressed {
+			return nil, errors.New("stage dependencies contain a cycle")
+		}
+	}
+	return &Pipeline{stages: ordered}, nil
+}
+
+// Stages returns the stages in execution order.
+func (p *Pipeline) Stages() []Stage {
+	return p.stages
+}
+
+// Run executes the stages sequentially. A failing critical stage stops the
+// pipeline (remaining stages are recorded as skipped) and its error is
+// returned; a failing optional stage only skips its dependents.
+func (p *Pipeline) Run(ctx context.Context, rec Recorder) error {
+	if err := rec.Init(ctx, p.stages); err != nil {
+		return fmt.Errorf("init steps: %w", err)
+	}
+	state := make(map[string]string, len(p.stages))
+	var fatal error
+	for _, s := range p.stages {
+		if fatal != nil {
+			_ = rec.Finish(ctx, s, StatusSkipped, nil, nil)
+			continue
+		}
+		if blocked := blockedBy(s, state); blocked != "" {
+			state[s.Name] = StatusSkipped
+			_ = rec.Finish(ctx, s, StatusSkipped, fmt.Errorf("dependency %s did not complete", blocked), nil)
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			fatal = err
+			_ = rec.Finish(ctx, s, StatusSkipped, nil, nil)
+			continue
+		}
+
+		_ = rec.Start(ctx, s)
+		out, err := s.Run(ctx)
+		if err != nil {
+			state[s.Name] = StatusFailed
+			_ = rec.Finish(ctx, s, StatusFailed, err, out)
+			if !s.Optional {
+				fatal = fmt.Errorf("%s: %w", s.Name, err)
+			}
+			continue
+		}
+		state[s.Name] = StatusDone
+		_ = rec.Finish(ctx, s, StatusDone, nil, out)
+	}
+	return fatal
+}
+
+// blockedBy returns the first dependency that did not finish successfully.
+func blockedBy(s Stage, state map[string]string) string {
+	for _, dep := range s.DependsOn {
+		if state[dep] != StatusDone {
+			return dep
+		}
+	}
+	return ""
+}
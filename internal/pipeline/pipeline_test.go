@@ -0,0 +1,83 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type memRecorder struct {
+	order  []string
+	status map[string]string
+}
+
+func (m *memRecorder) Init(ctx context.Context, stages []Stage) error {
+	m.status = map[string]string{}
+	for _, s := range stages {
+		m.status[s.Name] = StatusPending
+	}
+	return nil
+}
+
+func (m *memRecorder) Start(ctx context.Context, s Stage) error {
+	m.order = append(m.order, s.Name)
+	return nil
+}
+
+func (m *memRecorder) Finish(ctx context.Context, s Stage, status string, err error, out Outputs) error {
+	m.status[s.Name] = status
+	return nil
+}
+
+func ok(ctx context.Context) (Outputs, error) { return nil, nil }
+
+func TestNew_OrdersByDependencies(t *testing.T) {
+	p, err := New(
+		Stage{Name: "c", DependsOn: []string{"b"}, Run: ok},
+		Stage{Name: "a", Run: ok},
+		Stage{Name: "b", DependsOn: []string{"a"}, Run: ok},
+	)
+	require.NoError(t, err)
+	var names []string
+	for _, s := range p.Stages() {
+		names = append(names, s.Name)
+	}
+	require.Equal(t, []string{"a", "b", "c"}, names)
+
+	_, err = New(Stage{Name: "x", DependsOn: []string{"y"}, Run: ok}, Stage{Name: "y", DependsOn: []string{"x"}, Run: ok})
+	require.ErrorContains(t, err, "cycle")
+	_, err = New(Stage{Name: "x", DependsOn: []string{"missing"}, Run: ok})
+	require.ErrorContains(t, err, "unknown stage")
+}
+
+func TestRun_OptionalFailureSkipsDependentsOnly(t *testing.T) {
+	boom := func(ctx context.Context) (Outputs, error) { return nil, errors.New("boom") }
+	p, err := New(
+		Stage{Name: "probe", Run: ok},
+		Stage{Name: "waveform", DependsOn: []string{"probe"}, Optional: true, Run: boom},
+		Stage{Name: "peaks", DependsOn: []string{"waveform"}, Optional: true, Run: ok},
+		Stage{Name: "loudness", DependsOn: []string{"probe"}, Optional: true, Run: ok},
+	)
+	require.NoError(t, err)
+	rec := &memRecorder{}
+	require.NoError(t, p.Run(context.Background(), rec))
+	require.Equal(t, map[string]string{
+		"probe": StatusDone, "waveform": StatusFailed, "peaks": StatusSkipped, "loudness": StatusDone,
+	}, rec.status)
+}
+
+func TestRun_CriticalFailureStopsPipeline(t *testing.T) {
+	boom := func(ctx context.Context) (Outputs, error) { return nil, errors.New("boom") }
+	p, err := New(
+		Stage{Name: "probe", Run: boom},
+		Stage{Name: "transcode", Run: ok},
+	)
+	require.NoError(t, err)
+	rec := &memRecorder{}
+	err = p.Run(context.Background(), rec)
+	require.ErrorContains(t, err, "probe: boom")
+	require.Equal(t, []string{"probe"}, rec.order)
+	require.Equal(t, StatusSkipped, rec.status["transcode"])
+}
@@ -0,0 +1,239 @@
+package processing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/audio"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/db"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/pipeline"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/queue"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/storage"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/worker"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/pkg/utils"
+)
+
+// Options configures the audio pipeline.
+type Options struct {
+	// PythonCrossCheck also runs tools/analyze.py (librosa) after the native
+	// analyzer and records its answer next to ours; it needs PythonExe with
+	// librosa installed.
+	PythonCrossCheck bool
+	PythonExe        string // python interpreter for tools/analyze.py
+	AnalyzeScript    string
+	TranscodeTimeout time.Duration
+	AnalysisTimeout  time.Duration
+	// PeakZooms are the samples-per-pixel levels of the waveform peaks.
+	PeakZooms []int
+	// StreamingLadder is packaged as HLS/DASH for every upload; empty
+	// disables the package stage.
+	StreamingLadder []audio.Rendition
+	SegmentDuration time.Duration
+}
+
+// OptionsFromEnv reads ANALYZER_PYTHON_CROSSCHECK, ANALYZER_PYTHON,
+// ANALYZER_SCRIPT, TRANSCODE_TIMEOUT, ANALYSIS_TIMEOUT, WAVEFORM_ZOOMS
+// (comma-separated samples per pixel), STREAMING_LADDER (comma-separated
+// renditions, "off" to disable) and STREAMING_SEGMENT. It fails on an
+// invalid STREAMING_LADDER.
+func OptionsFromEnv() (Options, error) {
+	ladder, err := ladderFromEnv()
+	if err != nil {
+		return Options{}, err
+	}
+	return Options{
+		PythonCrossCheck: utils.EnvBool("ANALYZER_PYTHON_CROSSCHECK", false),
+		PythonExe:        utils.EnvString("ANALYZER_PYTHON", "python"),
+		AnalyzeScript:    utils.EnvString("ANALYZER_SCRIPT", "./tools/analyze.py"),
+		TranscodeTimeout: utils.EnvDuration("TRANSCODE_TIMEOUT", 5*time.Minute),
+		AnalysisTimeout:  utils.EnvDuration("ANALYSIS_TIMEOUT", 60*time.Second),
+		PeakZooms:        peakZoomsFromEnv(),
+		StreamingLadder:  ladder,
+		SegmentDuration:  utils.EnvDuration("STREAMING_SEGMENT", 6*time.Second),
+	}, nil
+}
+
+// ladderFromEnv parses STREAMING_LADDER; unset means audio.DefaultLadder.
+func ladderFromEnv() ([]audio.Rendition, error) {
+	spec := utils.EnvString("STREAMING_LADDER", "")
+	if spec == "off" || spec == "none" {
+		return nil, nil
+	}
+	ladder, err := audio.ParseLadder(spec)
+	if err != nil {
+		return nil, fmt.Errorf("STREAMING_LADDER: %w", err)
+	}
+	return ladder, nil
+}
+
+func peakZoomsFromEnv() []int {
+	var zooms []int
+	for _, f := range strings.Split(utils.EnvString("WAVEFORM_ZOOMS", ""), ",") {
+		if z, err := strconv.Atoi(strings.TrimSpace(f)); err == nil && z > 0 {
+			zooms = append(zooms, z)
+		}
+	}
+	if len(zooms) == 0 {
+		return audio.DefaultPeakZooms
+	}
+	return zooms
+}
+
+// NewHandler returns the production job handler. Each job runs the stage
+// pipeline from stages(), recording every stage in job_steps. It returns an
+// error only when a critical stage fails, so the pool can retry; the pool
+// marks the job done or failed.
+func NewHandler(database *db.DB, store storage.Storage, opts Options) worker.Handler {
+	return func(ctx context.Context, jm queue.JobMessage) error {
+		return handleJob(ctx, database, store, opts, jm)
+	}
+}
+
+// NewCancelCleanup returns the pool's cleanup for cancelled jobs: it deletes
+// the artifacts the job staged. When no earlier job of the upload completed,
+// it also deletes anything already promoted and forgets the results recorded
+// for it; a reprocess leaves the previous run's results in place. Promoted
+// files are kept when another upload shares the path (a reused duplicate).
+func NewCancelCleanup(database *db.DB, store storage.Storage) worker.Handler {
+	return func(ctx context.Context, jm queue.JobMessage) error {
+		var relPath string
+		var shared, completed bool
+		if err := database.Pool.QueryRow(ctx,
+			`SELECT path,
+			        EXISTS (SELECT 1 FROM uploads o WHERE o.path = u.path AND o.id <> u.id),
+			        EXISTS (SELECT 1 FROM jobs j WHERE j.upload_id = u.id AND j.id <> $2 AND j.status = 'done')
+			 FROM uploads u WHERE id=$1`, jm.UploadID, jm.JobID).Scan(&relPath, &shared, &completed); err != nil {
+			return fmt.Errorf("upload not found: %w", err)
+		}
+		if err := deleteStaged(store, relPath, jm.JobID); err != nil {
+			return err
+		}
+		if completed {
+			return nil
+		}
+		if !shared {
+			if err := deleteArtifacts(store, storage.ArtifactPath(relPath, "")); err != nil {
+				return err
+			}
+		}
+		return database.ClearUploadResults(ctx, jm.UploadID)
+	}
+}
+
+// jobRun holds the state shared by the stages of one job attempt.
+type jobRun struct {
+	db    *db.DB
+	store storage.Storage
+	opts  Options
+	jm    queue.JobMessage
+
+	relPath   string // original upload, storage-relative
+	inputFull string // local copy of the original
+	workDir   string // scratch dir for outputs before they are saved
+	profiles  []audio.Profile
+	target    *audio.LoudnessTarget // nil: outputs are not normalized
+
+	duration   time.Duration
+	sampleRate int                  // source sample rate
+	measured   *audio.LoudnormStats // first loudnorm pass over the input
+	// primary output (first requested profile); the analysis stages read it
+	outputRel  string
+	outputFull string
+
+	staged  []string                          // artifact names saved under stagingPrefix
+	results []func(ctx context.Context) error // result writes run by promote
+}
+
+func handleJob(ctx context.Context, database *db.DB, store storage.Storage, opts Options, jm queue.JobMessage) error {
+	_ = database.UpdateJobProgress(ctx, jm.JobID, "running", 1, "worker: started")
+
+	run := &jobRun{db: database, store: store, opts: opts, jm: jm}
+	var err error
+
+	// fetch upload path, requested output profiles and loudness target
+	var profiles []string
+	var target string
+	if err := database.Pool.QueryRow(ctx, `SELECT path, profiles, loudness_target FROM uploads WHERE id=$1`, jm.UploadID).
+		Scan(&run.relPath, &profiles, &target); err != nil {
+		return fmt.Errorf("upload not found: %w", err)
+	}
+	run.profiles, err = audio.ParseProfiles(strings.Join(profiles, ","))
+	if err != nil {
+		return err
+	}
+	run.target, err = audio.ParseLoudnessTarget(target)
+	if err != nil {
+		return err
+	}
+
+	// ffmpeg needs a local file; for remote backends this downloads a temp copy
+	inputFull, cleanupInput, err := store.Materialize(run.relPath)
+	if err != nil {
+		return fmt.Errorf("fetch input failed: %w", err)
+	}
+	defer cleanupInput()
+	run.inputFull = inputFull
+
+	// outputs are produced in a scratch dir and then saved through storage
+	run.workDir, err = os.MkdirTemp("", "phantom-job-*")
+	if err != nil {
+		return fmt.Errorf("workdir failed: %w", err)
+	}
+	defer os.RemoveAll(run.workDir)
+
+	p, err := pipeline.New(run.stages()...)
+	if err != nil {
+		return err
+	}
+	if err := p.Run(ctx, &stepRecorder{db: database, jobID: jm.JobID, total: len(p.Stages())}); err != nil {
+		// a retry stages everything again; a cancel cleanup repeats this
+		_ = deleteStaged(store, run.relPath, jm.JobID)
+		return err
+	}
+	// the pool records completion ("done") once we return nil
+	return run.promote(ctx)
+}
+
+// stepRecorder stores stage state in job_steps and mirrors it into the job's
+// progress and log so existing clients keep working.
+type stepRecorder struct {
+	db       *db.DB
+	jobID    int64
+	total    int
+	finished int
+}
+
+func (r *stepRecorder) Init(ctx context.Context, stages []pipeline.Stage) error {
+	steps := make([]db.JobStep, len(stages))
+	for i, s := range stages {
+		steps[i] = db.JobStep{Name: s.Name, Position: i, DependsOn: s.DependsOn, Critical: !s.Optional}
+	}
+	return r.db.InitJobSteps(ctx, r.jobID, steps)
+}
+
+func (r *stepRecorder) Start(ctx context.Context, s pipeline.Stage) error {
+	return r.db.StartJobStep(ctx, r.jobID, s.Name)
+}
+
+func (r *stepRecorder) Finish(ctx context.Context, s pipeline.Stage, status string, err error, out pipeline.Outputs) error {
+	msg := ""
+	if err != nil {
+		msg = err.Error()
+	}
+	if ferr := r.db.FinishJobStep(ctx, r.jobID, s.Name, status, msg, out); ferr != nil {
+		return ferr
+	}
+
+	r.finished++
+	line := fmt.Sprintf("step %s: %s", s.Name, status)
+	if msg != "" {
+		line += ": " + msg
+	}
+	// keep headroom below 100; the pool sets 100 when the job is done
+	progress := 1 + r.finished*94/r.total
+	return r.db.UpdateJobProgress(ctx, r.jobID, "processing", progress, line)
+}
@@ -0,0 +1,368 @@
+package processing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/audio"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/db"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/pipeline"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/storage"
+)
+
+// stages declares the audio pipeline. probe, the loudness measurement pass
+// (when a target is set) and one transcode stage per requested profile are
+// critical; the analysis stages are optional and only need the primary
+// (first) output. The optional package stage encodes its own renditions
+// from the input.
+func (r *jobRun) stages() []pipeline.Stage {
+	stages := []pipeline.Stage{{Name: "probe", Run: r.probe}}
+	transcodeDeps := []string{"probe"}
+	if r.target != nil {
+		stages = append(stages, pipeline.Stage{Name: "normalize", DependsOn: []string{"probe"}, Run: r.measureLoudness})
+		transcodeDeps = []string{"normalize"}
+	}
+	for i, p := range r.profiles {
+		stages = append(stages, pipeline.Stage{
+			Name:      transcodeStage(p),
+			DependsOn: transcodeDeps,
+			Run:       r.transcode(p, i == 0),
+		})
+	}
+	if len(r.opts.StreamingLadder) > 0 {
+		stages = append(stages, pipeline.Stage{Name: "package", DependsOn: transcodeDeps, Optional: true, Run: r.packageStreams})
+	}
+	primary := transcodeStage(r.profiles[0])
+	return append(stages,
+		pipeline.Stage{Name: "loudness", DependsOn: []string{primary}, Optional: true, Run: r.loudness},
+		pipeline.Stage{Name: "analysis", DependsOn: []string{primary}, Optional: true, Run: r.analysis},
+		pipeline.Stage{Name: "waveform", DependsOn: []string{primary}, Optional: true, Run: r.waveform},
+		pipeline.Stage{Name: "peaks", DependsOn: []string{primary}, Optional: true, Run: r.peaks},
+	)
+}
+
+func transcodeStage(p audio.Profile) string {
+	return "transcode:" + p.Name
+}
+
+func (r *jobRun) probe(ctx context.Context) (pipeline.Outputs, error) {
+	info, err := audio.Probe(ctx, r.inputFull)
+	if err != nil {
+		return nil, err
+	}
+	r.duration = info.Duration
+	if st, err := audio.ProbeStream(ctx, r.inputFull); err == nil {
+		r.sampleRate = st.SampleRate
+	}
+	// update duration in uploads table
+	_, _ = r.db.Pool.Exec(ctx, `UPDATE uploads SET duration_seconds=$1 WHERE id=$2`, info.Duration.Seconds(), r.jm.UploadID)
+	return pipeline.Outputs{
+		"duration_seconds": info.Duration.Seconds(),
+		"format":           info.Format,
+		"bit_rate":         info.BitRate,
+	}, nil
+}
+
+// measureLoudness is the first loudnorm pass; the transcode stages use the
+// result for a linear second pass. Silent input is left un-normalized.
+func (r *jobRun) measureLoudness(ctx context.Context) (pipeline.Outputs, error) {
+	trCtx, cancel := context.WithTimeout(ctx, r.opts.TranscodeTimeout)
+	defer cancel()
+	st, err := audio.MeasureLoudnorm(trCtx, r.inputFull, *r.target)
+	if errors.Is(err, audio.ErrSilent) {
+		return pipeline.Outputs{"target": r.target.Name, "normalized": false, "reason": err.Error()}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.measured = st
+	return pipeline.Outputs{
+		"target":       r.target,
+		"input_i":      st.InputI,
+		"input_tp":     st.InputTP,
+		"input_lra":    st.InputLRA,
+		"input_thresh": st.InputThresh,
+	}, nil
+}
+
+// transcode encodes the input with profile p, stages it under the upload's
+// artifacts and records it in outputs on promotion. The primary output also
+// becomes uploads.output_path and the input of the analysis stages.
+func (r *jobRun) transcode(p audio.Profile, primary bool) func(ctx context.Context) (pipeline.Outputs, error) {
+	return func(ctx context.Context) (pipeline.Outputs, error) {
+		outName := p.Name + "." + p.Ext
+		outRel := storage.ArtifactPath(r.relPath, outName)
+		outFull := filepath.Join(r.workDir, outName)
+
+		trCtx, cancel := context.WithTimeout(ctx, r.opts.TranscodeTimeout)
+		defer cancel()
+		var norm *audio.LoudnormStats
+		if r.measured != nil {
+			var err error
+			if norm, err = audio.NormalizeProfile(trCtx, r.inputFull, outFull, p, *r.target, r.measured, r.sampleRate); err != nil {
+				return nil, err
+			}
+		} else if err := audio.TranscodeProfile(trCtx, r.inputFull, outFull, p); err != nil {
+			return nil, err
+		}
+		// record what ffmpeg actually produced rather than what was asked for
+		info, err := audio.ProbeStream(ctx, outFull)
+		if err != nil {
+			return nil, fmt.Errorf("probe output: %w", err)
+		}
+		saved, err := r.saveArtifact(outFull, outName)
+		if err != nil {
+			return nil, fmt.Errorf("save output: %w", err)
+		}
+
+		jobID := r.jm.JobID
+		o := &db.Output{
+			UploadID:  r.jm.UploadID,
+			JobID:     &jobID,
+			Name:      p.Name,
+			Path:      outRel,
+			Codec:     info.Codec,
+			Container: p.Ext,
+			Size:      saved.Size,
+		}
+		if info.BitRate > 0 {
+			o.Bitrate = &info.BitRate
+		}
+		if info.SampleRate > 0 {
+			o.SampleRate = &info.SampleRate
+		}
+		if info.Channels > 0 {
+			o.Channels = &info.Channels
+		}
+		if info.BitDepth > 0 {
+			o.BitDepth = &info.BitDepth
+		}
+		if info.Duration > 0 {
+			o.Duration = &info.Duration
+		}
+		if norm != nil {
+			o.LoudnessTarget = r.target.Name
+			o.LoudnessBefore, _ = json.Marshal(r.measured.Measurement())
+			o.LoudnessAfter, _ = json.Marshal(norm)
+		}
+		r.onPromote(func(ctx context.Context) error {
+			if err := r.db.UpsertOutput(ctx, o); err != nil {
+				return fmt.Errorf("record output: %w", err)
+			}
+			return nil
+		})
+
+		if primary {
+			r.outputRel, r.outputFull = outRel, outFull
+			r.onPromote(func(ctx context.Context) error {
+				_, err := r.db.Pool.Exec(ctx, `UPDATE uploads SET output_path=$1 WHERE id=$2`, outRel, r.jm.UploadID)
+				return err
+			})
+		}
+		out := pipeline.Outputs{
+			"path":        outRel,
+			"size":        saved.Size,
+			"codec":       info.Codec,
+			"bitrate":     info.BitRate,
+			"sample_rate": info.SampleRate,
+		}
+		if norm != nil {
+			out["output_i"] = norm.OutputI
+			out["output_tp"] = norm.OutputTP
+			out["normalization_type"] = norm.NormalizationType
+		}
+		return out, nil
+	}
+}
+
+// loudness meters the primary output with the native BS.1770 meter and
+// stores the summary plus a 1 s short-term curve on the upload.
+func (r *jobRun) loudness(ctx context.Context) (pipeline.Outputs, error) {
+	st, err := audio.MeasureLoudness(ctx, r.outputFull)
+	if err != nil {
+		return nil, err
+	}
+	stored := st.Decimate(time.Second)
+	stored.Momentary = nil
+	curve, err := json.Marshal(stored)
+	if err != nil {
+		return nil, err
+	}
+	_, _ = r.db.Pool.Exec(ctx,
+		`UPDATE uploads SET integrated_lufs=$1, loudness_range=$2, true_peak_dbtp=$3, loudness=$4 WHERE id=$5`,
+		st.Integrated, st.Range, st.TruePeak, curve, r.jm.UploadID)
+	return pipeline.Outputs{
+		"integrated_lufs":     st.Integrated,
+		"loudness_range_lu":   st.Range,
+		"true_peak_dbtp":      st.TruePeak,
+		"max_short_term_lufs": st.MaxShortTerm,
+	}, nil
+}
+
+// analysis estimates tempo and key with the native analyzer. With
+// PythonCrossCheck the librosa script runs too; its answer only lands in the
+// step outputs, and its failure does not fail the stage.
+func (r *jobRun) analysis(ctx context.Context) (pipeline.Outputs, error) {
+	analysisCtx, cancel := context.WithTimeout(ctx, r.opts.AnalysisTimeout)
+	defer cancel()
+	res, err := audio.Analyze(analysisCtx, r.outputFull)
+	if err != nil {
+		return nil, err
+	}
+	_, _ = r.db.Pool.Exec(ctx, `UPDATE uploads SET bpm=$1, musical_key=$2, bpm_confidence=$3, key_confidence=$4 WHERE id=$5`,
+		res.BPM, res.Key, res.BPMConfidence, res.KeyConfidence, r.jm.UploadID)
+	out := pipeline.Outputs{
+		"bpm":            res.BPM,
+		"key":            res.Key,
+		"bpm_confidence": res.BPMConfidence,
+		"key_confidence": res.KeyConfidence,
+	}
+
+	if r.opts.PythonCrossCheck {
+		py, err := audio.AnalyzeWithPython(analysisCtx, r.opts.PythonExe, r.opts.AnalyzeScript, r.outputFull, r.opts.AnalysisTimeout)
+		if err != nil {
+			out["python_error"] = err.Error()
+		} else {
+			out["python_bpm"] = py.BPM
+			out["python_key"] = py.Key
+			// tempo estimators commonly disagree by an octave; count that as agreement
+			out["bpm_agrees"] = sameTempo(res.BPM, py.BPM)
+			out["key_agrees"] = res.Key == py.Key
+		}
+	}
+	return out, nil
+}
+
+// sameTempo reports whether a and b are within 2% of each other, allowing
+// half/double-time answers.
+func sameTempo(a, b float64) bool {
+	if a <= 0 || b <= 0 {
+		return false
+	}
+	for _, f := range []float64{1, 2, 0.5} {
+		if d := a/(b*f) - 1; d < 0.02 && d > -0.02 {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *jobRun) waveform(ctx context.Context) (pipeline.Outputs, error) {
+	wavePath := storage.ArtifactPath(r.relPath, "waveform.png")
+	waveFull := filepath.Join(r.workDir, "wave.png")
+	if err := audio.GenerateWaveform(ctx, r.outputFull, waveFull, 800, 160); err != nil {
+		return nil, err
+	}
+	if _, err := r.saveArtifact(waveFull, "waveform.png"); err != nil {
+		return nil, fmt.Errorf("save waveform: %w", err)
+	}
+	r.onPromote(func(ctx context.Context) error {
+		_, err := r.db.Pool.Exec(ctx, `UPDATE uploads SET waveform_path=$1 WHERE id=$2`, wavePath, r.jm.UploadID)
+		return err
+	})
+	return pipeline.Outputs{"path": wavePath}, nil
+}
+
+// peaks computes min/max waveform data of the primary output at each zoom
+// and stores one 16-bit audiowaveform .dat per level; the API converts to
+// JSON or 8-bit on request.
+func (r *jobRun) peaks(ctx context.Context) (pipeline.Outputs, error) {
+	levels, err := audio.GeneratePeaks(ctx, r.outputFull, r.opts.PeakZooms)
+	if err != nil {
+		return nil, err
+	}
+	paths := make(map[string]string, len(levels))
+	for _, p := range levels {
+		var buf bytes.Buffer
+		if err := p.WriteBinary(&buf); err != nil {
+			return nil, err
+		}
+		name := fmt.Sprintf("peaks-%d.dat", p.SamplesPerPixel)
+		rel := storage.ArtifactPath(r.relPath, name)
+		if _, err := r.stageArtifact(&buf, name); err != nil {
+			return nil, fmt.Errorf("save peaks: %w", err)
+		}
+		wp := &db.WaveformPeaks{
+			UploadID:        r.jm.UploadID,
+			SamplesPerPixel: p.SamplesPerPixel,
+			Channels:        p.Channels,
+			SampleRate:      p.SampleRate,
+			Bits:            p.Bits,
+			Length:          p.Length(),
+			Path:            rel,
+		}
+		r.onPromote(func(ctx context.Context) error {
+			if err := r.db.UpsertWaveformPeaks(ctx, wp); err != nil {
+				return fmt.Errorf("record peaks: %w", err)
+			}
+			return nil
+		})
+		paths[strconv.Itoa(p.SamplesPerPixel)] = rel
+	}
+	return pipeline.Outputs{"levels": paths}, nil
+}
+
+// streamingInfo is stored in uploads.streaming; file names are relative to
+// the upload's "stream/" artifact prefix.
+type streamingInfo struct {
+	HLS             string            `json:"hls"`
+	DASH            string            `json:"dash"`
+	Renditions      []audio.Rendition `json:"renditions"`
+	SegmentDuration float64           `json:"segment_duration"`
+	Files           int               `json:"files"`
+}
+
+// packageStreams encodes the streaming ladder from the input (normalized
+// like the outputs when a loudness target is set), packages it as HLS and
+// DASH and stages every file for "<upload>.artifacts/stream/".
+func (r *jobRun) packageStreams(ctx context.Context) (pipeline.Outputs, error) {
+	dir := filepath.Join(r.workDir, "stream")
+	opts := audio.PackageOptions{SegmentDuration: r.opts.SegmentDuration}
+	if opts.SegmentDuration <= 0 {
+		opts.SegmentDuration = 6 * time.Second
+	}
+	if r.measured != nil {
+		opts.Filter = r.target.LinearFilter(r.measured)
+	}
+	trCtx, cancel := context.WithTimeout(ctx, r.opts.TranscodeTimeout)
+	defer cancel()
+	files, err := audio.PackageStreams(trCtx, r.inputFull, dir, r.opts.StreamingLadder, opts)
+	if err != nil {
+		return nil, err
+	}
+	// segments first, so a manifest never references a missing file
+	sort.Slice(files, func(i, j int) bool { return isManifest(files[j]) && !isManifest(files[i]) })
+	for _, f := range files {
+		if _, err := r.saveArtifact(filepath.Join(dir, f), "stream/"+f); err != nil {
+			return nil, fmt.Errorf("save %s: %w", f, err)
+		}
+	}
+	info := streamingInfo{
+		HLS:             audio.HLSMasterName,
+		DASH:            audio.DASHManifestName,
+		Renditions:      r.opts.StreamingLadder,
+		SegmentDuration: opts.SegmentDuration.Seconds(),
+		Files:           len(files),
+	}
+	raw, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	r.onPromote(func(ctx context.Context) error {
+		_, err := r.db.Pool.Exec(ctx, `UPDATE uploads SET streaming=$1 WHERE id=$2`, raw, r.jm.UploadID)
+		return err
+	})
+	return pipeline.Outputs{"hls": info.HLS, "dash": info.DASH, "files": len(files), "renditions": len(info.Renditions)}, nil
+}
+
+func isManifest(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == ".m3u8" || ext == ".mpd"
+}
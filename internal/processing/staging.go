@@ -0,0 +1,93 @@
+package processing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/storage"
+)
+
+// A job writes its artifacts under a staging prefix of its own and records
+// its outputs, peaks, waveform and streaming package only once every stage
+// has finished. Until then the upload keeps serving what an earlier run
+// produced, and a cancelled or failed reprocess leaves that untouched.
+
+// stagingPrefix is where job jobID stages the artifacts of the upload stored
+// at relPath.
+func stagingPrefix(relPath string, jobID int64) string {
+	return storage.ArtifactPath(relPath, fmt.Sprintf(".staging/%d/", jobID))
+}
+
+// saveArtifact stores a local file as the artifact name (relative to the
+// upload's artifacts), staged until promote.
+func (r *jobRun) saveArtifact(localPath, name string) (*storage.ObjectInfo, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return r.stageArtifact(f, name)
+}
+
+func (r *jobRun) stageArtifact(src io.Reader, name string) (*storage.ObjectInfo, error) {
+	info, err := r.store.Save(src, stagingPrefix(r.relPath, r.jm.JobID)+name)
+	if err != nil {
+		return nil, err
+	}
+	r.staged = append(r.staged, name)
+	return info, nil
+}
+
+// onPromote defers a database write of the job's results to promote.
+func (r *jobRun) onPromote(fn func(ctx context.Context) error) {
+	r.results = append(r.results, fn)
+}
+
+// promote moves the staged artifacts to their final paths, in the order they
+// were saved, then records the results that point at them.
+func (r *jobRun) promote(ctx context.Context) error {
+	prefix := stagingPrefix(r.relPath, r.jm.JobID)
+	for _, name := range r.staged {
+		if err := r.moveArtifact(prefix+name, storage.ArtifactPath(r.relPath, name)); err != nil {
+			return fmt.Errorf("promote %s: %w", name, err)
+		}
+	}
+	for _, fn := range r.results {
+		if err := fn(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *jobRun) moveArtifact(from, to string) error {
+	f, err := r.store.Open(from)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := r.store.Save(f, to); err != nil {
+		return err
+	}
+	return r.store.Delete(from)
+}
+
+// deleteStaged removes whatever job jobID staged for the upload at relPath.
+func deleteStaged(store storage.Storage, relPath string, jobID int64) error {
+	return deleteArtifacts(store, stagingPrefix(relPath, jobID))
+}
+
+func deleteArtifacts(store storage.Storage, prefix string) error {
+	objects, err := store.List(prefix)
+	if err != nil {
+		return fmt.Errorf("list artifacts: %w", err)
+	}
+	for _, o := range objects {
+		if err := store.Delete(o.Path); err != nil {
+			return fmt.Errorf("delete %s: %w", o.Path, err)
+		}
+	}
+	return nil
+}
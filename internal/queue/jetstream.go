@@ -0,0 +1,196 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// JetStreamConfig describes the durable stream and pull consumer used for jobs.
+type JetStreamConfig struct {
+	Stream     string
+	Subjects   []string
+	Durable    string
+	MaxDeliver int
+	// BackOff is the redelivery schedule for messages that are neither acked
+	// nor nak'ed (e.g. the worker died). BackOff[0] doubles as the ack wait.
+	BackOff []time.Duration
+	// Heartbeat is how often an in-flight delivery reports progress so it is
+	// not redelivered while a long transcode is still running.
+	Heartbeat time.Duration
+	MaxAge    time.Duration
+}
+
+// DefaultJetStreamConfig returns the settings used by the API and workers.
+func DefaultJetStreamConfig() JetStreamConfig {
+	return JetStreamConfig{
+		Stream:     "JOBS",
+		Subjects:   append(Subjects(), DeadLetterSubject),
+		Durable:    WorkerQueue,
+		MaxDeliver: 6,
+		BackOff:    []time.Duration{time.Minute, 2 * time.Minute, 5 * time.Minute, 10 * time.Minute},
+		Heartbeat:  15 * time.Second,
+		MaxAge:     7 * 24 * time.Hour,
+	}
+}
+
+// EnableJetStream switches the client to JetStream publishing and makes sure
+// the jobs stream exists with the configured subjects.
+func (n *NatsClient) EnableJetStream(cfg JetStreamConfig) error {
+	js, err := n.conn.JetStream()
+	if err != nil {
+		return fmt.Errorf("jetstream context: %w", err)
+	}
+	want := &nats.StreamConfig{
+		Name:      cfg.Stream,
+		Subjects:  cfg.Subjects,
+		Retention: nats.WorkQueuePolicy,
+		Storage:   nats.FileStorage,
+		MaxAge:    cfg.MaxAge,
+	}
+	info, err := js.StreamInfo(cfg.Stream)
+	switch {
+	case errors.Is(err, nats.ErrStreamNotFound):
+		if _, err := js.AddStream(want); err != nil {
+			return fmt.Errorf("add stream %s: %w", cfg.Stream, err)
+		}
+	case err != nil:
+		return fmt.Errorf("stream info %s: %w", cfg.Stream, err)
+	case !reflect.DeepEqual(info.Config.Subjects, cfg.Subjects) || info.Config.MaxAge != cfg.MaxAge:
+		if _, err := js.UpdateStream(want); err != nil {
+			return fmt.Errorf("update stream %s: %w", cfg.Stream, err)
+		}
+	}
+	n.js = js
+	n.jsCfg = cfg
+	return nil
+}
+
+// JetStreamEnabled reports whether EnableJetStream succeeded on this client.
+func (n *NatsClient) JetStreamEnabled() bool {
+	return n.js != nil
+}
+
+// JobConsumer is a durable pull consumer on the jobs stream.
+type JobConsumer struct {
+	sub       *nats.Subscription
+	heartbeat time.Duration
+}
+
+// PullSubscribe binds (or creates) the durable pull consumer for subject.
+func (n *NatsClient) PullSubscribe(subject, durable string) (*JobConsumer, error) {
+	if n.js == nil {
+		return nil, errors.New("jetstream not enabled")
+	}
+	cfg := n.jsCfg
+	opts := []nats.SubOpt{
+		nats.BindStream(cfg.Stream),
+		nats.AckExplicit(),
+		nats.MaxDeliver(cfg.MaxDeliver),
+	}
+	if len(cfg.BackOff) > 0 {
+		opts = append(opts, nats.BackOff(cfg.BackOff), nats.AckWait(cfg.BackOff[0]))
+	}
+	sub, err := n.js.PullSubscribe(subject, durable, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("pull subscribe %s: %w", subject, err)
+	}
+	return &JobConsumer{sub: sub, heartbeat: cfg.Heartbeat}, nil
+}
+
+// Fetch waits up to maxWait for at most batch messages. It returns an empty
+// slice (and no error) when nothing arrived in time.
+func (c *JobConsumer) Fetch(ctx context.Context, batch int, maxWait time.Duration) ([]*Delivery, error) {
+	fctx, cancel := context.WithTimeout(ctx, maxWait)
+	defer cancel()
+	msgs, err := c.sub.Fetch(batch, nats.Context(fctx))
+	if err != nil && !errors.Is(err, nats.ErrTimeout) && !errors.Is(err, context.DeadlineExceeded) {
+		return nil, err
+	}
+	out := make([]*Delivery, 0, len(msgs))
+	for _, m := range msgs {
+		d := &Delivery{msg: m, heartbeat: c.heartbeat, done: make(chan struct{})}
+		if err := json.Unmarshal(m.Data, &d.Job); err != nil {
+			// poison message: never redeliver it
+			_ = m.Term()
+			continue
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// Unsubscribe stops pulling; the durable consumer itself is kept on the server.
+func (c *JobConsumer) Unsubscribe() error {
+	return c.sub.Unsubscribe()
+}
+
+// Delivery is one JetStream message carrying a job. Exactly one of Ack, Nak
+// or Term should be called once the job is settled.
+type Delivery struct {
+	Job       JobMessage
+	msg       *nats.Msg
+	heartbeat time.Duration
+	once      sync.Once
+	done      chan struct{}
+}
+
+// Attempt is the 1-based delivery count reported by the server.
+func (d *Delivery) Attempt() int {
+	meta, err := d.msg.Metadata()
+	if err != nil {
+		return 1
+	}
+	return int(meta.NumDelivered)
+}
+
+// KeepAlive sends in-progress acks until the delivery is settled, so a job
+// waiting in the pool or running ffmpeg is not redelivered to another worker.
+func (d *Delivery) KeepAlive() {
+	if d.heartbeat <= 0 {
+		return
+	}
+	go func() {
+		t := time.NewTicker(d.heartbeat)
+		defer t.Stop()
+		for {
+			select {
+			case <-d.done:
+				return
+			case <-t.C:
+				_ = d.msg.InProgress()
+			}
+		}
+	}()
+}
+
+// Ack confirms the job was handled and removes it from the work queue.
+func (d *Delivery) Ack() error {
+	d.settle()
+	return d.msg.Ack()
+}
+
+// Nak asks the server to redeliver after delay.
+func (d *Delivery) Nak(delay time.Duration) error {
+	d.settle()
+	if delay > 0 {
+		return d.msg.NakWithDelay(delay)
+	}
+	return d.msg.Nak()
+}
+
+// Term tells the server never to redeliver this message.
+func (d *Delivery) Term() error {
+	d.settle()
+	return d.msg.Term()
+}
+
+func (d *Delivery) settle() {
+	d.once.Do(func() { close(d.done) })
+}
@@ -0,0 +1,68 @@
+package queue
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Job priorities. Each is a lane with its own subject (and JetStream
+// consumer), so a backlog in one lane never delays another lane's messages
+// on the wire; workers decide how to share their capacity between lanes.
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+// Priorities lists the lanes from highest to lowest.
+var Priorities = []string{PriorityHigh, PriorityNormal, PriorityLow}
+
+// ParsePriority validates a priority name; "" means PriorityNormal.
+func ParsePriority(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return PriorityNormal, nil
+	}
+	for _, p := range Priorities {
+		if s == p {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("unknown priority %q (want high, normal or low)", s)
+}
+
+// Lane is the message's priority, PriorityNormal when unset or unknown (as
+// in messages published before priorities existed).
+func (jm JobMessage) Lane() string {
+	if p, err := ParsePriority(jm.Priority); err == nil {
+		return p
+	}
+	return PriorityNormal
+}
+
+// Subject is the subject jobs of priority are published on. The normal lane
+// keeps JobsSubject so messages already queued there are still consumed.
+func Subject(priority string) string {
+	if priority == PriorityNormal || priority == "" {
+		return JobsSubject
+	}
+	return JobsSubject + "." + priority
+}
+
+// Durable is the JetStream consumer name of a lane; the normal lane keeps
+// the original WorkerQueue consumer.
+func Durable(priority string) string {
+	if priority == PriorityNormal || priority == "" {
+		return WorkerQueue
+	}
+	return WorkerQueue + "-" + priority
+}
+
+// Subjects returns the subjects of all lanes.
+func Subjects() []string {
+	out := make([]string, len(Priorities))
+	for i, p := range Priorities {
+		out[i] = Subject(p)
+	}
+	return out
+}
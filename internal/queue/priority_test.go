@@ -0,0 +1,48 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePriority(t *testing.T) {
+	for in, want := range map[string]string{
+		"":         PriorityNormal,
+		"normal":   PriorityNormal,
+		"high":     PriorityHigh,
+		" HIGH ":   PriorityHigh,
+		"Low":      PriorityLow,
+		"\tlow\n":  PriorityLow,
+		"  ":       PriorityNormal,
+		"NORMAL  ": PriorityNormal,
+	} {
+		got, err := ParsePriority(in)
+		require.NoError(t, err, "%q", in)
+		require.Equal(t, want, got, "%q", in)
+	}
+	for _, bad := range []string{"urgent", "hi", "0", "high,low"} {
+		_, err := ParsePriority(bad)
+		require.Error(t, err, bad)
+	}
+}
+
+func TestLaneSubjectsAndDurables(t *testing.T) {
+	cases := []struct{ priority, subject, durable string }{
+		{PriorityHigh, "jobs.high", "audio-workers-high"},
+		// the normal lane keeps the names used before priorities existed
+		{PriorityNormal, "jobs", "audio-workers"},
+		{"", "jobs", "audio-workers"},
+		{PriorityLow, "jobs.low", "audio-workers-low"},
+	}
+	for _, tc := range cases {
+		require.Equal(t, tc.subject, Subject(tc.priority), tc.priority)
+		require.Equal(t, tc.durable, Durable(tc.priority), tc.priority)
+	}
+	require.Equal(t, []string{"jobs.high", "jobs", "jobs.low"}, Subjects())
+	require.NotContains(t, Subjects(), DeadLetterSubject, "no worker consumes dead letters")
+
+	require.Equal(t, PriorityHigh, JobMessage{Priority: "high"}.Lane())
+	require.Equal(t, PriorityNormal, JobMessage{}.Lane(), "messages from before priorities")
+	require.Equal(t, PriorityNormal, JobMessage{Priority: "bogus"}.Lane())
+}
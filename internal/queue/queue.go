@@ -3,20 +3,45 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/nats-io/nats.go"
 )
 
+const (
+	// JobsSubject is the subject normal-priority job messages are published
+	// on; see Subject for the other lanes.
+	JobsSubject = "jobs"
+	// WorkerQueue is the queue group / durable name shared by all workers.
+	WorkerQueue = "audio-workers"
+	// CancelSubject carries CancelMessages to every worker. It is outside
+	// the jobs stream: a cancel is only useful to the worker running the job
+	// right now.
+	CancelSubject = "control.jobs.cancel"
+	// DeadLetterSubject carries the db.DeadLetter of every job that failed
+	// for good. In JetStream mode it is part of the jobs stream, where no
+	// worker consumes it, so the letters are kept for the stream's MaxAge.
+	DeadLetterSubject = "jobs.dead"
+)
+
 type NatsClient struct {
-	conn *nats.Conn
+	conn  *nats.Conn
+	js    nats.JetStreamContext
+	jsCfg JetStreamConfig
 }
 
 type JobMessage struct {
 	JobID    int64  `json:"job_id"`
 	UploadID int64  `json:"upload_id"`
 	Type     string `json:"type"`
-	// optional: add more metadata later
+	// Priority picks the lane (see Lane); empty is PriorityNormal.
+	Priority string `json:"priority,omitempty"`
+}
+
+// CancelMessage asks the worker running JobID to stop it.
+type CancelMessage struct {
+	JobID int64 `json:"job_id"`
 }
 
 func NewNatsClient(url string) (*NatsClient, error) {
@@ -39,13 +64,45 @@ func (n *NatsClient) Close() {
 	}
 }
 
+// PublishJob publishes jm on subject. In JetStream mode it waits for the
+// stream's ack, so a nil error means the job is durably stored.
 func (n *NatsClient) PublishJob(ctx context.Context, subject string, jm JobMessage) error {
 	b, err := json.Marshal(jm)
 	if err != nil {
 		return err
 	}
-	// use simple Publish; we don't wait for ack (NATS core). For JetStream replace with PublishMsg/JetStream.
-	return n.conn.Publish(subject, b)
+	return n.Publish(ctx, subject, b)
+}
+
+// Publish sends an already encoded payload, with the same delivery semantics as PublishJob.
+func (n *NatsClient) Publish(ctx context.Context, subject string, data []byte) error {
+	if n.js != nil {
+		if _, err := n.js.Publish(subject, data, nats.Context(ctx)); err != nil {
+			return fmt.Errorf("jetstream publish: %w", err)
+		}
+		return nil
+	}
+	// core NATS: fire and forget, lost if no subscriber is connected
+	return n.conn.Publish(subject, data)
+}
+
+// Broadcast publishes on core NATS even in JetStream mode, so every current
+// subscriber receives it and nothing is stored.
+func (n *NatsClient) Broadcast(subject string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := n.conn.Publish(subject, b); err != nil {
+		return err
+	}
+	return n.conn.Flush()
+}
+
+// Subscribe delivers every message on subject to cb, unlike QueueSubscribe
+// which load-balances within a group.
+func (n *NatsClient) Subscribe(subject string, cb func(msg *nats.Msg)) (*nats.Subscription, error) {
+	return n.conn.Subscribe(subject, cb)
 }
 
 // Subscribe with a queue group; callback handles message
@@ -0,0 +1,159 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/db"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/metrics"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/queue"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// promoteLock is the advisory lock held while promoting due jobs, so only one
+// replica publishes a given batch.
+const promoteLock = "goaudio.scheduler.promote"
+
+// Notifier is told when promoted jobs were written to the outbox (the
+// outbox relay).
+type Notifier interface {
+	Notify()
+}
+
+// Schedule is a recurring maintenance task. Every is its default interval;
+// the job_schedules row created for it can change that or disable it.
+type Schedule struct {
+	Name  string
+	Every time.Duration
+	Run   func(ctx context.Context) error
+}
+
+// Config tunes the scheduler; zero fields take the defaults below.
+type Config struct {
+	Interval  time.Duration // how often due jobs and schedules are checked (1s)
+	BatchSize int           // jobs promoted per transaction (100)
+}
+
+func (c Config) withDefaults() Config {
+	if c.Interval <= 0 {
+		c.Interval = time.Second
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 100
+	}
+	return c
+}
+
+// Scheduler promotes delayed jobs into the queue once their run_at passes and
+// runs the recurring schedules. Every API replica runs one: promotion happens
+// under a Postgres advisory lock and each schedule run is claimed in its row,
+// so nothing is published or run twice. Being part of the API, it logs with
+// zerolog.
+type Scheduler struct {
+	db        *db.DB
+	notify    Notifier
+	cfg       Config
+	schedules []Schedule
+}
+
+// New creates a scheduler; notify may be nil.
+func New(database *db.DB, notify Notifier, cfg Config, schedules ...Schedule) *Scheduler {
+	return &Scheduler{db: database, notify: notify, cfg: cfg.withDefaults(), schedules: schedules}
+}
+
+// Run loops until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	for _, sc := range s.schedules {
+		if err := s.db.EnsureJobSchedule(ctx, sc.Name, sc.Every); err != nil {
+			log.Warn().Err(err).Str("schedule", sc.Name).Msg("register schedule failed")
+		}
+	}
+	t := time.NewTicker(s.cfg.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		for {
+			n, err := s.promote(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Warn().Err(err).Msg("promote scheduled jobs failed")
+				}
+				break
+			}
+			if n < s.cfg.BatchSize {
+				break
+			}
+		}
+		s.runDue(ctx)
+	}
+}
+
+// promote publishes one batch of due jobs through the outbox and returns how
+// many it moved; 0 when another replica holds the lock.
+func (s *Scheduler) promote(ctx context.Context) (int, error) {
+	var jobs []db.JobRef
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		ok, err := db.TryAdvisoryXactLock(ctx, tx, promoteLock)
+		if err != nil || !ok {
+			return err
+		}
+		if jobs, err = db.PromoteDueJobs(ctx, tx, s.cfg.BatchSize); err != nil {
+			return err
+		}
+		for _, j := range jobs {
+			if err := db.InsertOutbox(ctx, tx, queue.Subject(j.Priority), queue.JobMessage{
+				JobID:    j.ID,
+				UploadID: j.UploadID,
+				Type:     j.Type,
+				Priority: j.Priority,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(jobs) > 0 {
+		metrics.JobsPromoted.Add(float64(len(jobs)))
+		log.Info().Int("count", len(jobs)).Msg("promoted scheduled jobs")
+		if s.notify != nil {
+			s.notify.Notify()
+		}
+	}
+	return len(jobs), nil
+}
+
+// runDue runs, one after another, the schedules this replica claimed.
+func (s *Scheduler) runDue(ctx context.Context) {
+	for _, sc := range s.schedules {
+		ok, err := s.db.ClaimJobSchedule(ctx, sc.Name)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Warn().Err(err).Str("schedule", sc.Name).Msg("claim schedule failed")
+			}
+			return
+		}
+		if !ok {
+			continue
+		}
+		start := time.Now()
+		err = sc.Run(ctx)
+		took := time.Since(start)
+		errMsg, result := "", "ok"
+		if err != nil {
+			errMsg, result = err.Error(), "failed"
+			log.Warn().Err(err).Str("schedule", sc.Name).Msg("schedule failed")
+		}
+		metrics.ScheduleRuns.WithLabelValues(sc.Name, result).Inc()
+		if err := s.db.RecordJobScheduleRun(ctx, sc.Name, took, errMsg); err != nil {
+			log.Warn().Err(err).Str("schedule", sc.Name).Msg("record schedule run failed")
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/db"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/logging"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedulerSurvivesDatabaseErrorsWithoutZapLogger(t *testing.T) {
+	logging.Logger = nil
+	pool, err := pgxpool.New(context.Background(), "postgres://u:p@127.0.0.1:1/none?connect_timeout=1")
+	require.NoError(t, err)
+	defer pool.Close()
+
+	ran := false
+	s := New(&db.DB{Pool: pool}, nil, Config{Interval: 10 * time.Millisecond},
+		Schedule{Name: "tick", Every: time.Hour, Run: func(context.Context) error {
+			ran = true
+			return nil
+		}})
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	s.Run(ctx)
+	require.False(t, ran, "a schedule that could not be claimed never runs")
+}
@@ -11,8 +11,11 @@ import (
 	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/db"
 	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/logging"
 	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/metrics"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/outbox"
 	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/queue"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/scheduler"
 	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/storage"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/webhook"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -26,8 +29,14 @@ type APIServerConfig struct {
 	Addr        string // e.g. "127.0.0.1:8085"
 	DatabaseDSN string // postgres DSN, will be set into env for db.New
 	StorageBase string // local path for storage
-	NatsURL     string // optional nats url
-	DevLogging  bool   // true -> dev logger
+	// Storage overrides StorageBase when its Backend is set (e.g. "s3").
+	Storage    storage.Config
+	NatsURL    string // optional nats url
+	DevLogging bool   // true -> dev logger
+	JetStream  bool   // publish jobs to the durable JOBS stream
+
+	// Share enables signed download URLs when its Keys are set.
+	Share api.ShareConfig
 }
 
 // RunAPIServer starts the API server in-process. Caller must cancel ctx or call srv.Shutdown.
@@ -56,14 +65,14 @@ func RunAPIServer(ctx context.Context, cfg APIServerConfig) (*http.Server, error
 	}
 	// do NOT close dbConn here; will be closed on context cancel after shutdown below
 
-	// init storage (local dev)
-	base := cfg.StorageBase
-	if base == "" {
-		base = "./data"
+	// init storage (local dev unless a backend is configured)
+	storeCfg := cfg.Storage
+	if storeCfg.Backend == "" {
+		storeCfg = storage.Config{Backend: "local", LocalPath: cfg.StorageBase}
 	}
-	lf := storage.NewLocalFS(base)
-	if err := lf.EnsureBasePath(base); err != nil {
-		logging.Logger.Error("EnsureBasePath failed", zap.Error(err))
+	store, err := storage.New(storeCfg)
+	if err != nil {
+		logging.Logger.Error("storage init failed", zap.Error(err))
 		dbConn.Close()
 		return nil, err
 	}
@@ -77,20 +86,58 @@ func RunAPIServer(ctx context.Context, cfg APIServerConfig) (*http.Server, error
 			dbConn.Close()
 			return nil, err
 		}
+		if cfg.JetStream {
+			if err := nc.EnableJetStream(queue.DefaultJetStreamConfig()); err != nil {
+				logging.Logger.Error("EnableJetStream failed", zap.Error(err))
+				nc.Close()
+				dbConn.Close()
+				return nil, err
+			}
+		}
 		nClient = nc
 	}
 
 	// build API service and router
 	apiSvc := &api.API{
 		DB:      dbConn,
-		Storage: lf,
+		Storage: store,
 		Queue:   nClient,
+		Share:   cfg.Share,
+		Events:  api.NewEventHub(dbConn),
+	}
+	go apiSvc.Events.Run(ctx)
+	var relayDone chan struct{}
+	if nClient != nil {
+		// relay publishes jobs committed to the outbox table
+		relay := outbox.NewRelay(dbConn, nClient, 200*time.Millisecond)
+		apiSvc.Outbox = relay
+		relayDone = make(chan struct{})
+		go func() {
+			defer close(relayDone)
+			relay.Run(ctx)
+		}()
 	}
 
+	// short retries so tests can observe redeliveries
+	go webhook.NewDispatcher(dbConn, webhook.Config{
+		Interval:  200 * time.Millisecond,
+		BaseDelay: time.Second,
+		MaxDelay:  5 * time.Second,
+	}).Run(ctx)
+	// promotes delayed jobs; without NATS they stay queued in the outbox
+	var notify scheduler.Notifier
+	if apiSvc.Outbox != nil {
+		notify = apiSvc.Outbox
+	}
+	go scheduler.New(dbConn, notify, scheduler.Config{Interval: 200 * time.Millisecond},
+		apiSvc.MaintenanceSchedules()...).Run(ctx)
+
 	r := chi.NewRouter()
 	r.Get("/health", healthHandler) // if you exported them; otherwise use inline handlers
 	r.Get("/ready", readyHandler)
 	r.Post("/upload", apiSvc.UploadHandler)
+	apiSvc.RegisterTusRoutes(r)
+	apiSvc.RegisterShareRoutes(r)
 	apiSvc.RegisterJobRoutes(r)
 
 	// metrics endpoint
@@ -111,6 +158,9 @@ func RunAPIServer(ctx context.Context, cfg APIServerConfig) (*http.Server, error
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 		_ = srv.Shutdown(shutdownCtx)
+		if relayDone != nil {
+			<-relayDone
+		}
 		dbConn.Close()
 		if nClient != nil {
 			nClient.Close()
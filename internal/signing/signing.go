@@ -0,0 +1,152 @@
+// Package signing mints and verifies HMAC-SHA256 signed, expiring URLs.
+//
+// A signed URL carries its expiry, the id of the key that signed it, an
+// optional single-use nonce and the signature as query parameters. The
+// signature covers the URL path and those parameters, so none of them can
+// be changed. Keys are rotated by adding a new key in front: it signs new
+// URLs while the old ones keep verifying until they are removed.
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query parameters of a signed URL.
+const (
+	ParamExpires = "expires" // unix seconds
+	ParamKeyID   = "kid"
+	ParamNonce   = "nonce" // present on single-use URLs
+	ParamSig     = "sig"
+)
+
+var (
+	ErrMissing    = errors.New("signing: url is not signed")
+	ErrUnknownKey = errors.New("signing: unknown key id")
+	ErrSignature  = errors.New("signing: signature mismatch")
+	ErrExpired    = errors.New("signing: url expired")
+)
+
+// minSecretLen rejects secrets too short to be worth an HMAC.
+const minSecretLen = 16
+
+// Keyring holds the signing keys; the first key signs, all keys verify.
+type Keyring struct {
+	active string
+	keys   map[string][]byte
+}
+
+// ParseKeys reads a comma separated list of kid:secret pairs, e.g.
+// "2025-06:s3cr3t...,2025-01:old...". The first pair is the active key.
+func ParseKeys(spec string) (*Keyring, error) {
+	k := &Keyring{keys: map[string][]byte{}}
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kid, secret, ok := strings.Cut(pair, ":")
+		if !ok || kid == "" {
+			return nil, fmt.Errorf("signing key %q: want kid:secret", pair)
+		}
+		if len(secret) < minSecretLen {
+			return nil, fmt.Errorf("signing key %q: secret shorter than %d bytes", kid, minSecretLen)
+		}
+		if _, dup := k.keys[kid]; dup {
+			return nil, fmt.Errorf("signing key %q listed twice", kid)
+		}
+		k.keys[kid] = []byte(secret)
+		if k.active == "" {
+			k.active = kid
+		}
+	}
+	if k.active == "" {
+		return nil, errors.New("no signing keys")
+	}
+	return k, nil
+}
+
+// ActiveKeyID is the id of the key new URLs are signed with.
+func (k *Keyring) ActiveKeyID() string { return k.active }
+
+// Sign adds expiry, key id, nonce (if not empty) and signature to u's query.
+func (k *Keyring) Sign(u *url.URL, expires time.Time, nonce string) {
+	q := u.Query()
+	q.Set(ParamExpires, strconv.FormatInt(expires.Unix(), 10))
+	q.Set(ParamKeyID, k.active)
+	q.Del(ParamNonce)
+	if nonce != "" {
+		q.Set(ParamNonce, nonce)
+	}
+	q.Set(ParamSig, k.mac(k.keys[k.active], u.Path, q))
+	u.RawQuery = q.Encode()
+}
+
+// Verified is what a valid signed URL asserted.
+type Verified struct {
+	Expires time.Time
+	KeyID   string
+	Nonce   string // "" unless single-use
+}
+
+// Verify checks u's signature and expiry at now.
+func (k *Keyring) Verify(u *url.URL, now time.Time) (*Verified, error) {
+	q := u.Query()
+	sig, kid, exp := q.Get(ParamSig), q.Get(ParamKeyID), q.Get(ParamExpires)
+	if sig == "" || kid == "" || exp == "" {
+		return nil, ErrMissing
+	}
+	secret, ok := k.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	want := k.mac(secret, u.Path, q)
+	if !hmac.Equal([]byte(sig), []byte(want)) {
+		return nil, ErrSignature
+	}
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return nil, ErrSignature
+	}
+	v := &Verified{Expires: time.Unix(unix, 0), KeyID: kid, Nonce: q.Get(ParamNonce)}
+	if !now.Before(v.Expires) {
+		return v, ErrExpired
+	}
+	return v, nil
+}
+
+// mac signs the path and every query parameter except the signature, in
+// url.Values' sorted encoding. The path is taken as absolute: URLs built
+// with JoinPath on a bare host have none of their own.
+func (k *Keyring) mac(secret []byte, path string, q url.Values) string {
+	path = "/" + strings.TrimPrefix(path, "/")
+	signed := url.Values{}
+	for name, vals := range q {
+		if name != ParamSig {
+			signed[name] = vals
+		}
+	}
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(path))
+	h.Write([]byte{'\n'})
+	h.Write([]byte(signed.Encode()))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// NewNonce returns a random single-use token.
+func NewNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,64 @@
+package signing
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignVerify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	old, err := ParseKeys("k1:0123456789abcdef0123")
+	require.NoError(t, err)
+	rotated, err := ParseKeys("k2:fedcba9876543210fedc, k1:0123456789abcdef0123")
+	require.NoError(t, err)
+	require.Equal(t, "k2", rotated.ActiveKeyID())
+
+	u, _ := url.Parse("https://cdn.example.com/shared/uploads/7/outputs/mp3-320")
+	old.Sign(u, now.Add(time.Hour), "abc")
+
+	// still valid after rotation
+	v, err := rotated.Verify(u, now)
+	require.NoError(t, err)
+	require.Equal(t, "k1", v.KeyID)
+	require.Equal(t, "abc", v.Nonce)
+
+	_, err = rotated.Verify(u, now.Add(2*time.Hour))
+	require.ErrorIs(t, err, ErrExpired)
+
+	for name, tamper := range map[string]func(*url.URL){
+		"path":    func(u *url.URL) { u.Path = "/shared/uploads/8/outputs/mp3-320" },
+		"expires": func(u *url.URL) { setParam(u, ParamExpires, "9999999999") },
+		"nonce":   func(u *url.URL) { setParam(u, ParamNonce, "") },
+		"extra":   func(u *url.URL) { setParam(u, "download", "1") },
+	} {
+		c := *u
+		tamper(&c)
+		_, err := rotated.Verify(&c, now)
+		require.ErrorIs(t, err, ErrSignature, name)
+	}
+
+	c := *u
+	setParam(&c, ParamKeyID, "k3")
+	_, err = rotated.Verify(&c, now)
+	require.ErrorIs(t, err, ErrUnknownKey)
+
+	// a path joined onto a bare host is relative until the URL is reparsed
+	j, _ := url.Parse("http://h")
+	j = j.JoinPath("shared", "uploads", "1", "original")
+	rotated.Sign(j, now.Add(time.Minute), "")
+	reparsed, _ := url.Parse(j.String())
+	_, err = rotated.Verify(reparsed, now)
+	require.NoError(t, err)
+
+	_, err = ParseKeys("k1:short")
+	require.Error(t, err)
+}
+
+func setParam(u *url.URL, k, v string) {
+	q := u.Query()
+	q.Set(k, v)
+	u.RawQuery = q.Encode()
+}
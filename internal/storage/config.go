@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/pkg/utils"
+)
+
+// Config selects and configures a Storage backend.
+type Config struct {
+	Backend   string // "local" (default) or "s3"
+	LocalPath string
+	S3        S3Config
+}
+
+// ConfigFromEnv reads STORAGE_BACKEND, STORAGE_PATH and the S3_* variables.
+func ConfigFromEnv() Config {
+	return Config{
+		Backend:   utils.EnvString("STORAGE_BACKEND", "local"),
+		LocalPath: utils.EnvString("STORAGE_PATH", "./data"),
+		S3: S3Config{
+			Endpoint:     utils.EnvString("S3_ENDPOINT", ""),
+			Region:       utils.EnvString("S3_REGION", "us-east-1"),
+			Bucket:       utils.EnvString("S3_BUCKET", ""),
+			Prefix:       utils.EnvString("S3_PREFIX", ""),
+			AccessKey:    utils.EnvString("S3_ACCESS_KEY", ""),
+			SecretKey:    utils.EnvString("S3_SECRET_KEY", ""),
+			UseSSL:       utils.EnvBool("S3_USE_SSL", true),
+			PartSize:     uint64(utils.EnvInt("S3_PART_SIZE_MB", 16)) << 20,
+			CreateBucket: utils.EnvBool("S3_CREATE_BUCKET", false),
+		},
+	}
+}
+
+// New builds the configured backend and makes sure its base location exists.
+func New(cfg Config) (Storage, error) {
+	switch cfg.Backend {
+	case "", "local":
+		base := cfg.LocalPath
+		if base == "" {
+			base = "./data"
+		}
+		lf := NewLocalFS(base)
+		if err := lf.EnsureBasePath(base); err != nil {
+			return nil, err
+		}
+		return lf, nil
+	case "s3":
+		s, err := NewS3(cfg.S3)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.EnsureBasePath(""); err != nil {
+			return nil, err
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+// audioTypes pins the media types we serve; the system mime table varies by
+// OS and often lacks audio formats.
+var audioTypes = map[string]string{
+	".mp3":  "audio/mpeg",
+	".wav":  "audio/wav",
+	".flac": "audio/flac",
+	".ogg":  "audio/ogg",
+	".opus": "audio/ogg",
+	".m4a":  "audio/mp4",
+	".aac":  "audio/aac",
+	".aif":  "audio/aiff",
+	".aiff": "audio/aiff",
+	".png":  "image/png",
+	".json": "application/json",
+	// adaptive streaming packages
+	".m3u8": "application/vnd.apple.mpegurl",
+	".mpd":  "application/dash+xml",
+	".m4s":  "audio/mp4",
+}
+
+// ContentType guesses the media type of a stored object from its extension.
+func ContentType(p string) string {
+	ext := strings.ToLower(filepath.Ext(p))
+	if ct, ok := audioTypes[ext]; ok {
+		return ct
+	}
+	if ct := mime.TypeByExtension(ext); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
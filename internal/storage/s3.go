@@ -0,0 +1,243 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Config configures an S3-compatible backend (AWS S3, MinIO, R2, ...).
+type S3Config struct {
+	Endpoint     string // host[:port], no scheme
+	Region       string
+	Bucket       string
+	Prefix       string // optional key prefix, e.g. "audio/"
+	AccessKey    string
+	SecretKey    string
+	UseSSL       bool
+	PartSize     uint64 // multipart part size in bytes; 0 = 16 MiB
+	CreateBucket bool   // create the bucket in EnsureBasePath if missing
+}
+
+const defaultPartSize = 16 << 20
+
+// S3 implements Storage on an S3-compatible object store. Objects larger than
+// PartSize are sent as multipart uploads and every part carries a SHA-256
+// checksum that the server verifies.
+type S3 struct {
+	client   *minio.Client
+	bucket   string
+	prefix   string
+	region   string
+	partSize uint64
+	create   bool
+	timeout  time.Duration
+}
+
+func NewS3(cfg S3Config) (*S3, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("s3 storage: endpoint and bucket are required")
+	}
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+		// needed for per-part server-side checksums on streamed uploads
+		TrailingHeaders: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("s3 client: %w", err)
+	}
+	partSize := cfg.PartSize
+	if partSize == 0 {
+		partSize = defaultPartSize
+	}
+	return &S3{
+		client:   client,
+		bucket:   cfg.Bucket,
+		prefix:   strings.Trim(cfg.Prefix, "/"),
+		region:   cfg.Region,
+		partSize: partSize,
+		create:   cfg.CreateBucket,
+		timeout:  30 * time.Minute,
+	}, nil
+}
+
+// EnsureBasePath checks the bucket exists (creating it when configured to).
+// The base argument is ignored: the bucket and prefix are the base.
+func (s *S3) EnsureBasePath(base string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ok, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return fmt.Errorf("s3 bucket check: %w", err)
+	}
+	if ok {
+		return nil
+	}
+	if !s.create {
+		return fmt.Errorf("s3 bucket %q does not exist", s.bucket)
+	}
+	if err := s.client.MakeBucket(ctx, s.bucket, minio.MakeBucketOptions{Region: s.region}); err != nil {
+		return fmt.Errorf("s3 make bucket: %w", err)
+	}
+	return nil
+}
+
+func (s *S3) Save(r io.Reader, destPath string) (*ObjectInfo, error) {
+	key, err := s.key(destPath)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	// the per-part checksums minio sends are not a digest of the whole object
+	h := sha256.New()
+	info, err := s.client.PutObject(ctx, s.bucket, key, io.TeeReader(r, h), -1, minio.PutObjectOptions{
+		ContentType: ContentType(destPath),
+		PartSize:    s.partSize,
+		Checksum:    minio.ChecksumSHA256,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("s3 put %s: %w", destPath, err)
+	}
+	modTime := info.LastModified
+	if modTime.IsZero() {
+		modTime = time.Now()
+	}
+	return &ObjectInfo{
+		Path:    destPath,
+		Size:    info.Size,
+		ModTime: modTime,
+		ETag:    info.ETag,
+		SHA256:  hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+// Open returns a seekable reader over the object; it is fetched lazily with
+// ranged GETs, so seeking does not download the whole file.
+func (s *S3) Open(p string) (io.ReadSeekCloser, error) {
+	key, err := s.key(p)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := s.client.GetObject(context.Background(), s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s.wrapErr(p, err)
+	}
+	// GetObject is lazy; Stat surfaces a missing key now rather than on first Read
+	if _, err := obj.Stat(); err != nil {
+		_ = obj.Close()
+		return nil, s.wrapErr(p, err)
+	}
+	return obj, nil
+}
+
+func (s *S3) Stat(p string) (*ObjectInfo, error) {
+	key, err := s.key(p)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	st, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, s.wrapErr(p, err)
+	}
+	return &ObjectInfo{Path: s.rel(st.Key), Size: st.Size, ModTime: st.LastModified, ETag: st.ETag}, nil
+}
+
+func (s *S3) Delete(p string) error {
+	key, err := s.key(p)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	// S3 DELETE is idempotent: a missing key is not an error
+	if err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("s3 delete %s: %w", p, err)
+	}
+	return nil
+}
+
+func (s *S3) List(prefix string) ([]ObjectInfo, error) {
+	key, err := s.key(prefix)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	var out []ObjectInfo
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: key, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("s3 list %s: %w", prefix, obj.Err)
+		}
+		out = append(out, ObjectInfo{Path: s.rel(obj.Key), Size: obj.Size, ModTime: obj.LastModified, ETag: obj.ETag})
+	}
+	// keys come back in lexical order already
+	return out, nil
+}
+
+// Materialize downloads the object to a temp file that keeps its extension,
+// since ffmpeg uses it as a format hint.
+func (s *S3) Materialize(p string) (string, func(), error) {
+	key, err := s.key(p)
+	if err != nil {
+		return "", nil, err
+	}
+	f, err := os.CreateTemp("", "phantom-*"+path.Ext(p))
+	if err != nil {
+		return "", nil, err
+	}
+	local := f.Name()
+	_ = f.Close()
+	cleanup := func() { _ = os.Remove(local) }
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	if err := s.client.FGetObject(ctx, s.bucket, key, local, minio.GetObjectOptions{}); err != nil {
+		cleanup()
+		return "", nil, s.wrapErr(p, err)
+	}
+	return local, cleanup, nil
+}
+
+func (s *S3) wrapErr(p string, err error) error {
+	if resp := minio.ToErrorResponse(err); resp.Code == "NoSuchKey" || resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrNotFound, p)
+	}
+	return fmt.Errorf("s3 %s: %w", p, err)
+}
+
+// rel strips the configured prefix from an object key.
+func (s *S3) rel(key string) string {
+	if s.prefix == "" {
+		return key
+	}
+	return strings.TrimPrefix(key, s.prefix+"/")
+}
+
+// key maps a storage-relative path (possibly with OS separators) to an
+// object key under the prefix. Paths checkPath rejects could name keys
+// outside the prefix, so they are refused rather than cleaned.
+func (s *S3) key(p string) (string, error) {
+	p, err := checkPath(p)
+	if err != nil {
+		return "", err
+	}
+	if s.prefix == "" {
+		return p, nil
+	}
+	return s.prefix + "/" + p, nil
+}
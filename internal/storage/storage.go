@@ -1,16 +1,66 @@
 package storage
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 )
 
-// Storage defines operations we need
+// ErrNotFound is returned (wrapped) when an object does not exist.
+var ErrNotFound = errors.New("storage: object not found")
+
+// ErrInvalidPath is returned (wrapped) for a path that could name something
+// outside the backend's base: an absolute one or one with ".." segments.
+var ErrInvalidPath = errors.New("storage: invalid path")
+
+// checkPath validates a storage-relative path and returns it with forward
+// slashes.
+func checkPath(p string) (string, error) {
+	p = filepath.ToSlash(p)
+	if strings.HasPrefix(p, "/") || filepath.IsAbs(p) || filepath.VolumeName(p) != "" {
+		return "", fmt.Errorf("%w: %s is absolute", ErrInvalidPath, p)
+	}
+	for _, seg := range strings.Split(p, "/") {
+		if seg == ".." {
+			return "", fmt.Errorf("%w: %s leaves the base", ErrInvalidPath, p)
+		}
+	}
+	return p, nil
+}
+
+// ObjectInfo describes a stored object. Path is storage-relative with forward slashes.
+type ObjectInfo struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	ETag    string
+	// SHA256 is the hex digest of the content; only Save fills it in.
+	SHA256 string
+}
+
+// Storage defines operations we need. Paths are relative to the backend's
+// base (directory or bucket+prefix) and use forward slashes.
 type Storage interface {
-	Save(r io.Reader, destPath string) (int64, error)
+	// Save streams r to destPath, hashing it on the way; the returned info
+	// carries the size and SHA256 of what was written.
+	Save(r io.Reader, destPath string) (*ObjectInfo, error)
+	Open(path string) (io.ReadSeekCloser, error)
+	Stat(path string) (*ObjectInfo, error)
+	// Delete removes an object; deleting a missing object is not an error.
+	Delete(path string) error
+	// List returns all objects whose path starts with prefix, sorted by path.
+	List(prefix string) ([]ObjectInfo, error)
+	// Materialize makes the object available as a local file (e.g. for
+	// ffmpeg). cleanup must be called when the file is no longer needed.
+	Materialize(path string) (localPath string, cleanup func(), err error)
 	EnsureBasePath(base string) error
 }
 
@@ -27,26 +77,174 @@ func (l *LocalFS) EnsureBasePath(base string) error {
 	return os.MkdirAll(base, 0o755)
 }
 
-func (l *LocalFS) Save(r io.Reader, destPath string) (int64, error) {
-	full := filepath.Join(l.BasePath, destPath)
+// full resolves p under BasePath, refusing paths checkPath rejects.
+func (l *LocalFS) full(p string) (string, error) {
+	p, err := checkPath(p)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(l.BasePath, filepath.FromSlash(p)), nil
+}
+
+// Save writes to a temp file and renames it into place, so readers never
+// observe a partially written object.
+func (l *LocalFS) Save(r io.Reader, destPath string) (*ObjectInfo, error) {
+	full, err := l.full(destPath)
+	if err != nil {
+		return nil, err
+	}
 	dir := filepath.Dir(full)
 	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return 0, err
+		return nil, err
 	}
-	f, err := os.Create(full)
+	f, err := os.CreateTemp(dir, ".tmp-*")
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	defer f.Close()
-	n, err := io.Copy(f, r)
+	tmp := f.Name()
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return nil, err
+	}
+	if err := os.Rename(tmp, full); err != nil {
+		_ = os.Remove(tmp)
+		return nil, err
+	}
+	fi, err := os.Stat(full)
+	if err != nil {
+		return nil, err
+	}
+	info := l.info(destPath, fi)
+	info.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return info, nil
+}
+
+func (l *LocalFS) Open(p string) (io.ReadSeekCloser, error) {
+	full, err := l.full(p)
 	if err != nil {
-		return n, err
+		return nil, err
+	}
+	f, err := os.Open(full)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, p)
 	}
-	return n, nil
+	return f, err
+}
+
+func (l *LocalFS) Stat(p string) (*ObjectInfo, error) {
+	full, err := l.full(p)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(full)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, p)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return nil, fmt.Errorf("%w: %s is a directory", ErrNotFound, p)
+	}
+	return l.info(p, fi), nil
+}
+
+func (l *LocalFS) Delete(p string) error {
+	full, err := l.full(p)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(full)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (l *LocalFS) List(prefix string) ([]ObjectInfo, error) {
+	prefix, err := checkPath(prefix)
+	if err != nil {
+		return nil, err
+	}
+	// walk from the deepest directory the prefix names
+	root := l.BasePath
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		root = filepath.Join(l.BasePath, filepath.FromSlash(prefix[:i]))
+	}
+	var out []ObjectInfo
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+		rel, err := filepath.Rel(l.BasePath, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !strings.HasPrefix(rel, prefix) {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		out = append(out, *l.info(rel, fi))
+		return nil
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out, err
+}
+
+// Materialize returns the file's real path; there is nothing to clean up.
+func (l *LocalFS) Materialize(p string) (string, func(), error) {
+	full, err := l.full(p)
+	if err != nil {
+		return "", nil, err
+	}
+	if _, err := l.Stat(p); err != nil {
+		return "", nil, err
+	}
+	return full, func() {}, nil
+}
+
+func (l *LocalFS) info(p string, fi fs.FileInfo) *ObjectInfo {
+	return &ObjectInfo{
+		Path:    filepath.ToSlash(p),
+		Size:    fi.Size(),
+		ModTime: fi.ModTime(),
+		ETag:    fmt.Sprintf("%x-%x", fi.Size(), fi.ModTime().UnixNano()),
+	}
+}
+
+// SaveFile uploads a local file to destPath.
+func SaveFile(s Storage, localPath, destPath string) (*ObjectInfo, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return s.Save(f, destPath)
 }
 
 // Helper to build path with timestamp filename suffix
 func BuildPath(filename string) string {
 	t := time.Now().UTC().Format("20060102-150405")
-	return filepath.Join(t[:8], fmt.Sprintf("%s-%s", t, filename))
+	return filepath.ToSlash(filepath.Join(t[:8], fmt.Sprintf("%s-%s", t, filename)))
+}
+
+// ArtifactPath is where derived files (outputs, waveforms...) of the upload
+// stored at uploadPath live: "<uploadPath>.artifacts/<name>".
+func ArtifactPath(uploadPath, name string) string {
+	return uploadPath + ".artifacts/" + name
 }
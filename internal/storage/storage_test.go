@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalFS_SaveOpenDelete(t *testing.T) {
+	base := t.TempDir()
+	l := NewLocalFS(base)
+
+	data := []byte("RIFF....WAVEfmt tiny audio")
+	info, err := l.Save(bytes.NewReader(data), "20250101/a.wav")
+	require.NoError(t, err)
+	sum := sha256.Sum256(data)
+	require.Equal(t, hex.EncodeToString(sum[:]), info.SHA256)
+	require.Equal(t, int64(len(data)), info.Size)
+	require.Equal(t, "20250101/a.wav", info.Path)
+	require.NotEmpty(t, info.ETag)
+
+	// no temp file is left behind next to the object
+	entries, err := os.ReadDir(filepath.Join(base, "20250101"))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	// overwrite replaces the content
+	data = []byte("replaced")
+	_, err = l.Save(bytes.NewReader(data), "20250101/a.wav")
+	require.NoError(t, err)
+
+	rc, err := l.Open("20250101/a.wav")
+	require.NoError(t, err)
+	_, err = rc.Seek(2, io.SeekStart)
+	require.NoError(t, err)
+	got, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.Equal(t, data[2:], got)
+	require.NoError(t, rc.Close())
+
+	require.NoError(t, l.Delete("20250101/a.wav"))
+	require.NoError(t, l.Delete("20250101/a.wav"), "delete is idempotent")
+	_, err = l.Open("20250101/a.wav")
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = l.Stat("20250101/a.wav")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestLocalFS_SaveFailedReaderLeavesNothing(t *testing.T) {
+	base := t.TempDir()
+	l := NewLocalFS(base)
+
+	_, err := l.Save(io.MultiReader(bytes.NewReader([]byte("partial")), errReader{}), "x/b.mp3")
+	require.Error(t, err)
+	entries, err := os.ReadDir(filepath.Join(base, "x"))
+	require.NoError(t, err)
+	require.Empty(t, entries)
+	_, err = l.Stat("x/b.mp3")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestLocalFS_RejectsPathsOutsideBase(t *testing.T) {
+	base := t.TempDir()
+	l := NewLocalFS(filepath.Join(base, "store"))
+
+	for _, p := range []string{"../escape.txt", "a/../../escape.txt", "a/..", "/etc/passwd", "/abs.txt"} {
+		_, err := l.Save(bytes.NewReader([]byte("x")), p)
+		require.ErrorIs(t, err, ErrInvalidPath, p)
+		_, err = l.Open(p)
+		require.ErrorIs(t, err, ErrInvalidPath, p)
+		_, err = l.Stat(p)
+		require.ErrorIs(t, err, ErrInvalidPath, p)
+		require.ErrorIs(t, l.Delete(p), ErrInvalidPath, p)
+		_, err = l.List(p)
+		require.ErrorIs(t, err, ErrInvalidPath, p)
+		_, _, err = l.Materialize(p)
+		require.ErrorIs(t, err, ErrInvalidPath, p)
+	}
+	_, err := os.Stat(filepath.Join(base, "escape.txt"))
+	require.True(t, os.IsNotExist(err))
+
+	// names that merely contain dots are fine
+	_, err = l.Save(bytes.NewReader([]byte("x")), "a/..b/c..mp3")
+	require.NoError(t, err)
+	_, err = l.Stat("a/./..b/c..mp3")
+	require.NoError(t, err)
+}
+
+func TestS3KeyStaysUnderPrefix(t *testing.T) {
+	s, err := NewS3(S3Config{Endpoint: "localhost:9000", Bucket: "b", Prefix: "/audio/"})
+	require.NoError(t, err)
+	for p, want := range map[string]string{
+		"a.mp3":                 "audio/a.mp3",
+		"2026/a.mp3.artifacts/": "audio/2026/a.mp3.artifacts/",
+		"":                      "audio/",
+		"a/..b.mp3":             "audio/a/..b.mp3",
+	} {
+		got, err := s.key(p)
+		require.NoError(t, err, p)
+		require.Equal(t, want, got, p)
+	}
+	for _, p := range []string{"../other/a.mp3", "a/../../other", "..", "/a.mp3"} {
+		_, err := s.key(p)
+		require.ErrorIs(t, err, ErrInvalidPath, p)
+	}
+}
+
+func TestContentType(t *testing.T) {
+	for p, want := range map[string]string{
+		"a/b.MP3":            "audio/mpeg",
+		"x.opus":             "audio/ogg",
+		"stream/master.m3u8": "application/vnd.apple.mpegurl",
+		"peaks.json":         "application/json",
+		"noext":              "application/octet-stream",
+	} {
+		require.Equal(t, want, ContentType(p), p)
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) { return 0, errors.New("connection reset") }
@@ -0,0 +1,209 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/db"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// Config tunes the dispatcher. Zero values take the defaults noted.
+type Config struct {
+	Interval    time.Duration // poll interval, default 1s
+	BatchSize   int           // deliveries attempted concurrently, default 20
+	Timeout     time.Duration // per request, default 10s
+	MaxAttempts int           // before a delivery is marked failed, default 8
+	// Retries wait BaseDelay * 2^(attempt-1), capped at MaxDelay, with
+	// +-20% jitter. Defaults 10s and 1h: the seven waits between eight
+	// attempts add up to about 21 min (1270s).
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	Retention time.Duration // finished deliveries are purged after, default 7 days
+}
+
+func (c Config) withDefaults() Config {
+	if c.Interval <= 0 {
+		c.Interval = time.Second
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 20
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 10 * time.Second
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 8
+	}
+	if c.BaseDelay <= 0 {
+		c.BaseDelay = 10 * time.Second
+	}
+	if c.MaxDelay <= 0 {
+		c.MaxDelay = time.Hour
+	}
+	if c.Retention <= 0 {
+		c.Retention = 7 * 24 * time.Hour
+	}
+	return c
+}
+
+// Backoff is the delay before the next try after attempts failed attempts,
+// without jitter.
+func (c Config) Backoff(attempts int) time.Duration {
+	c = c.withDefaults()
+	d := c.BaseDelay
+	for i := 1; i < attempts && d < c.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, c.MaxDelay)
+}
+
+// Dispatcher POSTs queued deliveries and reschedules failed ones. Several
+// dispatchers (one per API replica) can run against the same tables.
+type Dispatcher struct {
+	db     *db.DB
+	cfg    Config
+	client *http.Client
+}
+
+// NewDispatcher creates a dispatcher; call Run to start it.
+func NewDispatcher(database *db.DB, cfg Config) *Dispatcher {
+	cfg = cfg.withDefaults()
+	return &Dispatcher{
+		db:  database,
+		cfg: cfg,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			// a redirect is reported as a failed attempt rather than followed
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+}
+
+// Run loops until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.Interval)
+	defer ticker.Stop()
+	lastPurge := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		d.drain(ctx)
+
+		if time.Since(lastPurge) > time.Hour {
+			if n, err := d.db.PurgeWebhookDeliveries(ctx, d.cfg.Retention); err != nil {
+				log.Warn().Err(err).Msg("webhook purge failed")
+			} else if n > 0 {
+				log.Info().Int64("rows", n).Msg("webhook deliveries purged")
+			}
+			lastPurge = time.Now()
+		}
+	}
+}
+
+// drain attempts full batches until no delivery is due.
+func (d *Dispatcher) drain(ctx context.Context) {
+	// a claimed delivery is skipped by other dispatchers until the lease
+	// ends; it covers the request plus recording the outcome
+	lease := d.cfg.Timeout + 30*time.Second
+	for ctx.Err() == nil {
+		due, err := d.db.ClaimDueDeliveries(ctx, d.cfg.BatchSize, lease)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Error().Err(err).Msg("claim webhook deliveries failed")
+			}
+			return
+		}
+		var wg sync.WaitGroup
+		for _, dl := range due {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				d.deliver(ctx, dl)
+			}()
+		}
+		wg.Wait()
+		if len(due) < d.cfg.BatchSize {
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, dl db.DueDelivery) {
+	start := time.Now()
+	code, err := d.post(ctx, dl)
+	took := time.Since(start)
+	if ctx.Err() != nil {
+		// shutting down; the lease expires and another attempt follows
+		return
+	}
+
+	attempts := dl.Attempts + 1
+	var retryAt time.Time
+	msg := ""
+	if err != nil {
+		msg = err.Error()
+		if attempts < d.cfg.MaxAttempts {
+			retryAt = time.Now().Add(jitter(d.cfg.Backoff(attempts)))
+		}
+	}
+	result := "ok"
+	switch {
+	case err != nil && retryAt.IsZero():
+		result = "failed"
+		log.Warn().Err(err).Int64("delivery_id", dl.ID).Int("attempts", attempts).Msg("webhook delivery failed permanently")
+	case err != nil:
+		result = "retry"
+	}
+	metrics.WebhookDeliveries.WithLabelValues(result).Inc()
+
+	if rerr := d.db.RecordWebhookAttempt(ctx, dl.ID, code, msg, took, err == nil, retryAt); rerr != nil {
+		log.Error().Err(rerr).Int64("delivery_id", dl.ID).Msg("record webhook attempt failed")
+	}
+}
+
+// post sends one delivery. Any 2xx response counts as delivered; code is 0
+// when no response was received.
+func (d *Dispatcher) post(ctx context.Context, dl db.DueDelivery) (code int, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dl.URL, bytes.NewReader(dl.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "phantomchain-webhooks/1")
+	req.Header.Set(HeaderEvent, dl.Event)
+	req.Header.Set(HeaderDelivery, fmt.Sprint(dl.ID))
+	req.Header.Set(HeaderSignature, Sign(dl.Secret, time.Now(), dl.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg := resp.Status
+		if s := strings.TrimSpace(string(snippet)); s != "" {
+			msg += ": " + s
+		}
+		return resp.StatusCode, fmt.Errorf("%s", msg)
+	}
+	return resp.StatusCode, nil
+}
+
+// jitter spreads retries of deliveries that failed together by +-20%.
+func jitter(d time.Duration) time.Duration {
+	return time.Duration(float64(d) * (0.8 + 0.4*rand.Float64()))
+}
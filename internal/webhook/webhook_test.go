@@ -0,0 +1,76 @@
+package webhook
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/db"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/logging"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignVerify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte(`{"event":"job.done","job_id":7}`)
+	header := Sign("whsec_test", now, body)
+	require.Regexp(t, `^t=1700000000,v1=[0-9a-f]{64}$`, header)
+
+	require.NoError(t, Verify("whsec_test", header, body, now.Add(time.Minute), 5*time.Minute))
+	require.ErrorIs(t, Verify("whsec_other", header, body, now, 5*time.Minute), ErrSignatureMismatch)
+	require.ErrorIs(t, Verify("whsec_test", header, []byte(`{"event":"job.failed","job_id":7}`), now, 5*time.Minute), ErrSignatureMismatch)
+	require.ErrorIs(t, Verify("whsec_test", header, body, now.Add(10*time.Minute), 5*time.Minute), ErrTimestampSkew)
+	require.ErrorIs(t, Verify("whsec_test", "v1=abc", body, now, 5*time.Minute), ErrBadSignatureHeader)
+
+	// receivers accept any of several v1 signatures, e.g. during secret rotation
+	rotated := header + ",v1=" + Sign("whsec_new", now, body)[len("t=1700000000,v1="):]
+	require.NoError(t, Verify("whsec_new", rotated, body, now, time.Minute))
+}
+
+func TestBackoff(t *testing.T) {
+	c := Config{BaseDelay: 10 * time.Second, MaxDelay: time.Minute}
+	var got []time.Duration
+	for attempt := 1; attempt <= 5; attempt++ {
+		got = append(got, c.Backoff(attempt))
+	}
+	require.Equal(t, []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute}, got)
+}
+
+func TestBackoffDefaults(t *testing.T) {
+	c := Config{}.withDefaults()
+	var total time.Duration
+	for attempt := 1; attempt < c.MaxAttempts; attempt++ {
+		total += c.Backoff(attempt)
+	}
+	require.Equal(t, 1270*time.Second, total)
+	require.Equal(t, time.Hour, c.Backoff(20), "capped at MaxDelay")
+}
+
+func TestJitter(t *testing.T) {
+	d := 100 * time.Second
+	lo, hi := d, d
+	for i := 0; i < 1000; i++ {
+		j := jitter(d)
+		require.GreaterOrEqual(t, j, 80*time.Second)
+		require.LessOrEqual(t, j, 120*time.Second)
+		lo, hi = min(lo, j), max(hi, j)
+	}
+	// the spread is actually used, not a constant factor
+	require.Less(t, lo, 90*time.Second)
+	require.Greater(t, hi, 110*time.Second)
+}
+
+// cmd/api runs the dispatcher without initializing the zap logger; a failing
+// database must only be logged.
+func TestDispatcherSurvivesDatabaseErrorsWithoutZapLogger(t *testing.T) {
+	logging.Logger = nil
+	pool, err := pgxpool.New(context.Background(), "postgres://u:p@127.0.0.1:1/none?connect_timeout=1")
+	require.NoError(t, err)
+	defer pool.Close()
+
+	d := NewDispatcher(&db.DB{Pool: pool}, Config{Interval: 10 * time.Millisecond})
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	d.Run(ctx)
+}
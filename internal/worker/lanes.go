@@ -0,0 +1,164 @@
+package worker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/queue"
+)
+
+// DefaultLaneWeights give, while every lane is backlogged, 60% of the picks
+// to high, 30% to normal and 10% to low priority jobs.
+var DefaultLaneWeights = map[string]int{
+	queue.PriorityHigh:   6,
+	queue.PriorityNormal: 3,
+	queue.PriorityLow:    1,
+}
+
+// ParseLaneWeights parses "high=6,normal=3,low=1"; lanes left out keep
+// their DefaultLaneWeights value.
+func ParseLaneWeights(spec string) (map[string]int, error) {
+	weights := make(map[string]int, len(DefaultLaneWeights))
+	for k, v := range DefaultLaneWeights {
+		weights[k] = v
+	}
+	for _, f := range strings.Split(spec, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		name, val, ok := strings.Cut(f, "=")
+		if !ok {
+			return nil, fmt.Errorf("lane weight %q: want lane=weight", f)
+		}
+		lane, err := queue.ParsePriority(name)
+		if err != nil || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("lane weight %q: unknown lane", f)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(val))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("lane weight %q: weight must be a positive integer", f)
+		}
+		weights[lane] = n
+	}
+	return weights, nil
+}
+
+// laneIndex maps a priority to its position in queue.Priorities.
+func laneIndex(priority string) int {
+	for i, p := range queue.Priorities {
+		if p == priority {
+			return i
+		}
+	}
+	return laneIndex(queue.PriorityNormal)
+}
+
+// laneScheduler decides which lane a free worker serves first, by smooth
+// weighted round robin. A worker whose preferred lane is empty takes from
+// the others, highest first, so idle capacity is never wasted; a lane with
+// a backlog still gets at least its weight's share of the picks.
+type laneScheduler struct {
+	mu      sync.Mutex
+	weights []int
+	current []int
+	total   int
+}
+
+// newLaneScheduler takes one weight per queue.Priorities entry; missing or
+// non-positive weights become 1 so no lane can starve.
+func newLaneScheduler(weights map[string]int) *laneScheduler {
+	s := &laneScheduler{
+		weights: make([]int, len(queue.Priorities)),
+		current: make([]int, len(queue.Priorities)),
+	}
+	for i, p := range queue.Priorities {
+		w := weights[p]
+		if w < 1 {
+			w = 1
+		}
+		s.weights[i] = w
+		s.total += w
+	}
+	return s
+}
+
+// order returns lane indexes in the order a worker should try them.
+func (s *laneScheduler) order() []int {
+	s.mu.Lock()
+	best := 0
+	for i, w := range s.weights {
+		s.current[i] += w
+		if s.current[i] > s.current[best] {
+			best = i
+		}
+	}
+	s.current[best] -= s.total
+	s.mu.Unlock()
+
+	order := make([]int, 0, len(s.weights))
+	order = append(order, best)
+	for i := range s.weights {
+		if i != best {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+// next returns the next task for a worker: it polls the lanes in scheduler
+// order and, when all are empty, waits for whichever gets a task first. It
+// relies on there being exactly three lanes, one per queue.Priorities entry.
+// open tracks the lanes this worker has not yet seen closed; ok is false
+// once every lane is closed and drained.
+func (p *Pool) next(open []bool) (task, bool) {
+	for _, i := range p.sched.order() {
+		if !open[i] {
+			continue
+		}
+		select {
+		case t, ok := <-p.lanes[i]:
+			if ok {
+				return t, true
+			}
+			open[i] = false
+		default:
+		}
+	}
+	// closed lanes become nil channels, which a select never picks
+	lane := func(i int) <-chan task {
+		if open[i] {
+			return p.lanes[i]
+		}
+		return nil
+	}
+	for open[0] || open[1] || open[2] {
+		var t task
+		var ok bool
+		var i int
+		select {
+		case t, ok = <-lane(0):
+			i = 0
+		case t, ok = <-lane(1):
+			i = 1
+		case t, ok = <-lane(2):
+			i = 2
+		}
+		if ok {
+			return t, true
+		}
+		open[i] = false
+	}
+	return task{}, false
+}
+
+// Buffered returns how many jobs wait in this pool's memory, per lane.
+func (p *Pool) Buffered() map[string]int {
+	out := make(map[string]int, len(p.lanes))
+	for i, ch := range p.lanes {
+		out[queue.Priorities[i]] = len(ch)
+	}
+	return out
+}
@@ -0,0 +1,183 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/queue"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLaneWeights(t *testing.T) {
+	cases := []struct {
+		spec string
+		want map[string]int
+		err  bool
+	}{
+		{"", map[string]int{"high": 6, "normal": 3, "low": 1}, false},
+		{"high=10", map[string]int{"high": 10, "normal": 3, "low": 1}, false},
+		{" high = 2 , LOW=2,", map[string]int{"high": 2, "normal": 3, "low": 2}, false},
+		{"high=1,normal=1,low=1", map[string]int{"high": 1, "normal": 1, "low": 1}, false},
+		{"high", nil, true},
+		{"urgent=5", nil, true},
+		{"=5", nil, true},
+		{"low=0", nil, true},
+		{"low=-1", nil, true},
+		{"low=x", nil, true},
+	}
+	for _, tc := range cases {
+		got, err := ParseLaneWeights(tc.spec)
+		if tc.err {
+			require.Error(t, err, tc.spec)
+			continue
+		}
+		require.NoError(t, err, tc.spec)
+		require.Equal(t, tc.want, got, tc.spec)
+	}
+	require.Equal(t, 6, DefaultLaneWeights[queue.PriorityHigh], "parsing must not modify the defaults")
+}
+
+// picks returns the first lane of n consecutive scheduler orders.
+func picks(s *laneScheduler, n int) []int {
+	out := make([]int, n)
+	for i := range out {
+		order := s.order()
+		out[i] = order[0]
+	}
+	return out
+}
+
+func TestLaneSchedulerSequence(t *testing.T) {
+	// next relies on one lane per priority
+	require.Len(t, queue.Priorities, 3)
+
+	s := newLaneScheduler(DefaultLaneWeights)
+	// smooth WRR interleaves the picks instead of serving lanes in bursts
+	want := []int{0, 1, 0, 0, 1, 0, 2, 0, 1, 0}
+	for round := 0; round < 3; round++ {
+		require.Equal(t, want, picks(s, 10), "round %d", round)
+	}
+
+	// the preferred lane comes first, then the rest highest first
+	s = newLaneScheduler(map[string]int{"low": 100})
+	require.Equal(t, []int{2, 0, 1}, s.order())
+}
+
+func TestLaneSchedulerShares(t *testing.T) {
+	cases := []struct {
+		weights map[string]int
+		want    [3]int // picks per lane in one cycle of sum(weights)
+	}{
+		{map[string]int{"high": 6, "normal": 3, "low": 1}, [3]int{6, 3, 1}},
+		{map[string]int{"high": 1, "normal": 1, "low": 1}, [3]int{1, 1, 1}},
+		{map[string]int{"high": 1, "normal": 2, "low": 5}, [3]int{1, 2, 5}},
+		// missing and non-positive weights become 1
+		{map[string]int{"high": 4, "low": 0}, [3]int{4, 1, 1}},
+		{nil, [3]int{1, 1, 1}},
+	}
+	for _, tc := range cases {
+		s := newLaneScheduler(tc.weights)
+		cycle := tc.want[0] + tc.want[1] + tc.want[2]
+		for round := 0; round < 5; round++ {
+			var got [3]int
+			for _, lane := range picks(s, cycle) {
+				got[lane]++
+			}
+			require.Equal(t, tc.want, got, "%v round %d", tc.weights, round)
+		}
+	}
+}
+
+func TestLaneSchedulerNoStarvation(t *testing.T) {
+	s := newLaneScheduler(map[string]int{"high": 100, "normal": 1, "low": 1})
+	// however lopsided the weights, every lane is picked once per cycle
+	last := [3]int{-1, -1, -1}
+	for i, lane := range picks(s, 102*10) {
+		if last[lane] >= 0 {
+			require.LessOrEqual(t, i-last[lane], 102, "lane %d waited too long", lane)
+		}
+		last[lane] = i
+	}
+	for lane, at := range last {
+		require.GreaterOrEqual(t, at, 102*9, "lane %d not picked in the last cycle", lane)
+	}
+}
+
+// lanePool builds a pool with only the lane plumbing next needs.
+func lanePool(weights map[string]int) *Pool {
+	p := &Pool{sched: newLaneScheduler(weights), lanes: make([]chan task, len(queue.Priorities))}
+	for i := range p.lanes {
+		p.lanes[i] = make(chan task, 16)
+	}
+	return p
+}
+
+func TestPoolNext(t *testing.T) {
+	p := lanePool(DefaultLaneWeights)
+	for i, prio := range queue.Priorities {
+		for n := 0; n < 4; n++ {
+			p.lanes[i] <- task{jm: queue.JobMessage{JobID: int64(i*10 + n), Priority: prio}}
+		}
+	}
+	open := []bool{true, true, true}
+	// with every lane backlogged the scheduler's order decides
+	var got []string
+	for n := 0; n < 7; n++ {
+		tk, ok := p.next(open)
+		require.True(t, ok)
+		got = append(got, tk.jm.Lane())
+	}
+	require.Equal(t, []string{"high", "normal", "high", "high", "normal", "high", "low"}, got)
+
+	// once the preferred lane is empty the others are served
+	for n := 0; n < 5; n++ {
+		tk, ok := p.next(open)
+		require.True(t, ok)
+		require.NotEqual(t, "high", tk.jm.Lane())
+	}
+	require.Equal(t, map[string]int{"high": 0, "normal": 0, "low": 0}, p.Buffered())
+
+	// with nothing buffered next waits for whichever lane gets a task
+	res := make(chan task, 1)
+	go func() {
+		tk, _ := p.next(open)
+		res <- tk
+	}()
+	select {
+	case <-res:
+		t.Fatal("next returned with every lane empty")
+	case <-time.After(50 * time.Millisecond):
+	}
+	p.lanes[2] <- task{jm: queue.JobMessage{JobID: 99, Priority: "low"}}
+	select {
+	case tk := <-res:
+		require.EqualValues(t, 99, tk.jm.JobID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("next did not pick up the new task")
+	}
+}
+
+func TestPoolNextDrainsClosedLanes(t *testing.T) {
+	p := lanePool(DefaultLaneWeights)
+	p.lanes[1] <- task{jm: queue.JobMessage{JobID: 1}}
+	p.lanes[2] <- task{jm: queue.JobMessage{JobID: 2, Priority: "low"}}
+	for _, ch := range p.lanes {
+		close(ch)
+	}
+	open := []bool{true, true, true}
+	var ids []int64
+	for {
+		tk, ok := p.next(open)
+		if !ok {
+			break
+		}
+		ids = append(ids, tk.jm.JobID)
+	}
+	require.ElementsMatch(t, []int64{1, 2}, ids, "buffered tasks are handed out before stopping")
+	require.Equal(t, []bool{false, false, false}, open)
+
+	// a worker that already saw every lane closed stops at once
+	tk, ok := p.next(open)
+	require.False(t, ok)
+	require.Zero(t, tk)
+}
@@ -2,7 +2,9 @@ package worker
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
 	"sync"
 	"time"
 
@@ -16,27 +18,138 @@ import (
 // Handler defines the signature of a job processor.
 type Handler func(ctx context.Context, jm queue.JobMessage) error
 
+// ErrJobCancelled is the cause of a handler's context when its job was
+// cancelled through Cancel.
+var ErrJobCancelled = errors.New("job cancelled")
+
+// ErrLeaseLost is the cause of a handler's context when its job's lease
+// expired and the reaper handed the job to someone else. It is the
+// db.ErrLeaseLost that settling such a job returns.
+var ErrLeaseLost = db.ErrLeaseLost
+
 // Pool is a bounded worker pool that executes jobs concurrently with retry & backoff.
+// Jobs wait in one buffered lane per priority (see laneScheduler).
 type Pool struct {
 	db             *db.DB
 	concurrency    int
-	jobs           chan queue.JobMessage
+	lanes          []chan task // indexed like queue.Priorities
+	sched          *laneScheduler
+	laneWeights    map[string]int
 	wg             sync.WaitGroup
 	handler        Handler
 	retryBaseDelay time.Duration
 	maxRetries     int
+	jobTimeout     time.Duration
+	onCancel       Handler
+	// owner prefixes the claimed_by of this pool's workers; leaseTTL is how
+	// long a claim lasts without a heartbeat.
+	owner    string
+	leaseTTL time.Duration
+	// renewLease is db.RenewJobLease; tests replace it.
+	renewLease func(ctx context.Context, jobID int64, worker string, ttl time.Duration) (status string, owned bool, err error)
+
+	runMu   sync.Mutex
+	running map[int64]context.CancelCauseFunc
+
+	mu     sync.RWMutex
+	closed bool
+	done   chan struct{}
+}
+
+// PoolOption tweaks pool defaults.
+type PoolOption func(*Pool)
+
+// WithJobTimeout bounds a single handler run (default 10m).
+func WithJobTimeout(d time.Duration) PoolOption {
+	return func(p *Pool) {
+		if d > 0 {
+			p.jobTimeout = d
+		}
+	}
+}
+
+// WithRetryBaseDelay sets the first retry delay; later retries double it (default 2s).
+func WithRetryBaseDelay(d time.Duration) PoolOption {
+	return func(p *Pool) {
+		if d > 0 {
+			p.retryBaseDelay = d
+		}
+	}
+}
+
+// WithLaneWeights sets the relative share of picks each priority lane gets
+// while all of them are backlogged (default DefaultLaneWeights).
+func WithLaneWeights(w map[string]int) PoolOption {
+	return func(p *Pool) {
+		if len(w) > 0 {
+			p.laneWeights = w
+		}
+	}
+}
+
+// WithLeaseTTL sets how long a worker owns a job without renewing its lease
+// (default 30s, at least 1s); it renews every third of that while the
+// handler runs.
+func WithLeaseTTL(d time.Duration) PoolOption {
+	return func(p *Pool) {
+		if d >= time.Second {
+			p.leaseTTL = d
+		}
+	}
+}
+
+// WithCancelCleanup runs fn after a job was cancelled, before it is marked
+// cancelled, to remove what the handler produced so far.
+func WithCancelCleanup(fn Handler) PoolOption {
+	return func(p *Pool) {
+		p.onCancel = fn
+	}
 }
 
-// NewPool creates a worker pool with bounded concurrency and internal queue.
-func NewPool(database *db.DB, concurrency int, queueSize int, handler Handler) *Pool {
-	return &Pool{
+// task is a queued job plus, in JetStream mode, the delivery to settle once it is handled.
+type task struct {
+	jm       queue.JobMessage
+	delivery *queue.Delivery
+}
+
+// NewPool creates a worker pool with bounded concurrency and an internal
+// queue of queueSize per lane.
+func NewPool(database *db.DB, concurrency int, queueSize int, handler Handler, opts ...PoolOption) *Pool {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	p := &Pool{
 		db:             database,
 		concurrency:    concurrency,
-		jobs:           make(chan queue.JobMessage, queueSize),
+		laneWeights:    DefaultLaneWeights,
 		handler:        handler,
 		retryBaseDelay: 2 * time.Second,
 		maxRetries:     3,
+		jobTimeout:     10 * time.Minute,
+		owner:          defaultOwner(),
+		leaseTTL:       30 * time.Second,
+		running:        make(map[int64]context.CancelCauseFunc),
+		done:           make(chan struct{}),
+	}
+	p.renewLease = database.RenewJobLease
+	for _, o := range opts {
+		o(p)
+	}
+	p.sched = newLaneScheduler(p.laneWeights)
+	p.lanes = make([]chan task, len(queue.Priorities))
+	for i := range p.lanes {
+		p.lanes[i] = make(chan task, queueSize)
+	}
+	return p
+}
+
+// defaultOwner identifies this process in claimed_by: host and pid.
+func defaultOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
 	}
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
 }
 
 // Start launches all worker goroutines.
@@ -51,86 +164,310 @@ func (p *Pool) Start(ctx context.Context) {
 // Stop gracefully stops all workers and waits until they finish.
 func (p *Pool) Stop() {
 	logging.Logger.Info("stopping worker pool")
-	close(p.jobs)
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	for _, ch := range p.lanes {
+		close(ch)
+	}
+	p.mu.Unlock()
 	p.wg.Wait()
+	close(p.done)
+}
+
+// Done is closed once Stop has drained all workers.
+func (p *Pool) Done() <-chan struct{} {
+	return p.done
 }
 
-// Enqueue pushes a job into the queue (non-blocking; returns error if full).
+// Enqueue pushes a job into its lane (non-blocking; returns error if full).
 func (p *Pool) Enqueue(j queue.JobMessage) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return fmt.Errorf("worker pool stopped")
+	}
 	select {
-	case p.jobs <- j:
+	case p.lanes[laneIndex(j.Lane())] <- task{jm: j}:
 		return nil
 	default:
-		return fmt.Errorf("job queue full")
+		return fmt.Errorf("job queue full (%s lane)", j.Lane())
+	}
+}
+
+// Submit queues a JetStream delivery in its lane, blocking until there is room or ctx is done.
+// Nothing is lost while waiting: the message stays unacked on the stream.
+func (p *Pool) Submit(ctx context.Context, d *queue.Delivery) error {
+	d.KeepAlive()
+	select {
+	case p.lanes[laneIndex(d.Job.Lane())] <- task{jm: d.Job, delivery: d}:
+		return nil
+	case <-ctx.Done():
+		_ = d.Nak(0)
+		return ctx.Err()
+	}
+}
+
+// Cancel stops the handler running jobID in this pool, if any, by
+// cancelling its context with ErrJobCancelled.
+func (p *Pool) Cancel(jobID int64) bool {
+	p.runMu.Lock()
+	defer p.runMu.Unlock()
+	cancel, ok := p.running[jobID]
+	if ok {
+		cancel(ErrJobCancelled)
+	}
+	return ok
+}
+
+// run executes the handler with the job timeout, cancellable through Cancel.
+// The lease of worker on the job is renewed until leaseCtx ends, which the
+// caller lets outlast the run so the lease also covers settling it. stopped
+// is ErrJobCancelled or ErrLeaseLost when the run was cut short for that
+// reason, nil otherwise.
+func (p *Pool) run(ctx, leaseCtx context.Context, jm queue.JobMessage, worker string) (stopped, err error) {
+	jobCtx, cancelJob := context.WithCancelCause(ctx)
+	p.runMu.Lock()
+	p.running[jm.JobID] = cancelJob
+	p.runMu.Unlock()
+	defer func() {
+		p.runMu.Lock()
+		delete(p.running, jm.JobID)
+		p.runMu.Unlock()
+		cancelJob(nil)
+	}()
+	go p.heartbeat(leaseCtx, cancelJob, jm.JobID, worker)
+
+	runCtx, cancel := context.WithTimeout(jobCtx, p.jobTimeout)
+	defer cancel()
+	err = p.handler(runCtx, jm)
+	if cause := context.Cause(jobCtx); errors.Is(cause, ErrJobCancelled) || errors.Is(cause, ErrLeaseLost) {
+		return cause, err
+	}
+	return nil, err
+}
+
+// heartbeat renews worker's lease on the job every third of the lease TTL
+// until ctx ends. It stops the run when the job is no longer the worker's,
+// and when a cancellation is pending whose broadcast never arrived. A
+// cancelling job keeps its lease, so the reaper does not clean up after it
+// while the worker's own cleanup runs.
+func (p *Pool) heartbeat(ctx context.Context, stop context.CancelCauseFunc, jobID int64, worker string) {
+	t := time.NewTicker(p.leaseTTL / 3)
+	defer t.Stop()
+	cancelled := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		status, owned, err := p.renewLease(ctx, jobID, worker, p.leaseTTL)
+		switch {
+		case err != nil:
+			// keep going; the lease only runs out if this lasts a whole TTL
+			if ctx.Err() == nil {
+				logging.Logger.Warn("renew job lease failed", zap.Int64("job", jobID), zap.Error(err))
+			}
+		case !owned:
+			stop(ErrLeaseLost)
+			return
+		case status == "cancelling" && !cancelled:
+			stop(ErrJobCancelled)
+			cancelled = true
+		}
+	}
+}
+
+// finishCancelled cleans up after a job cancelled under worker and marks it
+// cancelled.
+func (p *Pool) finishCancelled(ctx context.Context, t task, worker string) {
+	jm := t.jm
+	msg := "job cancelled"
+	if p.onCancel != nil {
+		if err := p.onCancel(ctx, jm); err != nil {
+			logging.Logger.Error("cancel cleanup failed", zap.Int64("job", jm.JobID), zap.Error(err))
+			msg += "; cleanup failed: " + err.Error()
+		}
+	}
+	if err := p.db.FinishCancelledJob(ctx, jm.JobID, worker, msg); errors.Is(err, ErrLeaseLost) {
+		logging.Logger.Warn("cancelled job was taken over by the reaper", zap.Int64("job", jm.JobID))
+	} else if err != nil {
+		logging.Logger.Error("mark job cancelled failed", zap.Int64("job", jm.JobID), zap.Error(err))
 	}
+	metrics.JobsProcessed.WithLabelValues("cancelled", jm.Type).Inc()
+	if t.delivery != nil {
+		_ = t.delivery.Ack()
+	}
+	logging.Logger.Info("job cancelled", zap.Int64("job", jm.JobID))
 }
 
+// settleTimeout bounds the writes that record a job's outcome.
+const settleTimeout = 30 * time.Second
+
 // workerLoop consumes jobs and executes them with retry and backoff.
 func (p *Pool) workerLoop(ctx context.Context, id int) {
 	defer p.wg.Done()
-	for jm := range p.jobs {
+	open := make([]bool, len(p.lanes))
+	for i := range open {
+		open[i] = true
+	}
+	name := fmt.Sprintf("%s/worker-%d", p.owner, id)
+	for {
+		t, ok := p.next(open)
+		if !ok {
+			return
+		}
+		jm := t.jm
 		// Claim job atomically to avoid duplicates
-		claimed, err := p.db.TryClaimJob(ctx, jm.JobID, fmt.Sprintf("worker-%d", id))
+		claimed, err := p.db.TryClaimJob(ctx, jm.JobID, name, p.leaseTTL)
 		if err != nil {
 			_ = p.db.UpdateJobStatus(ctx, jm.JobID, "queued", 0, "claim error: "+err.Error())
 			logging.Logger.Error("claim error", zap.Int64("job", jm.JobID), zap.Error(err))
+			if t.delivery != nil {
+				_ = t.delivery.Nak(p.retryBaseDelay)
+			}
 			continue
 		}
 		if !claimed {
-			continue // another worker already took it
+			// another worker already took it (or it is finished)
+			if t.delivery != nil {
+				_ = t.delivery.Ack()
+			}
+			continue
 		}
 
 		// Instrument: increment gauges/counters
 		metrics.CurrentJobs.Inc()
 		start := time.Now()
-		logging.Logger.Info("processing job", zap.Int64("job", jm.JobID), zap.Int("worker", id))
+		logging.Logger.Info("processing job", zap.Int64("job", jm.JobID), zap.String("priority", jm.Lane()), zap.Int("worker", id))
 
-		jobCtx, cancel := context.WithTimeout(ctx, 10*time.Minute)
-		err = p.handler(jobCtx, jm)
-		cancel()
+		// the lease is held until the outcome, a cancel cleanup included, is recorded
+		leaseCtx, releaseLease := context.WithCancel(context.WithoutCancel(ctx))
+		stopped, err := p.run(ctx, leaseCtx, jm, name)
+		metrics.CurrentJobs.Dec()
 
 		duration := time.Since(start).Seconds()
 		metrics.JobDuration.WithLabelValues(jm.Type).Observe(duration)
 
-		if err != nil {
-			metrics.JobFailures.Inc()
-			metrics.JobsProcessed.WithLabelValues("failed", jm.Type).Inc()
-			metrics.CurrentJobs.Dec()
-			// Record failure details
-			_, _ = p.db.Pool.Exec(ctx,
-				`UPDATE jobs SET retry_count = retry_count + 1, last_error = $1 WHERE id=$2`,
-				err.Error(), jm.JobID)
-
-			var retryCount, maxRetries int
-			_ = p.db.Pool.QueryRow(ctx,
-				`SELECT retry_count, max_retries FROM jobs WHERE id=$1`,
-				jm.JobID).Scan(&retryCount, &maxRetries)
-
-			if retryCount >= maxRetries {
-				_ = p.db.UpdateJobStatus(ctx, jm.JobID, "failed", 0,
-					fmt.Sprintf("job failed after %d retries: %s", retryCount, err.Error()))
-				logging.Logger.Error("job failed permanently", zap.Int64("job", jm.JobID), zap.Int("retries", retryCount))
-				continue
+		// record the outcome even when ctx was cancelled by a shutdown, or
+		// the job would stay running until its lease expires
+		sctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), settleTimeout)
+		p.settle(sctx, t, id, name, start, stopped, err)
+		cancel()
+		releaseLease()
+	}
+}
+
+// settle records the outcome of a run of t by the worker called name:
+// cancelled, retried with backoff, dead-lettered or done.
+func (p *Pool) settle(ctx context.Context, t task, id int, name string, start time.Time, stopped, err error) {
+	jm := t.jm
+	if errors.Is(stopped, ErrJobCancelled) {
+		p.finishCancelled(ctx, t, name)
+		return
+	}
+	if errors.Is(stopped, ErrLeaseLost) {
+		p.abandon(t, id)
+		return
+	}
+	if err != nil {
+		metrics.JobFailures.Inc()
+		metrics.JobsProcessed.WithLabelValues("failed", jm.Type).Inc()
+		// Record failure details
+		retryCount, maxRetries, ferr := p.db.RecordJobFailure(ctx, jm.JobID, name, err.Error())
+		if errors.Is(ferr, ErrLeaseLost) {
+			p.abandon(t, id)
+			return
+		}
+		if ferr != nil {
+			// the job stays running; once its lease expires the reaper
+			// counts the attempt and retries it
+			logging.Logger.Error("record job failure failed", zap.Int64("job", jm.JobID), zap.Error(ferr))
+			if t.delivery != nil {
+				_ = t.delivery.Ack()
+			}
+			return
+		}
+
+		if retryCount >= maxRetries {
+			// the dead letter keeps the failure context for requeueing
+			settled, serr := p.db.DeadLetterJob(ctx, jm.JobID,
+				fmt.Sprintf("job failed after %d retries: %s", retryCount, err.Error()), name, queue.DeadLetterSubject)
+			if errors.Is(serr, ErrLeaseLost) {
+				p.abandon(t, id)
+				return
+			}
+			if serr == nil && !settled {
+				p.finishCancelled(ctx, t, name)
+				return
 			}
+			if serr != nil {
+				logging.Logger.Error("dead-letter job failed", zap.Int64("job", jm.JobID), zap.Error(serr))
+			} else {
+				metrics.DeadLetters.Inc()
+			}
+			logging.Logger.Error("job failed permanently", zap.Int64("job", jm.JobID), zap.Int("retries", retryCount))
+			if t.delivery != nil {
+				_ = t.delivery.Term()
+			}
+			return
+		}
 
-			// Exponential backoff
-			backoff := p.retryBaseDelay * time.Duration(1<<uint(retryCount-1))
-			_, _ = p.db.Pool.Exec(ctx, `UPDATE jobs SET status='queued' WHERE id=$1`, jm.JobID)
+		// Exponential backoff
+		backoff := p.retryBaseDelay * time.Duration(1<<uint(retryCount-1))
+		settled, serr := p.db.SettleJob(ctx, jm.JobID, name, "queued", 0, "")
+		if errors.Is(serr, ErrLeaseLost) {
+			p.abandon(t, id)
+			return
+		}
+		if serr == nil && !settled {
+			p.finishCancelled(ctx, t, name)
+			return
+		}
 
+		if t.delivery != nil {
+			// let the stream redeliver it; survives a worker restart
+			_ = t.delivery.Nak(backoff)
+		} else {
 			go func(jm queue.JobMessage, delay time.Duration) {
 				time.Sleep(delay)
 				_ = p.Enqueue(jm)
 			}(jm, backoff)
-
-			logging.Logger.Warn("job failed, will retry", zap.Int64("job", jm.JobID), zap.Int("retry", retryCount), zap.Error(err))
-			continue
 		}
 
-		// Success
-		metrics.JobsProcessed.WithLabelValues("done", jm.Type).Inc()
-		metrics.CurrentJobs.Dec()
-		_ = p.db.UpdateJobStatus(ctx, jm.JobID, "done", 100,
-			fmt.Sprintf("completed in %s", time.Since(start)))
-		logging.Logger.Info("job completed", zap.Int64("job", jm.JobID), zap.Float64("duration_s", duration))
+		logging.Logger.Warn("job failed, will retry", zap.Int64("job", jm.JobID), zap.Int("retry", retryCount), zap.Error(err))
+		return
+	}
+
+	// Success
+	// a cancel that arrives after the last stage still wins
+	settled, serr := p.db.SettleJob(ctx, jm.JobID, name, "done", 100,
+		fmt.Sprintf("completed in %s", time.Since(start)))
+	if errors.Is(serr, ErrLeaseLost) {
+		p.abandon(t, id)
+		return
+	}
+	if serr == nil && !settled {
+		p.finishCancelled(ctx, t, name)
+		return
+	}
+	metrics.JobsProcessed.WithLabelValues("done", jm.Type).Inc()
+	if t.delivery != nil {
+		_ = t.delivery.Ack()
+	}
+	logging.Logger.Info("job completed", zap.Int64("job", jm.JobID), zap.Float64("duration_s", time.Since(start).Seconds()))
+}
+
+// abandon drops a run whose job the reaper took away: it already counted
+// the attempt and requeued, failed or cancelled the job, so the outcome of
+// this run is moot.
+func (p *Pool) abandon(t task, id int) {
+	logging.Logger.Warn("job lease lost, abandoning run", zap.Int64("job", t.jm.JobID), zap.Int("worker", id))
+	if t.delivery != nil {
+		_ = t.delivery.Ack()
 	}
 }
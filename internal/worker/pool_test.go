@@ -0,0 +1,164 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/logging"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/queue"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// blockingHandler runs until its context ends.
+func blockingHandler(started chan<- struct{}) Handler {
+	return func(ctx context.Context, jm queue.JobMessage) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+}
+
+func TestPoolCancelStopsRun(t *testing.T) {
+	started := make(chan struct{})
+	// a long lease keeps the heartbeat from touching the (absent) database
+	p := NewPool(nil, 1, 1, blockingHandler(started), WithLeaseTTL(time.Hour))
+	require.False(t, p.Cancel(7), "nothing is running yet")
+
+	type result struct{ stopped, err error }
+	done := make(chan result, 1)
+	go func() {
+		stopped, err := p.run(context.Background(), t.Context(), queue.JobMessage{JobID: 7}, "w")
+		done <- result{stopped, err}
+	}()
+	<-started
+	require.False(t, p.Cancel(8), "other jobs are not affected")
+	require.True(t, p.Cancel(7))
+
+	select {
+	case r := <-done:
+		require.ErrorIs(t, r.stopped, ErrJobCancelled)
+		require.ErrorIs(t, r.err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not stop after Cancel")
+	}
+	require.False(t, p.Cancel(7), "a finished run is forgotten")
+}
+
+func TestPoolRunTimeoutIsNotACancel(t *testing.T) {
+	started := make(chan struct{})
+	p := NewPool(nil, 1, 1, blockingHandler(started), WithLeaseTTL(time.Hour), WithJobTimeout(50*time.Millisecond))
+	stopped, err := p.run(context.Background(), t.Context(), queue.JobMessage{JobID: 7}, "w")
+	require.NoError(t, stopped, "a timed-out run is a failed attempt")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+type renewResult struct {
+	status string
+	owned  bool
+	err    error
+}
+
+// scriptedRenew answers lease renewals from results, repeating the last
+// one, and records the calls.
+type scriptedRenew struct {
+	mu      sync.Mutex
+	results []renewResult
+	calls   int
+}
+
+func (r *scriptedRenew) renew(ctx context.Context, jobID int64, worker string, ttl time.Duration) (string, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if jobID != 7 || worker != "w" || ttl != 30*time.Millisecond {
+		return "", false, errors.New("unexpected renewal")
+	}
+	res := r.results[min(r.calls, len(r.results)-1)]
+	r.calls++
+	return res.status, res.owned, res.err
+}
+
+func (r *scriptedRenew) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls
+}
+
+func TestPoolHeartbeat(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	errDB := errors.New("connection refused")
+	cases := []struct {
+		name    string
+		results []renewResult
+		stops   []error // causes the run is stopped with, in order
+		ends    bool    // the heartbeat returns before its context ends
+		calls   int     // renewals up to its return
+	}{
+		{"renewed", []renewResult{{"running", true, nil}}, nil, false, 0},
+		{"renewed while processing", []renewResult{{"processing", true, nil}}, nil, false, 0},
+		{"database errors are retried", []renewResult{{"", false, errDB}}, nil, false, 0},
+		{"lost", []renewResult{{"running", true, nil}, {"", false, nil}}, []error{ErrLeaseLost}, true, 2},
+		{"lost after an error", []renewResult{{"", false, errDB}, {"", false, nil}}, []error{ErrLeaseLost}, true, 2},
+		// the lease is kept for the cancel cleanup
+		{"cancelling", []renewResult{{"running", true, nil}, {"running", true, nil}, {"cancelling", true, nil}}, []error{ErrJobCancelled}, false, 0},
+		{"lost while cancelling", []renewResult{{"cancelling", true, nil}, {"cancelling", true, nil}, {"", false, nil}}, []error{ErrJobCancelled, ErrLeaseLost}, true, 3},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &scriptedRenew{results: tc.results}
+			p := NewPool(nil, 1, 1, nil)
+			p.leaseTTL = 30 * time.Millisecond
+			p.renewLease = r.renew
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var mu sync.Mutex
+			var stops []error
+			done := make(chan struct{})
+			go func() {
+				p.heartbeat(ctx, func(cause error) {
+					mu.Lock()
+					stops = append(stops, cause)
+					mu.Unlock()
+				}, 7, "w")
+				close(done)
+			}()
+
+			if tc.ends {
+				select {
+				case <-done:
+				case <-time.After(5 * time.Second):
+					t.Fatal("heartbeat kept going after the lease was lost")
+				}
+				require.Equal(t, tc.calls, r.count())
+			} else {
+				require.Eventually(t, func() bool { return r.count() >= len(tc.results)+5 }, 5*time.Second, 5*time.Millisecond)
+				cancel()
+				select {
+				case <-done:
+				case <-time.After(5 * time.Second):
+					t.Fatal("heartbeat outlived its context")
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			require.Equal(t, tc.stops, stops)
+		})
+	}
+}
+
+func TestPoolRunStopsWhenLeaseLost(t *testing.T) {
+	started := make(chan struct{})
+	p := NewPool(nil, 1, 1, blockingHandler(started))
+	p.leaseTTL = 30 * time.Millisecond
+	r := &scriptedRenew{results: []renewResult{{"running", true, nil}, {"", false, nil}}}
+	p.renewLease = r.renew
+
+	stopped, err := p.run(context.Background(), t.Context(), queue.JobMessage{JobID: 7}, "w")
+	require.ErrorIs(t, stopped, ErrLeaseLost)
+	require.ErrorIs(t, err, context.Canceled)
+	require.False(t, p.Cancel(7))
+}
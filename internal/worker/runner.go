@@ -3,12 +3,16 @@ package worker
 import (
 	"context"
 	"encoding/json"
+	"net/http"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/db"
 	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/logging"
 	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/metrics"
 	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/queue"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 
 	"github.com/nats-io/nats.go"
@@ -20,12 +24,35 @@ type WorkerConfig struct {
 	Concurrency int
 	QueueSize   int
 	DevLogging  bool
+	// JetStream pulls jobs from the durable JOBS stream instead of a core NATS
+	// queue subscription, so messages survive worker downtime.
+	JetStream bool
+	// JobTimeout bounds one handler run; RetryBaseDelay is the first retry
+	// delay (doubled per attempt). Zero keeps the pool defaults.
+	JobTimeout     time.Duration
+	RetryBaseDelay time.Duration
+	// MetricsAddr, when set (e.g. ":2113"), serves Prometheus metrics.
+	MetricsAddr string
+	// DB reuses an existing connection pool instead of opening one from
+	// DatabaseDSN; the caller keeps ownership and must close it.
+	DB *db.DB
+	// OnCancel removes partial results of a cancelled job (see
+	// WithCancelCleanup).
+	OnCancel Handler
+	// LaneWeights overrides DefaultLaneWeights; QueueSize applies per lane.
+	LaneWeights map[string]int
+	// LeaseTTL is how long a claimed job survives without a heartbeat
+	// (see WithLeaseTTL).
+	LeaseTTL time.Duration
 }
 
-// RunWorker starts a worker pool and subscribes to NATS subject "jobs".
+// RunWorker starts a worker pool and subscribes to the subject of every
+// priority lane (queue.Subject). With cfg.JetStream it pulls from one durable
+// consumer per lane instead and acks each message only after the job is
+// settled.
 // handler is the function executed for each job (it must respect ctx cancellation).
-// Caller should cancel ctx to stop the worker.
-func RunWorker(ctx context.Context, cfg WorkerConfig, handler func(ctx context.Context, jm queue.JobMessage) error) (*Pool, error) {
+// Caller should cancel ctx to stop the worker, then wait on Pool.Done.
+func RunWorker(ctx context.Context, cfg WorkerConfig, handler Handler) (*Pool, error) {
 	// set DB env if provided
 	if cfg.DatabaseDSN != "" {
 		_ = os.Setenv("DATABASE_URL", cfg.DatabaseDSN)
@@ -39,10 +66,20 @@ func RunWorker(ctx context.Context, cfg WorkerConfig, handler func(ctx context.C
 	metrics.Register()
 
 	// init db
-	database, err := db.New(ctx)
-	if err != nil {
-		logging.Logger.Error("db.New failed", zap.Error(err))
-		return nil, err
+	database := cfg.DB
+	ownDB := database == nil
+	if ownDB {
+		var err error
+		database, err = db.New(ctx)
+		if err != nil {
+			logging.Logger.Error("db.New failed", zap.Error(err))
+			return nil, err
+		}
+	}
+	closeDB := func() {
+		if ownDB {
+			database.Close()
+		}
 	}
 
 	// nats client
@@ -52,41 +89,174 @@ func RunWorker(ctx context.Context, cfg WorkerConfig, handler func(ctx context.C
 	}
 	nc, err := queue.NewNatsClient(natsURL)
 	if err != nil {
-		database.Close()
+		closeDB()
 		return nil, err
 	}
 
 	// construct pool (use handler signature expected by this package)
-	p := NewPool(database, cfg.Concurrency, cfg.QueueSize, handler)
+	p := NewPool(database, cfg.Concurrency, cfg.QueueSize, handler,
+		WithJobTimeout(cfg.JobTimeout), WithRetryBaseDelay(cfg.RetryBaseDelay), WithCancelCleanup(cfg.OnCancel),
+		WithLaneWeights(cfg.LaneWeights), WithLeaseTTL(cfg.LeaseTTL))
 	p.Start(ctx)
+	go observeLanes(ctx, database, p, 10*time.Second)
 
-	// subscribe to jobs subject and push messages into pool
-	sub, err := nc.QueueSubscribe("jobs", "audio-workers", func(m *nats.Msg) {
-		var jm queue.JobMessage
-		if err := json.Unmarshal(m.Data, &jm); err != nil {
-			logging.Logger.Error("bad job message", zap.Error(err))
+	// every worker hears every cancel; only the one running the job acts
+	cancelSub, err := nc.Subscribe(queue.CancelSubject, func(m *nats.Msg) {
+		var cm queue.CancelMessage
+		if err := json.Unmarshal(m.Data, &cm); err != nil {
+			logging.Logger.Error("bad cancel message", zap.Error(err))
 			return
 		}
-		if err := p.Enqueue(jm); err != nil {
-			logging.Logger.Warn("enqueue failed", zap.Error(err))
+		if p.Cancel(cm.JobID) {
+			logging.Logger.Info("cancelling job", zap.Int64("job", cm.JobID))
 		}
 	})
 	if err != nil {
-		// cleanup
 		p.Stop()
-		database.Close()
 		nc.Close()
+		closeDB()
 		return nil, err
 	}
 
+	var metricsSrv *http.Server
+	if cfg.MetricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		metricsSrv = &http.Server{Addr: cfg.MetricsAddr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+		go func() {
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logging.Logger.Error("metrics server error", zap.Error(err))
+			}
+		}()
+	}
+
+	shutdown := func() {
+		_ = cancelSub.Unsubscribe()
+		p.Stop()
+		if metricsSrv != nil {
+			_ = metricsSrv.Close()
+		}
+		nc.Close()
+		closeDB()
+	}
+
+	if cfg.JetStream {
+		if err := nc.EnableJetStream(queue.DefaultJetStreamConfig()); err != nil {
+			shutdown()
+			return nil, err
+		}
+		var consumers []*queue.JobConsumer
+		unsubscribe := func() {
+			for _, c := range consumers {
+				_ = c.Unsubscribe()
+			}
+		}
+		for _, lane := range queue.Priorities {
+			consumer, err := nc.PullSubscribe(queue.Subject(lane), queue.Durable(lane))
+			if err != nil {
+				unsubscribe()
+				shutdown()
+				return nil, err
+			}
+			consumers = append(consumers, consumer)
+		}
+		// one pull loop per lane, each blocked only by its own lane's buffer
+		var fetchers sync.WaitGroup
+		for _, c := range consumers {
+			fetchers.Add(1)
+			go func() {
+				defer fetchers.Done()
+				pullLoop(ctx, c, p)
+			}()
+		}
+
+		go func() {
+			<-ctx.Done()
+			fetchers.Wait()
+			unsubscribe()
+			shutdown()
+		}()
+		return p, nil
+	}
+
+	// subscribe to every lane's subject and push messages into the pool
+	var subs []*nats.Subscription
+	unsubscribe := func() {
+		for _, s := range subs {
+			_ = s.Unsubscribe()
+		}
+	}
+	for _, lane := range queue.Priorities {
+		sub, err := nc.QueueSubscribe(queue.Subject(lane), queue.WorkerQueue, func(m *nats.Msg) {
+			var jm queue.JobMessage
+			if err := json.Unmarshal(m.Data, &jm); err != nil {
+				logging.Logger.Error("bad job message", zap.Error(err))
+				return
+			}
+			if err := p.Enqueue(jm); err != nil {
+				logging.Logger.Warn("enqueue failed", zap.Error(err))
+			}
+		})
+		if err != nil {
+			// cleanup
+			unsubscribe()
+			shutdown()
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+
 	// cleanup on context cancellation
 	go func() {
 		<-ctx.Done()
-		_ = sub.Unsubscribe()
-		p.Stop()
-		nc.Close()
-		database.Close()
+		unsubscribe()
+		shutdown()
 	}()
 
 	return p, nil
 }
+
+// pullLoop fetches one message at a time and hands it to the pool; Submit
+// blocks while the pool is saturated, so we never pull more than we can run.
+func pullLoop(ctx context.Context, consumer *queue.JobConsumer, p *Pool) {
+	for ctx.Err() == nil {
+		deliveries, err := consumer.Fetch(ctx, 1, 5*time.Second)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logging.Logger.Warn("jetstream fetch failed", zap.Error(err))
+			time.Sleep(time.Second)
+			continue
+		}
+		for _, d := range deliveries {
+			if err := p.Submit(ctx, d); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// observeLanes exports the queued jobs per lane, counted in the jobs table so
+// every worker reports the same cluster-wide backlog, next to what this
+// pool holds in memory.
+func observeLanes(ctx context.Context, database *db.DB, p *Pool, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		depth, err := database.QueuedJobsByPriority(ctx)
+		if err == nil {
+			for _, lane := range queue.Priorities {
+				metrics.QueueDepth.WithLabelValues(lane).Set(float64(depth[lane]))
+			}
+		}
+		for lane, n := range p.Buffered() {
+			metrics.LaneBuffered.WithLabelValues(lane).Set(float64(n))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -15,3 +15,10 @@ func NilIfNullString(s sql.NullString) any {
 	}
 	return nil
 }
+
+func NilIfNullInt(i sql.NullInt64) any {
+	if i.Valid {
+		return i.Int64
+	}
+	return nil
+}
@@ -0,0 +1,389 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/api"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/db"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/logging"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/processing"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/queue"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/storage"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/worker"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func jobStatus(t *testing.T, ctx context.Context, d *db.DB, id int64) string {
+	t.Helper()
+	var status string
+	require.NoError(t, d.Pool.QueryRow(ctx, `SELECT status FROM jobs WHERE id=$1`, id).Scan(&status))
+	return status
+}
+
+func TestRequestJobCancel_Transitions(t *testing.T) {
+	ctx := context.Background()
+	d := startPostgres(t, ctx)
+
+	for _, tc := range []struct {
+		from, to string
+		err      error
+	}{
+		{"queued", "cancelled", nil},
+		{"scheduled", "cancelled", nil},
+		{"running", "cancelling", nil},
+		{"processing", "cancelling", nil},
+		{"cancelling", "cancelling", nil},
+		{"done", "done", db.ErrJobFinished},
+		{"failed", "failed", db.ErrJobFinished},
+		{"cancelled", "cancelled", db.ErrJobFinished},
+	} {
+		_, id := seedJob(t, ctx, d, tc.from)
+		status, err := d.RequestJobCancel(ctx, id)
+		if tc.err != nil {
+			require.ErrorIs(t, err, tc.err, tc.from)
+		} else {
+			require.NoError(t, err, tc.from)
+		}
+		require.Equal(t, tc.to, status, tc.from)
+		require.Equal(t, tc.to, jobStatus(t, ctx, d, id), tc.from)
+	}
+
+	_, err := d.RequestJobCancel(ctx, 1<<30)
+	require.ErrorIs(t, err, pgx.ErrNoRows)
+}
+
+func TestSettleJob_RefusedWhileCancelling(t *testing.T) {
+	ctx := context.Background()
+	d := startPostgres(t, ctx)
+
+	id := claimJob(t, ctx, d, "w")
+	_, err := d.Pool.Exec(ctx,
+		`INSERT INTO job_steps (job_id, name, position, status) VALUES ($1,'probe',0,'done'), ($1,'transcode',1,'running'), ($1,'waveform',2,'pending')`, id)
+	require.NoError(t, err)
+
+	status, err := d.RequestJobCancel(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, "cancelling", status)
+
+	// the worker's outcome loses to the pending cancel
+	for _, outcome := range []string{"done", "queued"} {
+		settled, err := d.SettleJob(ctx, id, "w", outcome, 100, "")
+		require.NoError(t, err)
+		require.False(t, settled, outcome)
+		require.Equal(t, "cancelling", jobStatus(t, ctx, d, id))
+	}
+	settled, err := d.DeadLetterJob(ctx, id, "", "w", "jobs.dead")
+	require.NoError(t, err)
+	require.False(t, settled)
+
+	// only the worker holding the job finishes it
+	require.ErrorIs(t, d.FinishCancelledJob(ctx, id, "other", "job cancelled"), db.ErrLeaseLost)
+	require.ErrorIs(t, d.FinishCancelledJob(ctx, id, "", "job cancelled"), db.ErrLeaseLost)
+	require.Equal(t, "cancelling", jobStatus(t, ctx, d, id))
+	require.NoError(t, d.FinishCancelledJob(ctx, id, "w", "job cancelled"))
+	require.Equal(t, "cancelled", jobStatus(t, ctx, d, id))
+	rows, err := d.Pool.Query(ctx, `SELECT name, status FROM job_steps WHERE job_id=$1 ORDER BY position`, id)
+	require.NoError(t, err)
+	steps := map[string]string{}
+	for rows.Next() {
+		var name, st string
+		require.NoError(t, rows.Scan(&name, &st))
+		steps[name] = st
+	}
+	require.NoError(t, rows.Err())
+	require.Equal(t, map[string]string{"probe": "done", "transcode": "skipped", "waveform": "skipped"}, steps)
+
+	// a job that is not being cancelled settles normally
+	other := claimJob(t, ctx, d, "w")
+	settled, err = d.SettleJob(ctx, other, "w", "done", 100, "completed")
+	require.NoError(t, err)
+	require.True(t, settled)
+	require.Equal(t, "done", jobStatus(t, ctx, d, other))
+}
+
+func TestSettleJob_LeaseLost(t *testing.T) {
+	ctx := context.Background()
+	d := startPostgres(t, ctx)
+
+	id := claimJob(t, ctx, d, "w1")
+	// another worker's outcome is refused
+	_, err := d.SettleJob(ctx, id, "w2", "done", 100, "")
+	require.ErrorIs(t, err, db.ErrLeaseLost)
+
+	// the lease runs out and the reaper requeues the job
+	_, err = d.Pool.Exec(ctx, `UPDATE jobs SET lease_expires_at = now() - interval '1 second' WHERE id=$1`, id)
+	require.NoError(t, err)
+	require.NoError(t, d.WithTx(ctx, func(tx pgx.Tx) error {
+		reaped, err := db.ReapExpiredLeases(ctx, tx, 10, time.Minute)
+		require.Len(t, reaped, 1)
+		return err
+	}))
+	require.Equal(t, "queued", jobStatus(t, ctx, d, id))
+
+	// the late outcome of the first worker changes nothing
+	_, err = d.SettleJob(ctx, id, "w1", "done", 100, "")
+	require.ErrorIs(t, err, db.ErrLeaseLost)
+	_, _, err = d.RecordJobFailure(ctx, id, "w1", "boom")
+	require.ErrorIs(t, err, db.ErrLeaseLost)
+	_, err = d.DeadLetterJob(ctx, id, "", "w1", "jobs.dead")
+	require.ErrorIs(t, err, db.ErrLeaseLost)
+	require.Equal(t, "queued", jobStatus(t, ctx, d, id))
+	var retries int
+	require.NoError(t, d.Pool.QueryRow(ctx, `SELECT retry_count FROM jobs WHERE id=$1`, id).Scan(&retries))
+	require.Equal(t, 1, retries, "only the reaper counted the attempt")
+
+	// nor once the next worker runs it
+	ok, err := d.TryClaimJob(ctx, id, "w2", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+	_, err = d.SettleJob(ctx, id, "w1", "done", 100, "")
+	require.ErrorIs(t, err, db.ErrLeaseLost)
+	retries, _, err = d.RecordJobFailure(ctx, id, "w2", "boom")
+	require.NoError(t, err)
+	require.Equal(t, 2, retries)
+	settled, err := d.SettleJob(ctx, id, "w2", "queued", 0, "")
+	require.NoError(t, err)
+	require.True(t, settled)
+}
+
+func TestReapExpiredJobLeases_CleansUpCancellingJobs(t *testing.T) {
+	ctx := context.Background()
+	d := startPostgres(t, ctx)
+
+	var cleaned []queue.JobMessage
+	cleanupErr := errors.New("bucket unavailable")
+	a := &api.API{DB: d, CancelCleanup: func(ctx context.Context, jm queue.JobMessage) error {
+		cleaned = append(cleaned, jm)
+		if len(cleaned) == 2 {
+			return cleanupErr
+		}
+		return nil
+	}}
+	expire := func(id int64) {
+		_, err := d.Pool.Exec(ctx, `UPDATE jobs SET lease_expires_at = now() - interval '1 second' WHERE id=$1`, id)
+		require.NoError(t, err)
+	}
+
+	id := claimJob(t, ctx, d, "w")
+	_, err := d.Pool.Exec(ctx,
+		`INSERT INTO job_steps (job_id, name, position, status) VALUES ($1,'probe',0,'done'), ($1,'transcode',1,'running')`, id)
+	require.NoError(t, err)
+	_, err = d.RequestJobCancel(ctx, id)
+	require.NoError(t, err)
+	expire(id)
+
+	n, err := a.ReapExpiredJobLeases(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Len(t, cleaned, 1)
+	require.EqualValues(t, id, cleaned[0].JobID)
+	require.Equal(t, "cancelled", jobStatus(t, ctx, d, id))
+	var stepStatus, stepErr string
+	require.NoError(t, d.Pool.QueryRow(ctx,
+		`SELECT status, error FROM job_steps WHERE job_id=$1 AND name='transcode'`, id).Scan(&stepStatus, &stepErr))
+	require.Equal(t, "skipped", stepStatus)
+	require.Equal(t, "cancelled", stepErr)
+	// a worker that comes back learns the job is no longer its own
+	_, owned, err := d.RenewJobLease(ctx, id, "w", time.Minute)
+	require.NoError(t, err)
+	require.False(t, owned)
+
+	// a failed cleanup is noted, and the job still ends cancelled
+	other := claimJob(t, ctx, d, "w")
+	_, err = d.RequestJobCancel(ctx, other)
+	require.NoError(t, err)
+	expire(other)
+	n, err = a.ReapExpiredJobLeases(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, "cancelled", jobStatus(t, ctx, d, other))
+	var logs string
+	require.NoError(t, d.Pool.QueryRow(ctx, `SELECT logs FROM jobs WHERE id=$1`, other).Scan(&logs))
+	require.Contains(t, logs, "cleanup failed: bucket unavailable")
+
+	// should the API stop before finishing, the job is reaped again later
+	id = claimJob(t, ctx, d, "w")
+	_, err = d.RequestJobCancel(ctx, id)
+	require.NoError(t, err)
+	expire(id)
+	require.NoError(t, d.WithTx(ctx, func(tx pgx.Tx) error {
+		reaped, err := db.ReapExpiredLeases(ctx, tx, 10, time.Minute)
+		require.Len(t, reaped, 1)
+		require.Equal(t, "cancelling", reaped[0].Status)
+		require.Equal(t, "w", reaped[0].Worker)
+		return err
+	}))
+	require.Equal(t, "cancelling", jobStatus(t, ctx, d, id))
+	n, err = a.ReapExpiredJobLeases(ctx)
+	require.NoError(t, err)
+	require.Zero(t, n, "held while the cleanup runs")
+	expire(id)
+	n, err = a.ReapExpiredJobLeases(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, "cancelled", jobStatus(t, ctx, d, id))
+}
+
+func TestCancelJobHandler(t *testing.T) {
+	ctx := context.Background()
+	d := startPostgres(t, ctx)
+
+	a := &api.API{DB: d}
+	r := chi.NewRouter()
+	r.Post("/jobs/{id}/cancel", a.CancelJobHandler)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	cancel := func(id int64) (int, map[string]any) {
+		resp, err := http.Post(srv.URL+"/jobs/"+strconv.FormatInt(id, 10)+"/cancel", "", nil)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return resp.StatusCode, body
+	}
+
+	_, queued := seedJob(t, ctx, d, "queued")
+	code, body := cancel(queued)
+	require.Equal(t, http.StatusAccepted, code)
+	require.Equal(t, "cancelled", body["status"])
+
+	// without a queue connection the worker still notices on its heartbeat
+	_, running := seedJob(t, ctx, d, "running")
+	code, body = cancel(running)
+	require.Equal(t, http.StatusAccepted, code)
+	require.Equal(t, "cancelling", body["status"])
+
+	_, done := seedJob(t, ctx, d, "done")
+	code, body = cancel(done)
+	require.Equal(t, http.StatusConflict, code)
+	require.Equal(t, "job_finished", body["error"])
+
+	code, body = cancel(1 << 30)
+	require.Equal(t, http.StatusNotFound, code)
+	require.Equal(t, "not_found", body["error"])
+}
+
+func TestCancelCleanup_KeepsEarlierRunResults(t *testing.T) {
+	ctx := context.Background()
+	d := startPostgres(t, ctx)
+	store := storage.NewLocalFS(t.TempDir())
+	cleanup := processing.NewCancelCleanup(d, store)
+
+	save := func(p, body string) {
+		_, err := store.Save(strings.NewReader(body), p)
+		require.NoError(t, err)
+	}
+	outPath := storage.ArtifactPath("seed/a.mp3", "mp3_320.mp3")
+
+	// an earlier run completed and recorded its output
+	uploadID, done := seedJob(t, ctx, d, "done")
+	save(outPath, "first run")
+	require.NoError(t, d.UpsertOutput(ctx, &db.Output{UploadID: uploadID, JobID: &done, Name: "mp3_320", Path: outPath, Container: "mp3"}))
+	_, err := d.Pool.Exec(ctx, `UPDATE uploads SET output_path=$1 WHERE id=$2`, outPath, uploadID)
+	require.NoError(t, err)
+
+	// the reprocess is cancelled after staging its own copy
+	var reprocess int64
+	require.NoError(t, d.Pool.QueryRow(ctx,
+		`INSERT INTO jobs (upload_id, type, status) VALUES ($1, 'transcode', 'cancelling') RETURNING id`, uploadID,
+	).Scan(&reprocess))
+	staged := storage.ArtifactPath("seed/a.mp3", ".staging/"+strconv.FormatInt(reprocess, 10)+"/mp3_320.mp3")
+	save(staged, "reprocess")
+
+	require.NoError(t, cleanup(ctx, queue.JobMessage{JobID: reprocess, UploadID: uploadID}))
+	_, err = store.Stat(staged)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+	f, err := store.Open(outPath)
+	require.NoError(t, err)
+	body, err := io.ReadAll(f)
+	f.Close()
+	require.NoError(t, err)
+	require.Equal(t, "first run", string(body))
+	outs, err := d.ListOutputs(ctx, uploadID)
+	require.NoError(t, err)
+	require.Len(t, outs, 1)
+	require.Equal(t, outPath, outs[0].Path)
+	var outputPath *string
+	require.NoError(t, d.Pool.QueryRow(ctx, `SELECT output_path FROM uploads WHERE id=$1`, uploadID).Scan(&outputPath))
+	require.NotNil(t, outputPath)
+	require.Equal(t, outPath, *outputPath)
+
+	// without a completed run, whatever the job left behind goes
+	_, err = d.Pool.Exec(ctx, `UPDATE jobs SET status='failed' WHERE id=$1`, done)
+	require.NoError(t, err)
+	save(staged, "reprocess")
+	require.NoError(t, cleanup(ctx, queue.JobMessage{JobID: reprocess, UploadID: uploadID}))
+	objects, err := store.List(storage.ArtifactPath("seed/a.mp3", ""))
+	require.NoError(t, err)
+	require.Empty(t, objects)
+	outs, err = d.ListOutputs(ctx, uploadID)
+	require.NoError(t, err)
+	require.Empty(t, outs)
+}
+
+func TestPoolHoldsLeaseDuringCancelCleanup(t *testing.T) {
+	ctx := context.Background()
+	d := startPostgres(t, ctx)
+	logging.Logger = zap.NewNop()
+
+	var reaperCleanups atomic.Int32
+	a := &api.API{DB: d, CancelCleanup: func(context.Context, queue.JobMessage) error {
+		reaperCleanups.Add(1)
+		return nil
+	}}
+	cleaning := make(chan struct{})
+	var cleanups atomic.Int32
+	started := make(chan struct{})
+	p := worker.NewPool(d, 1, 1,
+		func(ctx context.Context, jm queue.JobMessage) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		worker.WithLeaseTTL(time.Second),
+		worker.WithCancelCleanup(func(context.Context, queue.JobMessage) error {
+			cleanups.Add(1)
+			close(cleaning)
+			// outlast the lease a few times over
+			time.Sleep(3 * time.Second)
+			return nil
+		}))
+	p.Start(ctx)
+	defer p.Stop()
+
+	uploadID, id := seedJob(t, ctx, d, "queued")
+	require.NoError(t, p.Enqueue(queue.JobMessage{JobID: id, UploadID: uploadID, Type: "transcode"}))
+	<-started
+	// no broadcast: the heartbeat notices the cancel
+	_, err := d.RequestJobCancel(ctx, id)
+	require.NoError(t, err)
+
+	select {
+	case <-cleaning:
+	case <-time.After(10 * time.Second):
+		t.Fatal("cleanup did not start")
+	}
+	for deadline := time.Now().Add(2500 * time.Millisecond); time.Now().Before(deadline); {
+		n, err := a.ReapExpiredJobLeases(ctx)
+		require.NoError(t, err)
+		require.Zero(t, n, "the worker still holds the lease while it cleans up")
+		time.Sleep(100 * time.Millisecond)
+	}
+	require.Eventually(t, func() bool { return jobStatus(t, ctx, d, id) == "cancelled" }, 10*time.Second, 50*time.Millisecond)
+	require.EqualValues(t, 1, cleanups.Load())
+	require.Zero(t, reaperCleanups.Load())
+}
@@ -94,50 +94,24 @@ func TestE2E_UploadAndProcess_WithTestcontainers(t *testing.T) {
 	}
 
 	// -------------------------------
-	// 2) Create DB schema inline
+	// 2) Apply schema migrations (same ones the services run)
 	// -------------------------------
 	conn, err := sql.Open("postgres", dsn)
 	require.NoError(t, err)
 	defer conn.Close()
 
-	schema := []string{
-		`CREATE TABLE IF NOT EXISTS uploads (
-			id SERIAL PRIMARY KEY,
-			filename TEXT,
-			path TEXT,
-			output_path TEXT,
-			content_type TEXT,
-			size BIGINT,
-			status TEXT DEFAULT 'queued',
-			duration_seconds DOUBLE PRECISION,
-			integrated_lufs DOUBLE PRECISION,
-			bpm DOUBLE PRECISION,
-			musical_key TEXT,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
-		);`,
-		`CREATE TABLE IF NOT EXISTS jobs (
-			id SERIAL PRIMARY KEY,
-			upload_id INT REFERENCES uploads(id),
-			type TEXT,
-			status TEXT DEFAULT 'queued',
-			progress INT DEFAULT 0,
-			logs TEXT DEFAULT '',
-			retry_count INT DEFAULT 0,
-			max_retries INT DEFAULT 3,
-			last_error TEXT DEFAULT '',
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
-		);`,
-	}
-	for _, s := range schema {
-		_, err := conn.Exec(s)
-		require.NoError(t, err)
-	}
+	require.NoError(t, os.Setenv("DATABASE_URL", dsn))
+	migrator, err := db.Connect(ctx)
+	require.NoError(t, err)
+	require.NoError(t, migrator.Migrate(ctx))
+	migrator.Close()
 
 	// -------------------------------
 	// 3) Start NATS container
 	// -------------------------------
 	natsReq := testcontainers.ContainerRequest{
 		Image:        "nats:latest",
+		Cmd:          []string{"-js"},
 		ExposedPorts: []string{"4222/tcp"},
 		WaitingFor:   wait.ForListeningPort("4222/tcp").WithStartupTimeout(60 * time.Second),
 	}
@@ -171,6 +145,7 @@ func TestE2E_UploadAndProcess_WithTestcontainers(t *testing.T) {
 		StorageBase: storageDir,
 		NatsURL:     natsURL,
 		DevLogging:  true,
+		JetStream:   true,
 	}
 	apiCtx, apiCancel := context.WithCancel(ctx)
 	defer apiCancel()
@@ -190,6 +165,7 @@ func TestE2E_UploadAndProcess_WithTestcontainers(t *testing.T) {
 		Concurrency: 2,
 		QueueSize:   10,
 		DevLogging:  true,
+		JetStream:   true,
 	}
 	workerCtx, workerCancel := context.WithCancel(ctx)
 	defer workerCancel()
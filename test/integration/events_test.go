@@ -0,0 +1,147 @@
+package integration
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/api"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+type sseEvent struct {
+	ID    string
+	Event string
+	Data  map[string]any
+}
+
+// readSSE parses an event stream until it ends, sending each event.
+func readSSE(body io.Reader) <-chan sseEvent {
+	out := make(chan sseEvent)
+	go func() {
+		defer close(out)
+		sc := bufio.NewScanner(body)
+		var e sseEvent
+		for sc.Scan() {
+			line := sc.Text()
+			switch {
+			case line == "":
+				if e.Event != "" {
+					out <- e
+				}
+				e = sseEvent{}
+			case strings.HasPrefix(line, "id: "):
+				e.ID = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				e.Event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				_ = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e.Data)
+			}
+		}
+	}()
+	return out
+}
+
+func nextEvent(t *testing.T, events <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case e, ok := <-events:
+		require.True(t, ok, "stream ended early")
+		return e
+	case <-time.After(10 * time.Second):
+		t.Fatal("no event within 10s")
+		return sseEvent{}
+	}
+}
+
+func TestJobEvents_FollowAndEndOnTerminalStatus(t *testing.T) {
+	ctx := context.Background()
+	d := startPostgres(t, ctx)
+
+	hub := api.NewEventHub(d)
+	hubCtx, stopHub := context.WithCancel(ctx)
+	defer stopHub()
+	go hub.Run(hubCtx)
+
+	a := &api.API{DB: d, Events: hub}
+	r := chi.NewRouter()
+	r.Get("/jobs/{id}/events", a.JobEventsHandler)
+	r.Get("/uploads/{id}/events", a.UploadEventsHandler)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	uploadID, jobID := seedJob(t, ctx, d, "queued")
+	_, otherJob := seedJob(t, ctx, d, "queued")
+	job := strconv.FormatInt(jobID, 10)
+
+	resp, err := http.Get(srv.URL + "/jobs/" + job + "/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	events := readSSE(resp.Body)
+
+	// the history is replayed first
+	e := nextEvent(t, events)
+	require.Equal(t, "status", e.Event)
+	require.Equal(t, "queued", e.Data["status"])
+
+	// changes of other jobs are not delivered
+	_, err = d.Pool.Exec(ctx, `UPDATE jobs SET status='running' WHERE id=$1`, otherJob)
+	require.NoError(t, err)
+
+	for _, step := range []struct{ sql, kind, status string }{
+		{`UPDATE jobs SET status='running' WHERE id=$1`, "status", "running"},
+		{`UPDATE jobs SET progress=40 WHERE id=$1`, "progress", "running"},
+		{`UPDATE jobs SET logs = logs || E'\nstep transcode: done' WHERE id=$1`, "log", "running"},
+		{`UPDATE jobs SET status='done', progress=100 WHERE id=$1`, "status", "done"},
+	} {
+		_, err := d.Pool.Exec(ctx, step.sql, jobID)
+		require.NoError(t, err)
+		e = nextEvent(t, events)
+		require.Equal(t, step.kind, e.Event, step.sql)
+		require.Equal(t, step.status, e.Data["status"], step.sql)
+		require.EqualValues(t, jobID, e.Data["job_id"])
+	}
+	lastID := e.ID
+	e = nextEvent(t, events)
+	require.Equal(t, "end", e.Event)
+	require.Equal(t, "done", e.Data["status"])
+	_, open := <-events
+	require.False(t, open, "the stream closes after the end event")
+
+	// resuming a finished job past its last event only gets the end event
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/jobs/"+job+"/events", nil)
+	require.NoError(t, err)
+	req.Header.Set("Last-Event-ID", lastID)
+	resumed, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resumed.Body.Close()
+	events = readSSE(resumed.Body)
+	e = nextEvent(t, events)
+	require.Equal(t, "end", e.Event)
+	_, open = <-events
+	require.False(t, open)
+
+	// the upload stream replays every job of the upload and stays open
+	upload, err := http.Get(srv.URL + "/uploads/" + strconv.FormatInt(uploadID, 10) + "/events?last_event_id=0")
+	require.NoError(t, err)
+	defer upload.Body.Close()
+	events = readSSE(upload.Body)
+	for i := 0; i < 5; i++ {
+		e := nextEvent(t, events)
+		require.EqualValues(t, jobID, e.Data["job_id"])
+	}
+	select {
+	case e := <-events:
+		t.Fatalf("unexpected event %+v", e)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
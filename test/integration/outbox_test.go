@@ -0,0 +1,47 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/db"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/logging"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/outbox"
+	"github.com/stretchr/testify/require"
+)
+
+type failingPublisher struct{ calls atomic.Int32 }
+
+func (p *failingPublisher) Publish(ctx context.Context, subject string, data []byte) error {
+	p.calls.Add(1)
+	return errors.New("nats: no responders")
+}
+
+// cmd/api never initializes the zap logger, so the relay must not need it.
+func TestRelay_FailingPublishWithoutZapLogger(t *testing.T) {
+	ctx := context.Background()
+	d := startPostgres(t, ctx)
+	logging.Logger = nil
+
+	require.NoError(t, db.InsertOutbox(ctx, d.Pool, "jobs", map[string]int{"job_id": 1}))
+	pub := &failingPublisher{}
+	relay := outbox.NewRelay(d, pub, 10*time.Millisecond)
+	runCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		relay.Run(runCtx)
+	}()
+
+	require.Eventually(t, func() bool {
+		var attempts int
+		err := d.Pool.QueryRow(ctx, `SELECT attempts FROM outbox WHERE sent_at IS NULL`).Scan(&attempts)
+		return err == nil && attempts >= 2
+	}, 10*time.Second, 20*time.Millisecond)
+	stop()
+	<-done
+	require.GreaterOrEqual(t, pub.calls.Load(), int32(2))
+}
@@ -0,0 +1,72 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/db"
+	"github.com/stretchr/testify/require"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// startPostgres runs a throwaway Postgres, applies the migrations and
+// returns a connection to it. DATABASE_URL points at it for the test.
+func startPostgres(t *testing.T, ctx context.Context) *db.DB {
+	t.Helper()
+	req := testcontainers.ContainerRequest{
+		Image: "postgres:15",
+		Env: map[string]string{
+			"POSTGRES_DB":       "goaudio",
+			"POSTGRES_USER":     "postgres",
+			"POSTGRES_PASSWORD": "postgres",
+		},
+		ExposedPorts: []string{"5432/tcp"},
+		// the server restarts once after initdb; wait for the second start
+		WaitingFor: wait.ForLog("database system is ready to accept connections").
+			WithOccurrence(2).WithStartupTimeout(90 * time.Second),
+	}
+	c, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Terminate(context.Background()) })
+
+	host, err := c.Host(ctx)
+	require.NoError(t, err)
+	port, err := c.MappedPort(ctx, "5432")
+	require.NoError(t, err)
+	t.Setenv("DATABASE_URL", fmt.Sprintf("postgres://postgres:postgres@%s:%s/goaudio?sslmode=disable", host, port.Port()))
+
+	d, err := db.Connect(ctx)
+	require.NoError(t, err)
+	t.Cleanup(d.Close)
+	require.NoError(t, d.Migrate(ctx))
+	return d
+}
+
+// seedJob inserts an upload with one job in status and returns their ids.
+func seedJob(t *testing.T, ctx context.Context, d *db.DB, status string) (uploadID, jobID int64) {
+	t.Helper()
+	require.NoError(t, d.Pool.QueryRow(ctx,
+		`INSERT INTO uploads (filename, path, status) VALUES ('a.mp3', 'seed/a.mp3', 'queued') RETURNING id`,
+	).Scan(&uploadID))
+	require.NoError(t, d.Pool.QueryRow(ctx,
+		`INSERT INTO jobs (upload_id, type, status) VALUES ($1, 'transcode', $2) RETURNING id`, uploadID, status,
+	).Scan(&jobID))
+	return uploadID, jobID
+}
+
+// claimJob seeds a queued job and claims it for worker, as a pool would.
+func claimJob(t *testing.T, ctx context.Context, d *db.DB, worker string) int64 {
+	t.Helper()
+	_, id := seedJob(t, ctx, d, "queued")
+	ok, err := d.TryClaimJob(ctx, id, worker, time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+	return id
+}
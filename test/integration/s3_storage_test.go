@@ -0,0 +1,135 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/storage"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/stretchr/testify/require"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// startMinIO runs a throwaway MinIO server and returns its host:port endpoint.
+func startMinIO(t *testing.T, ctx context.Context) string {
+	t.Helper()
+	req := testcontainers.ContainerRequest{
+		Image:        "minio/minio:latest",
+		Cmd:          []string{"server", "/data"},
+		Env:          map[string]string{"MINIO_ROOT_USER": "minioadmin", "MINIO_ROOT_PASSWORD": "minioadmin"},
+		ExposedPorts: []string{"9000/tcp"},
+		WaitingFor:   wait.ForHTTP("/minio/health/live").WithPort("9000/tcp").WithStartupTimeout(90 * time.Second),
+	}
+	c, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Terminate(context.Background()) })
+
+	host, err := c.Host(ctx)
+	require.NoError(t, err)
+	port, err := c.MappedPort(ctx, "9000")
+	require.NoError(t, err)
+	return host + ":" + port.Port()
+}
+
+func TestS3Storage_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	endpoint := startMinIO(t, ctx)
+
+	cfg := storage.S3Config{
+		Endpoint:     endpoint,
+		Region:       "us-east-1",
+		Bucket:       "phantom-test",
+		Prefix:       "uploads",
+		AccessKey:    "minioadmin",
+		SecretKey:    "minioadmin",
+		UseSSL:       false,
+		PartSize:     5 << 20, // S3 minimum, forces multipart below
+		CreateBucket: true,
+	}
+	store, err := storage.New(storage.Config{Backend: "s3", S3: cfg})
+	require.NoError(t, err)
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds: credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+	})
+	require.NoError(t, err)
+
+	// small object: single PUT
+	small := []byte("tiny audio")
+	saved, err := store.Save(bytes.NewReader(small), "20250101/small.mp3")
+	require.NoError(t, err)
+	require.Equal(t, int64(len(small)), saved.Size)
+	smallSum := sha256.Sum256(small)
+	require.Equal(t, hex.EncodeToString(smallSum[:]), saved.SHA256)
+
+	obj, err := client.GetObject(ctx, cfg.Bucket, "uploads/20250101/small.mp3", minio.GetObjectOptions{})
+	require.NoError(t, err)
+	got, err := io.ReadAll(obj)
+	require.NoError(t, err)
+	require.Equal(t, small, got)
+
+	// large object: streamed as multipart (3 parts)
+	large := make([]byte, 12<<20)
+	_, err = rand.Read(large)
+	require.NoError(t, err)
+	saved, err = store.Save(bytes.NewReader(large), "20250101/large.wav")
+	require.NoError(t, err)
+	require.Equal(t, int64(len(large)), saved.Size)
+	largeSum := sha256.Sum256(large)
+	require.Equal(t, hex.EncodeToString(largeSum[:]), saved.SHA256)
+
+	st, err := client.StatObject(ctx, cfg.Bucket, "uploads/20250101/large.wav", minio.StatObjectOptions{})
+	require.NoError(t, err)
+	require.Equal(t, int64(len(large)), st.Size)
+	require.Equal(t, "audio/wav", st.ContentType)
+
+	// read back through the Storage interface
+	info, err := store.Stat("20250101/large.wav")
+	require.NoError(t, err)
+	require.Equal(t, int64(len(large)), info.Size)
+	require.Equal(t, "20250101/large.wav", info.Path)
+
+	rc, err := store.Open("20250101/large.wav")
+	require.NoError(t, err)
+	_, err = rc.Seek(int64(len(large)-4), io.SeekStart)
+	require.NoError(t, err)
+	tail, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.Equal(t, large[len(large)-4:], tail)
+	require.NoError(t, rc.Close())
+
+	objs, err := store.List("20250101/")
+	require.NoError(t, err)
+	require.Len(t, objs, 2)
+	require.Equal(t, "20250101/large.wav", objs[0].Path)
+	require.Equal(t, "20250101/small.mp3", objs[1].Path)
+
+	local, cleanup, err := store.Materialize("20250101/small.mp3")
+	require.NoError(t, err)
+	onDisk, err := os.ReadFile(local)
+	require.NoError(t, err)
+	require.Equal(t, small, onDisk)
+	cleanup()
+	_, err = os.Stat(local)
+	require.True(t, os.IsNotExist(err))
+
+	require.NoError(t, store.Delete("20250101/small.mp3"))
+	require.NoError(t, store.Delete("20250101/small.mp3"), "delete is idempotent")
+	_, err = store.Stat("20250101/small.mp3")
+	require.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = store.Open("20250101/small.mp3")
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
@@ -0,0 +1,93 @@
+package integration
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/api"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/signing"
+	"github.com/Bahadou-Badr/PhantomChain-Audio-Processing-System-Go/internal/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSingleUseLink_ContinuationNeedsFirstResponseCookie(t *testing.T) {
+	ctx := context.Background()
+	d := startPostgres(t, ctx)
+
+	store := storage.NewLocalFS(t.TempDir())
+	content := strings.Repeat("0123456789", 100)
+	_, err := store.Save(strings.NewReader(content), "seed/a.mp3")
+	require.NoError(t, err)
+	keys, err := signing.ParseKeys("k1:" + strings.Repeat("s", 32))
+	require.NoError(t, err)
+
+	a := &api.API{DB: d, Storage: store, Share: api.ShareConfig{Keys: keys}}
+	r := chi.NewRouter()
+	a.RegisterShareRoutes(r)
+	// every client reaches the server from the same address, as behind a
+	// reverse proxy or NAT
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	uploadID, _ := seedJob(t, ctx, d, "done")
+	link := func(path string) string {
+		u, err := url.Parse(srv.URL + "/shared/uploads/" + strconv.FormatInt(uploadID, 10) + path)
+		require.NoError(t, err)
+		nonce, err := signing.NewNonce()
+		require.NoError(t, err)
+		keys.Sign(u, time.Now().Add(time.Hour), nonce)
+		return u.String()
+	}
+	get := func(u, rng string, cookies ...*http.Cookie) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		require.NoError(t, err)
+		if rng != "" {
+			req.Header.Set("Range", rng)
+		}
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp
+	}
+
+	u := link("/original")
+	first := get(u, "bytes=0-99")
+	require.Equal(t, http.StatusPartialContent, first.StatusCode)
+	cookies := first.Cookies()
+	require.Len(t, cookies, 1)
+	require.True(t, cookies[0].HttpOnly)
+
+	// another client behind the same proxy cannot replay the link, not
+	// even as a range starting at 0
+	require.Equal(t, http.StatusGone, get(u, "").StatusCode)
+	require.Equal(t, http.StatusGone, get(u, "bytes=0-").StatusCode)
+	require.Equal(t, http.StatusGone, get(u, "bytes=100-199").StatusCode)
+	forged := &http.Cookie{Name: cookies[0].Name, Value: strings.Repeat("0", len(cookies[0].Value))}
+	require.Equal(t, http.StatusGone, get(u, "bytes=0-", forged).StatusCode)
+
+	// the first client seeks with its cookie
+	require.Equal(t, http.StatusPartialContent, get(u, "bytes=500-", cookies[0]).StatusCode)
+	// but the cookie is not a second full use of the link
+	require.Equal(t, http.StatusGone, get(u, "", cookies[0]).StatusCode)
+	// nor does it open other single-use links
+	other := link("/original")
+	require.Equal(t, http.StatusOK, get(other, "").StatusCode)
+	require.Equal(t, http.StatusGone, get(other, "bytes=0-", cookies[0]).StatusCode)
+
+	// a first request that fails does not use the link up
+	missing := link("/outputs/mp3_128k")
+	require.Equal(t, http.StatusNotFound, get(missing, "").StatusCode)
+	require.Equal(t, http.StatusNotFound, get(missing, "").StatusCode)
+}